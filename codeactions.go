@@ -167,13 +167,29 @@ func SetupLibs(s *server.Server) error {
 		if err != nil {
 			return err
 		}
-		libs := []string{}
+		// libs failed on this node are only installed again through the admin API, a library failing
+		// on every startup must not keep the node from starting
+		node := s.Config.CodeLib.Node
 		for _, lib := range currentLibs {
-			libs = append(libs, lib.Name)
-		}
-		if err := codelib.InstallPythonLibs(libs); err != nil {
-			log.Fatal(err)
+			if install := lib.InstallOn(node); install != nil && install.Status == codelib.StatusFailed {
+				continue
+			}
+			output, err := codelib.InstallPythonLib(lib.Name)
+			if err != nil {
+				log.WithError(err).Error("error on installing code lib")
+				updateLibStatus(codelibService, lib.ID, node, codelib.StatusFailed, output)
+				continue
+			}
+			updateLibStatus(codelibService, lib.ID, node, codelib.StatusInstalled, output)
 		}
 	}
 	return nil
 }
+
+func updateLibStatus(codelibService codelib.UseCase, id string, node string, status codelib.LibStatus, output string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := codelibService.UpdateStatus(ctx, id, node, status, output); err != nil {
+		log.WithError(err).Error("error on updating code lib status")
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +25,14 @@ type Config struct {
 	Skiplist           string
 	S3                 S3Config
 	WorkerPool         WorkerPoolConfig
+	ActionLimits       ActionLimitsConfig
+	Webhook            WebhookConfig
+	CodeLib            CodeLibConfig
+	Sandbox            SandboxConfig
+	Egress             EgressConfig
+	PythonPool         PythonPoolConfig
+	Runtime            RuntimeConfig
+	SecretsMasterKey   string // base64 encoded 32 bytes AES key encrypting the code secrets at rest
 
 	HealthCheckCacheTime int64
 }
@@ -41,6 +50,98 @@ type CleanerConfig struct {
 type WorkerPoolConfig struct {
 	Workers   int
 	QueueSize int
+	// Backend is "memory" for the in process pool or "rabbitmq" for a durable queue shared by the nodes
+	Backend string
+	// QueueName is the RabbitMQ queue of the code runs when Backend is "rabbitmq"
+	QueueName string
+	// MaxRedeliveries is how many times a run left unfinished by a lost worker is executed again before failing
+	MaxRedeliveries int
+	// ProjectWeights is how many tasks of a project the in process pool serves on its turn, 1 by default
+	ProjectWeights map[string]int
+	// StarvationAge is how long, in seconds, a task of a lower priority lane waits before its lane is served first
+	StarvationAge int64
+	// MaxInFlightPerCode and MaxInFlightPerProject bound the queued and running runs across the nodes, 0 for no limit
+	MaxInFlightPerCode    int
+	MaxInFlightPerProject int
+	// InFlightGrace is how long, in seconds, the slot of a run lost by its node is held beyond the code timeout
+	InFlightGrace int64
+}
+
+// ActionLimitsConfig represents the size limits, in bytes, of the invocation sent to an action execution
+type ActionLimitsConfig struct {
+	MaxBodySize    int64
+	MaxParamsSize  int64
+	MaxHeadersSize int64
+}
+
+// WebhookConfig represents the delivery policy of the code run completion webhooks
+type WebhookConfig struct {
+	MaxAttempts    int
+	InitialBackoff int64 // Delay before the first retry in milliseconds, doubled on every retry
+	Timeout        int64 // Timeout of each delivery attempt in seconds
+}
+
+// CodeLibConfig represents the installation of the python libraries imported by the saved codes
+type CodeLibConfig struct {
+	// AutoInstall enqueues the installation of the unavailable libraries when a code is saved
+	AutoInstall bool
+	// AllowList is the comma separated libraries that can be installed automatically
+	AllowList string
+	// Node names this node in the installations of the libraries, the hostname by default
+	Node string
+	// SyncInterval is how often, in seconds, the node installs the libraries added on other nodes
+	SyncInterval int64
+}
+
+// SandboxConfig represents the isolation of the code action processes
+type SandboxConfig struct {
+	// Executor is "process" to run the engines as plain processes of the runner, or "sandbox"
+	// to run each one in its own namespaces, with a read-only root and a syscall filter
+	Executor string
+	// UID and GID are the host ids of the sandboxed processes when the runner is root
+	UID int
+	GID int
+	// TmpSize is the size of the private tmpfs of each sandboxed run, as the tmpfs size option
+	TmpSize string
+}
+
+// EgressConfig represents the proxy enforcing the project network policies on the code action processes
+type EgressConfig struct {
+	// Proxy starts the egress proxy and makes the engines connect through it. It requires the sandbox
+	// executor, plain processes could connect around it
+	Proxy bool
+	// Socket is the unix socket the sandboxed engines reach the proxy through, one of the runner by default
+	Socket string
+}
+
+// RuntimeConfig represents the local directories the runtimes keep what they prepare for the runs in
+type RuntimeConfig struct {
+	// ArtifactCacheDir keeps the compiled go actions and the python bytecode, up to ArtifactCacheSize bytes
+	ArtifactCacheDir  string
+	ArtifactCacheSize int64
+	// GoCacheDir is the build cache of the go toolchain
+	GoCacheDir string
+	// PythonVenvsDir keeps the virtualenvs of the project python requirements
+	PythonVenvsDir string
+	// PythonIndexURL is the package index the requirements are installed from, and PythonIndexDomains the
+	// comma separated domains the installation reaches through the egress proxy
+	PythonIndexURL     string
+	PythonIndexDomains string
+}
+
+// PythonPoolConfig represents the warm python workers forking the python code action runs
+type PythonPoolConfig struct {
+	Enabled bool
+	// Size is the number of workers of each interpreter
+	Size int
+	// MaxRuns is the number of runs a worker forks before it is replaced
+	MaxRuns int
+	// MaxMemory is the resident memory in bytes over which a worker is replaced
+	MaxMemory int64
+	// Interpreters is the number of interpreters, the system one and the project virtualenvs, kept warm
+	Interpreters int
+	// Preload is the comma separated modules the workers import before forking the runs
+	Preload string
 }
 
 type HTTPConfig struct {
@@ -68,11 +169,13 @@ type OIDCConfig struct {
 	Host        string
 }
 
-// ResourceConfig represents a resource configuration for each code execution in a project cgroup
+// ResourceConfig represents a resource configuration for each code execution in its own cgroup
 type ResourceConfig struct {
 	Enabled bool
 	CPU     CPUConfig
 	Memory  MemoryConfig
+	// CgroupParent is the cgroup the cgroups of the runs are created in
+	CgroupParent string
 }
 
 // CPUConfig represents a resource configuration for each code execution in a project cgroup related to cpu resource management
@@ -107,21 +210,29 @@ type S3Config struct {
 
 func NewConfig() *Config {
 	return &Config{
-		HTTP:            LoadHTTPConfig(),
-		DB:              LoadDBConfig(),
-		OIDC:            LoadOIDCConfig(),
-		AuthToken:       Getenv("FLOWS_CODE_ACTIONS_AUTH_TOKEN", ""),
-		Environment:     Getenv("FLOWS_CODE_ACTIONS_ENVIRONMENT", "local"),
-		LogLevel:        Getenv("FLOWS_CODE_ACTIONS_LOG_LEVEL", "debug"),
-		SentryDSN:       Getenv("FLOWS_CODE_ACTIONS_SENTRY_DSN", ""),
-		EDA:             LoadEDAConfig(),
-		Redis:           Getenv("FLOWS_CODE_ACTIONS_REDIS", "redis://localhost:6379/10"),
-		RateLimiterCode: LoadRateLimiterCodeConfig(),
-		Cleaner:         NewCleanerConfig(),
-		Blacklist:       Getenv("FLOWS_CODE_ACTIONS_BLACKLIST", ""),
-		Skiplist:        Getenv("FLOWS_CODE_ACTIONS_SKIPLIST", ""),
-		S3:              LoadS3Config(),
-		WorkerPool:      LoadWorkerPoolConfig(),
+		HTTP:             LoadHTTPConfig(),
+		DB:               LoadDBConfig(),
+		OIDC:             LoadOIDCConfig(),
+		AuthToken:        Getenv("FLOWS_CODE_ACTIONS_AUTH_TOKEN", ""),
+		Environment:      Getenv("FLOWS_CODE_ACTIONS_ENVIRONMENT", "local"),
+		LogLevel:         Getenv("FLOWS_CODE_ACTIONS_LOG_LEVEL", "debug"),
+		SentryDSN:        Getenv("FLOWS_CODE_ACTIONS_SENTRY_DSN", ""),
+		EDA:              LoadEDAConfig(),
+		Redis:            Getenv("FLOWS_CODE_ACTIONS_REDIS", "redis://localhost:6379/10"),
+		RateLimiterCode:  LoadRateLimiterCodeConfig(),
+		Cleaner:          NewCleanerConfig(),
+		Blacklist:        Getenv("FLOWS_CODE_ACTIONS_BLACKLIST", ""),
+		Skiplist:         Getenv("FLOWS_CODE_ACTIONS_SKIPLIST", ""),
+		S3:               LoadS3Config(),
+		WorkerPool:       LoadWorkerPoolConfig(),
+		ActionLimits:     LoadActionLimitsConfig(),
+		Webhook:          LoadWebhookConfig(),
+		CodeLib:          LoadCodeLibConfig(),
+		Sandbox:          LoadSandboxConfig(),
+		Egress:           LoadEgressConfig(),
+		PythonPool:       LoadPythonPoolConfig(),
+		Runtime:          LoadRuntimeConfig(),
+		SecretsMasterKey: Getenv("FLOWS_CODE_ACTIONS_SECRETS_MASTER_KEY", ""),
 
 		HealthCheckCacheTime: GetenvInt64("FLOWS_CODE_ACTIONS_HEALTH_CHECK_CACHE_TIME", 3),
 	}
@@ -162,9 +273,129 @@ func LoadWorkerPoolConfig() WorkerPoolConfig {
 		queueSize = 100
 	}
 
+	maxRedeliveries, err := strconv.Atoi(Getenv("FLOWS_CODE_ACTIONS_WORKER_POOL_MAX_REDELIVERIES", "3"))
+	if err != nil || maxRedeliveries < 0 {
+		maxRedeliveries = 3
+	}
+
 	return WorkerPoolConfig{
-		Workers:   workers,
-		QueueSize: queueSize,
+		Workers:         workers,
+		QueueSize:       queueSize,
+		Backend:         Getenv("FLOWS_CODE_ACTIONS_WORKER_POOL_BACKEND", "memory"),
+		QueueName:       Getenv("FLOWS_CODE_ACTIONS_WORKER_POOL_QUEUE_NAME", "code-actions.runs"),
+		MaxRedeliveries: maxRedeliveries,
+		ProjectWeights:  parseWeights(Getenv("FLOWS_CODE_ACTIONS_WORKER_POOL_PROJECT_WEIGHTS", "")),
+		StarvationAge:   GetenvInt64("FLOWS_CODE_ACTIONS_WORKER_POOL_STARVATION_AGE", 5),
+
+		MaxInFlightPerCode:    int(GetenvInt64("FLOWS_CODE_ACTIONS_MAX_INFLIGHT_PER_CODE", 0)),
+		MaxInFlightPerProject: int(GetenvInt64("FLOWS_CODE_ACTIONS_MAX_INFLIGHT_PER_PROJECT", 0)),
+		InFlightGrace:         GetenvInt64("FLOWS_CODE_ACTIONS_INFLIGHT_GRACE", 600),
+	}
+}
+
+// parseWeights parses comma separated key=weight pairs, skipping the invalid ones
+func parseWeights(value string) map[string]int {
+	weights := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		key, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w <= 0 {
+			continue
+		}
+		weights[strings.TrimSpace(key)] = w
+	}
+	return weights
+}
+
+func LoadActionLimitsConfig() ActionLimitsConfig {
+	return ActionLimitsConfig{
+		MaxBodySize:    GetenvInt64("FLOWS_CODE_ACTIONS_ACTION_MAX_BODY_SIZE", 1<<20),
+		MaxParamsSize:  GetenvInt64("FLOWS_CODE_ACTIONS_ACTION_MAX_PARAMS_SIZE", 16<<10),
+		MaxHeadersSize: GetenvInt64("FLOWS_CODE_ACTIONS_ACTION_MAX_HEADERS_SIZE", 32<<10),
+	}
+}
+
+func LoadWebhookConfig() WebhookConfig {
+	maxAttempts, err := strconv.Atoi(Getenv("FLOWS_CODE_ACTIONS_WEBHOOK_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	return WebhookConfig{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: GetenvInt64("FLOWS_CODE_ACTIONS_WEBHOOK_INITIAL_BACKOFF", 1000),
+		Timeout:        GetenvInt64("FLOWS_CODE_ACTIONS_WEBHOOK_TIMEOUT", 10),
+	}
+}
+
+func LoadCodeLibConfig() CodeLibConfig {
+	autoInstall, err := strconv.ParseBool(Getenv("FLOWS_CODE_ACTIONS_CODELIB_AUTO_INSTALL", "false"))
+	if err != nil {
+		autoInstall = false
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	syncInterval := GetenvInt64("FLOWS_CODE_ACTIONS_CODELIB_SYNC_INTERVAL", 60)
+	if syncInterval <= 0 {
+		syncInterval = 60
+	}
+	return CodeLibConfig{
+		AutoInstall:  autoInstall,
+		AllowList:    Getenv("FLOWS_CODE_ACTIONS_CODELIB_ALLOWLIST", ""),
+		Node:         Getenv("FLOWS_CODE_ACTIONS_NODE_NAME", hostname),
+		SyncInterval: syncInterval,
+	}
+}
+
+func LoadSandboxConfig() SandboxConfig {
+	return SandboxConfig{
+		Executor: Getenv("FLOWS_CODE_ACTIONS_EXECUTOR", "process"),
+		UID:      int(GetenvInt64("FLOWS_CODE_ACTIONS_SANDBOX_UID", 65534)),
+		GID:      int(GetenvInt64("FLOWS_CODE_ACTIONS_SANDBOX_GID", 65534)),
+		TmpSize:  Getenv("FLOWS_CODE_ACTIONS_SANDBOX_TMP_SIZE", "64m"),
+	}
+}
+
+func LoadEgressConfig() EgressConfig {
+	// only the sandbox enforces the proxy, so it is enabled by default with the sandbox executor alone
+	sandboxed := Getenv("FLOWS_CODE_ACTIONS_EXECUTOR", "process") == "sandbox"
+	proxy, err := strconv.ParseBool(Getenv("FLOWS_CODE_ACTIONS_EGRESS_PROXY", strconv.FormatBool(sandboxed)))
+	if err != nil {
+		proxy = sandboxed
+	}
+	return EgressConfig{
+		Proxy:  proxy,
+		Socket: Getenv("FLOWS_CODE_ACTIONS_EGRESS_PROXY_SOCKET", ""),
+	}
+}
+
+func LoadPythonPoolConfig() PythonPoolConfig {
+	enabled, err := strconv.ParseBool(Getenv("FLOWS_CODE_ACTIONS_PYTHON_POOL_ENABLED", "false"))
+	if err != nil {
+		enabled = false
+	}
+	return PythonPoolConfig{
+		Enabled:      enabled,
+		Size:         int(GetenvInt64("FLOWS_CODE_ACTIONS_PYTHON_POOL_SIZE", 2)),
+		MaxRuns:      int(GetenvInt64("FLOWS_CODE_ACTIONS_PYTHON_POOL_MAX_RUNS", 500)),
+		MaxMemory:    GetenvInt64("FLOWS_CODE_ACTIONS_PYTHON_POOL_MAX_MEMORY", 256*1024*1024),
+		Interpreters: int(GetenvInt64("FLOWS_CODE_ACTIONS_PYTHON_POOL_INTERPRETERS", 8)),
+		Preload:      Getenv("FLOWS_CODE_ACTIONS_PYTHON_PRELOAD", "requests,boto3,psycopg2"),
+	}
+}
+
+func LoadRuntimeConfig() RuntimeConfig {
+	return RuntimeConfig{
+		ArtifactCacheDir:   Getenv("FLOWS_CODE_ACTIONS_ARTIFACT_CACHE_DIR", filepath.Join(os.TempDir(), "codeactions-artifacts")),
+		ArtifactCacheSize:  GetenvInt64("FLOWS_CODE_ACTIONS_ARTIFACT_CACHE_SIZE", 1<<30),
+		GoCacheDir:         Getenv("FLOWS_CODE_ACTIONS_GO_CACHE_DIR", filepath.Join(os.TempDir(), "codeactions-go")),
+		PythonVenvsDir:     Getenv("FLOWS_CODE_ACTIONS_PYTHON_VENVS_DIR", filepath.Join(os.TempDir(), "codeactions-venvs")),
+		PythonIndexURL:     Getenv("FLOWS_CODE_ACTIONS_PYTHON_INDEX_URL", "https://pypi.org/simple"),
+		PythonIndexDomains: Getenv("FLOWS_CODE_ACTIONS_PYTHON_INDEX_DOMAINS", "pypi.org,files.pythonhosted.org"),
 	}
 }
 
@@ -332,9 +563,10 @@ func LoadResourcesConfig() ResourceConfig {
 		memory.Reservation = &memRes
 	}
 	return ResourceConfig{
-		Enabled: enabled,
-		CPU:     cpu,
-		Memory:  memory,
+		Enabled:      enabled,
+		CPU:          cpu,
+		Memory:       memory,
+		CgroupParent: Getenv("FLOWS_CODE_ACTIONS_CGROUP_PARENT", "/codeactions"),
 	}
 }
 
@@ -402,6 +634,29 @@ func (c *Config) GetBlackListTerms() []string {
 	return blackListTerms
 }
 
+// GetCodeLibAllowList returns the libraries that can be installed automatically, lower cased
+func (c *Config) GetCodeLibAllowList() []string {
+	var allowList []string
+	for _, lib := range strings.Split(c.CodeLib.AllowList, ",") {
+		if lib = strings.ToLower(strings.TrimSpace(lib)); lib != "" {
+			allowList = append(allowList, lib)
+		}
+	}
+	sort.Strings(allowList)
+	return allowList
+}
+
+// GetPythonIndexDomains returns the domains of the python package index, lower cased
+func (c *Config) GetPythonIndexDomains() []string {
+	var domains []string
+	for _, domain := range strings.Split(c.Runtime.PythonIndexDomains, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
 func (c *Config) GetSkipListTerms() []string {
 	var skipListTerms []string
 	skiplist := strings.Split(c.Skiplist, ",")
@@ -17,3 +17,21 @@ func TestBlackList(t *testing.T) {
 	assert.Equal(t, 4, len(blacklist))
 	assert.Equal(t, "bar", blacklist[0])
 }
+
+func TestParseWeights(t *testing.T) {
+	weights := parseWeights("project-a=3, project-b = 2,project-c=0,project-d,project-e=x")
+
+	assert.Equal(t, map[string]int{"project-a": 3, "project-b": 2}, weights)
+	assert.Empty(t, parseWeights(""))
+}
+
+func TestEgressProxyDefault(t *testing.T) {
+	t.Setenv("FLOWS_CODE_ACTIONS_EXECUTOR", "process")
+	assert.False(t, LoadEgressConfig().Proxy)
+
+	t.Setenv("FLOWS_CODE_ACTIONS_EXECUTOR", "sandbox")
+	assert.True(t, LoadEgressConfig().Proxy)
+
+	t.Setenv("FLOWS_CODE_ACTIONS_EGRESS_PROXY", "false")
+	assert.False(t, LoadEgressConfig().Proxy)
+}
@@ -1,4 +1,8 @@
 package actions
 
-func Run() {
+import "github.com/weni-ai/flows-code-actions/engines/go/engine"
+
+func Run(e *engine.Engine) {
+	e.Log.Info("go action started")
+	e.Result.Set(map[string]string{"message": "hello " + e.Params.Get("name")}, 200, "json")
 }
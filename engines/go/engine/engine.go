@@ -0,0 +1,191 @@
+// Package engine is the SDK exposed to Go code actions.
+//
+// A Go code action must be declared in the actions package and define a Run function
+// receiving the engine:
+//
+//	package actions
+//
+//	import "github.com/weni-ai/flows-code-actions/engines/go/engine"
+//
+//	func Run(e *engine.Engine) {
+//		name := e.Params.Get("name")
+//		e.Log.Info("running for " + name)
+//		e.Result.Set(map[string]string{"hello": name}, 200, "json")
+//	}
+//
+// The package only depends on the standard library so actions can be compiled without network access.
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	MessageTypeResult = "result"
+	MessageTypeLog    = "log"
+
+	// SecretEnvPrefix prefixes the secrets injected by the code runner in the environment
+	SecretEnvPrefix = "FLOWS_CODE_ACTIONS_SECRET_"
+)
+
+// Message is a record sent from the engine to the code runner through the output channel
+type Message struct {
+	Type string `json:"type"`
+
+	Result      string `json:"result,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+
+	LogType   string     `json:"log_type,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// channel writes messages as JSON lines to the code runner
+type channel struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newChannel(out io.Writer) *channel {
+	return &channel{enc: json.NewEncoder(out)}
+}
+
+func (c *channel) send(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(msg); err != nil {
+		fmt.Println("failed to send message to code runner:", err)
+	}
+}
+
+type Engine struct {
+	Params  Params
+	Body    string
+	Header  Header
+	Log     *Log
+	Result  *Result
+	Secrets Secrets
+}
+
+// New creates an engine that reports its result and logs to out
+func New(params map[string]interface{}, body string, header map[string][]string, out io.Writer) *Engine {
+	ch := newChannel(out)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if header == nil {
+		header = map[string][]string{}
+	}
+	return &Engine{
+		Params: Params(params),
+		Body:   body,
+		Header: Header(header),
+		Log:    &Log{ch: ch},
+		Result: &Result{ch: ch},
+	}
+}
+
+type Params map[string]interface{}
+
+// Get returns the param value as string, or an empty string if not set
+func (p Params) Get(key string) string {
+	if v, ok := p[key]; ok {
+		if s, isStr := v.(string); isStr {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Secrets reads the secrets of the project and code
+type Secrets struct{}
+
+// Get returns the secret value, or an empty string if not set
+func (Secrets) Get(name string) string {
+	return os.Getenv(SecretEnvPrefix + name)
+}
+
+type Header map[string][]string
+
+// Get returns the first value of the header, or an empty string if not set
+func (h Header) Get(key string) string {
+	if v, ok := h[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+type Result struct {
+	ch *channel
+
+	Value       string
+	StatusCode  int
+	ContentType string
+}
+
+// Set defines the action result. Values that are not strings are encoded as json.
+// A zero statusCode defaults to 200 and an empty contentType defaults to "text".
+func (r *Result) Set(value interface{}, statusCode int, contentType string) {
+	switch v := value.(type) {
+	case string:
+		r.Value = v
+	case []byte:
+		r.Value = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			r.Value = fmt.Sprint(v)
+		} else {
+			r.Value = string(b)
+		}
+	}
+	if statusCode == 0 {
+		statusCode = 200
+	}
+	if contentType == "" {
+		contentType = "text"
+	}
+	r.StatusCode = statusCode
+	r.ContentType = contentType
+
+	r.ch.send(Message{
+		Type:        MessageTypeResult,
+		Result:      r.Value,
+		StatusCode:  r.StatusCode,
+		ContentType: r.ContentType,
+	})
+}
+
+type Log struct {
+	ch *channel
+}
+
+func (l *Log) create(logType string, content interface{}) {
+	text, ok := content.(string)
+	if !ok {
+		text = fmt.Sprint(content)
+	}
+	now := time.Now().UTC()
+	l.ch.send(Message{
+		Type:      MessageTypeLog,
+		LogType:   logType,
+		Content:   text,
+		Timestamp: &now,
+	})
+}
+
+// Debug creates a debug log entry
+func (l *Log) Debug(content interface{}) { l.create("debug", content) }
+
+// Info creates an info log entry
+func (l *Log) Info(content interface{}) { l.create("info", content) }
+
+// Error creates an error log entry
+func (l *Log) Error(content interface{}) { l.create("error", content) }
@@ -1,35 +1,71 @@
 package main
 
 import (
-	"flag"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
+
+	"github.com/weni-ai/flows-code-actions/engines/go/actions"
+	"github.com/weni-ai/flows-code-actions/engines/go/engine"
 )
 
-type stringMapFlag map[string]string
+// outputFDEnv holds the file descriptor the code runner reads results and logs from
+const outputFDEnv = "FLOWS_CODE_ACTIONS_ENGINE_OUTPUT_FD"
 
-func (f *stringMapFlag) String() string {
-	return "map[string]string"
+// input is the invocation envelope sent by the code runner as a JSON document on stdin
+type input struct {
+	Params  map[string]interface{} `json:"params"`
+	Body    string                 `json:"body"`
+	Headers map[string][]string    `json:"headers"`
+	RunID   string                 `json:"run_id"`
+	CodeID  string                 `json:"code_id"`
 }
 
-func (f *stringMapFlag) Set(value string) error {
-	parts := strings.Split(value, "===")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid flag format: %s", value)
+// readInput reads the invocation envelope from r, accepting an empty document
+func readInput(r io.Reader) (input, error) {
+	in := input{}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return in, err
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return in, nil
 	}
-	(*f)[parts[0]] = parts[1]
-	return nil
+	err = json.Unmarshal(data, &in)
+	return in, err
 }
 
-var QueryParams = map[string]string{}
-
 func main() {
-	params := make(stringMapFlag)
-
-	flag.Var(&params, "arg", "Add an argument in the form of key=value")
-	flag.Parse()
+	in, err := readInput(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid input:", err)
+		os.Exit(1)
+	}
+	if in.Params == nil {
+		in.Params = map[string]interface{}{}
+	}
+	if in.Headers == nil {
+		in.Headers = map[string][]string{}
+	}
 
-	for k, v := range params {
-		fmt.Printf("%s=%s\n", k, v)
+	out := os.Stdout
+	if fd, err := strconv.Atoi(os.Getenv(outputFDEnv)); err == nil {
+		out = os.NewFile(uintptr(fd), "engine-output")
 	}
+
+	e := engine.New(in.Params, in.Body, in.Headers, out)
+	run(e)
+}
+
+func run(e *engine.Engine) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Error during action execution: %v\n", r)
+			e.Log.Error(fmt.Sprintf("Action execution failed: %v", r))
+		}
+	}()
+	actions.Run(e)
 }
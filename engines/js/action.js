@@ -0,0 +1,8 @@
+function Run(engine) {
+  engine.log.info("JS action started");
+
+  const name = engine.params.get("name") || "world";
+  engine.log.debug(`name param: ${name}`);
+
+  engine.result.set({ message: `hello ${name}` }, 200, "json");
+}
@@ -0,0 +1,200 @@
+const fs = require("fs");
+const path = require("path");
+const Module = require("module");
+
+// Prefix of the secrets in the environment, injected by the code runner
+const SECRET_ENV_PREFIX = "FLOWS_CODE_ACTIONS_SECRET_";
+
+// Output channel the code runner reads results and logs from, one JSON message per line
+const outputFD = parseInt(process.env.FLOWS_CODE_ACTIONS_ENGINE_OUTPUT_FD || "", 10);
+
+// sendMessage sends a message to the code runner through the output channel
+function sendMessage(message) {
+  const line = JSON.stringify(message) + "\n";
+  try {
+    if (Number.isNaN(outputFD)) {
+      process.stdout.write(line);
+    } else {
+      fs.writeSync(outputFD, line);
+    }
+  } catch (e) {
+    console.log(`Failed to send message to code runner: ${e.message}`);
+  }
+}
+
+class Params {
+  constructor(params = {}) {
+    this._params = params;
+  }
+  get(key) {
+    if (Object.prototype.hasOwnProperty.call(this._params, key)) {
+      return this._params[key];
+    }
+    return null;
+  }
+  items() {
+    return Object.entries(this._params);
+  }
+}
+
+class Result {
+  constructor() {
+    this._result = null;
+    this._extra = null;
+  }
+
+  set(value = "", statusCode = 200, contentType = "text") {
+    if (typeof value === "string") {
+      this._result = value;
+    } else {
+      try {
+        this._result = JSON.stringify(value);
+      } catch (e) {
+        this._result = String(value);
+      }
+    }
+
+    this._extra = { status_code: statusCode, content_type: contentType };
+    this.save();
+  }
+
+  // save sends the result to the code runner, which saves it on the code run
+  save() {
+    sendMessage({
+      type: "result",
+      result: this._result,
+      status_code: this._extra.status_code,
+      content_type: this._extra.content_type,
+    });
+  }
+}
+
+class Log {
+  constructor(runId = null, codeId = null) {
+    this._runId = runId;
+    this._codeId = codeId;
+  }
+
+  // _create streams a log entry to the code runner, which saves it on the configured codelog storage
+  _create(logtype = "", content = "") {
+    sendMessage({
+      type: "log",
+      log_type: logtype,
+      content: typeof content === "string" ? content : JSON.stringify(content),
+      timestamp: new Date().toISOString(),
+    });
+  }
+
+  debug(content = "") {
+    return this._create("debug", content);
+  }
+
+  info(content = "") {
+    return this._create("info", content);
+  }
+
+  error(content = "") {
+    return this._create("error", content);
+  }
+}
+
+class Header {
+  constructor(header = {}) {
+    this._header = header;
+  }
+  get(key) {
+    if (Object.prototype.hasOwnProperty.call(this._header, key)) {
+      const value = this._header[key];
+      return Array.isArray(value) ? value[0] : value;
+    }
+    return "";
+  }
+  items() {
+    return Object.entries(this._header);
+  }
+}
+
+// Secrets of the project and code, injected by the code runner as prefixed environment variables
+class Secrets {
+  get(name, defaultValue = undefined) {
+    const value = process.env[SECRET_ENV_PREFIX + name];
+    return value === undefined ? defaultValue : value;
+  }
+}
+
+class Request {
+  constructor({ params = new Params({}), body = "", log = new Log(), header = new Header({}) } = {}) {
+    this.header = header;
+    this.params = params;
+    this.body = body;
+    this.log = log;
+  }
+}
+
+class Engine {
+  constructor({ params, body, result, log, header, request, secrets = new Secrets() }) {
+    this.params = params;
+    this.body = body;
+    this.result = result;
+    this.log = log;
+    this.request = request;
+    this.header = header;
+    this.secrets = secrets;
+  }
+}
+
+// readInput reads the invocation envelope (params, body, headers, run_id, code_id)
+// sent as a JSON document on stdin.
+function readInput() {
+  const data = fs.readFileSync(0, "utf8");
+  if (!data.trim()) {
+    return {};
+  }
+  return JSON.parse(data);
+}
+
+// loadAction loads action.js, exporting a top level Run function when the
+// action doesn't export one explicitly.
+function loadAction(file) {
+  const source = fs.readFileSync(file, "utf8");
+  const actionModule = new Module(file, module);
+  actionModule.filename = file;
+  actionModule.paths = Module._nodeModulePaths(path.dirname(file));
+  actionModule._compile(
+    source +
+      '\n;if (typeof Run === "function" && typeof module.exports.Run !== "function") { module.exports.Run = Run; }\n',
+    file
+  );
+  return actionModule.exports;
+}
+
+async function main() {
+  const envelope = readInput();
+
+  const headerDict = envelope.headers || {};
+  const paramsDict = envelope.params || {};
+  const body = envelope.body || "";
+  const runId = envelope.run_id || "";
+  const codeId = envelope.code_id || "";
+
+  const header = new Header(headerDict);
+  const params = new Params(paramsDict);
+  const result = new Result();
+  const log = new Log(runId, codeId);
+  const request = new Request({ params, body, header });
+
+  const engine = new Engine({ params, body, result, log, header, request });
+
+  try {
+    const action = loadAction(path.join(__dirname, "action.js"));
+    if (typeof action.Run !== "function") {
+      throw new Error("action must define a Run(engine) function");
+    }
+    await action.Run(engine);
+  } catch (e) {
+    console.log(`Error during action execution: ${e.message}`);
+    log.error(`Action execution failed: ${e.message}`);
+  }
+}
+
+main();
@@ -0,0 +1,154 @@
+"""Warm python worker of the code runner.
+
+The worker imports the modules the actions commonly use once, then forks a child for every run the
+code runner sends on its control socket. Each child takes the stdio and the output channel of its run,
+and executes the engine main file of the run, which imports the action module from the run directory.
+Children wait on the gate of their run until the code runner moved them into the cgroup of the run, so
+no code of the action runs outside of it.
+"""
+import importlib
+import json
+import os
+import runpy
+import selectors
+import signal
+import socket
+import sys
+import traceback
+
+# control socket inherited from the code runner, jobs come with the fds of the run
+CONTROL_FD = int(os.environ.pop("FLOWS_CODE_ACTIONS_PYTHON_WORKER_FD", "3"))
+PRELOAD = os.environ.pop("FLOWS_CODE_ACTIONS_PYTHON_PRELOAD", "")
+# stdin, stdout, stderr, output channel, report socket and gate of the run
+JOB_FDS = 6
+MAX_JOB_SIZE = 1024 * 1024
+
+
+def preload():
+    for name in PRELOAD.split(","):
+        name = name.strip()
+        if not name:
+            continue
+        try:
+            importlib.import_module(name)
+        except Exception as e:
+            print(f"python worker: failed to preload {name}: {e}", file=sys.stderr)
+
+
+def run_job(job, fds, inherited):
+    """Runs in the forked child, never returns"""
+    code = 1
+    try:
+        signal.set_wakeup_fd(-1)
+        signal.signal(signal.SIGCHLD, signal.SIG_DFL)
+        for fd in inherited:
+            os.close(fd)
+        stdin, stdout, stderr, output, report, gate = fds
+        os.close(report)
+        # the code runner writes on the gate once the child is in the run cgroup, and closes it
+        # without writing when the run is cancelled
+        if not os.read(gate, 1):
+            os._exit(1)
+        os.close(gate)
+        for fd, target in ((stdin, 0), (stdout, 1), (stderr, 2), (output, 3)):
+            os.dup2(fd, target)
+        for fd in (stdin, stdout, stderr, output):
+            if fd > 3:
+                os.close(fd)
+
+        os.chdir(job["dir"])
+        os.environ.clear()
+        os.environ.update(kv.split("=", 1) for kv in job["env"] if "=" in kv)
+        sys.argv = [job["main"]]
+        sys.path.insert(0, os.path.dirname(os.path.abspath(job["main"])))
+        runpy.run_path(job["main"], run_name="__main__")
+        code = 0
+    except SystemExit as e:
+        if e.code is None:
+            code = 0
+        elif isinstance(e.code, int):
+            code = e.code
+        else:
+            print(e.code, file=sys.stderr)
+    except BaseException:
+        traceback.print_exc()
+    finally:
+        try:
+            sys.stdout.flush()
+            sys.stderr.flush()
+        finally:
+            os._exit(code)
+
+
+def send(sock, message):
+    try:
+        sock.sendall((json.dumps(message) + "\n").encode())
+    except OSError:
+        pass
+
+
+def main():
+    preload()
+    # the run output channel takes fd 3 in the children
+    control = socket.socket(fileno=os.dup(CONTROL_FD))
+    os.close(CONTROL_FD)
+    wakeup_r, wakeup_w = os.pipe()
+    os.set_blocking(wakeup_w, False)
+    signal.set_wakeup_fd(wakeup_w)
+    signal.signal(signal.SIGCHLD, lambda signum, frame: None)
+
+    selector = selectors.DefaultSelector()
+    selector.register(control, selectors.EVENT_READ)
+    selector.register(wakeup_r, selectors.EVENT_READ)
+    running = {}
+    accepting = True
+    send(control, {"ready": True})
+
+    while accepting or running:
+        for key, _ in selector.select():
+            if key.fileobj is control:
+                try:
+                    data, fds, _, _ = socket.recv_fds(control, MAX_JOB_SIZE, JOB_FDS)
+                except InterruptedError:
+                    continue
+                if not data:
+                    # the code runner retired the worker, it exits once its runs finish
+                    accepting = False
+                    selector.unregister(control)
+                    continue
+                if len(fds) != JOB_FDS:
+                    for fd in fds:
+                        os.close(fd)
+                    continue
+                job = json.loads(data)
+                sys.stdout.flush()
+                sys.stderr.flush()
+                inherited = [control.fileno(), wakeup_r, wakeup_w] + [s.fileno() for s in running.values()]
+                pid = os.fork()
+                if pid == 0:
+                    run_job(job, fds, inherited)
+                for fd in fds[:4] + fds[5:]:
+                    os.close(fd)
+                report = socket.socket(fileno=fds[4])
+                send(report, {"pid": pid})
+                running[pid] = report
+            else:
+                try:
+                    os.read(wakeup_r, 512)
+                except BlockingIOError:
+                    pass
+                while running:
+                    try:
+                        pid, status = os.waitpid(-1, os.WNOHANG)
+                    except ChildProcessError:
+                        break
+                    if pid == 0:
+                        break
+                    report = running.pop(pid, None)
+                    if report is not None:
+                        send(report, {"status": os.waitstatus_to_exitcode(status)})
+                        report.close()
+
+
+if __name__ == "__main__":
+    main()
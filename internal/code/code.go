@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/weni-ai/flows-code-actions/internal/coderunner"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
 )
 
 type CodeType string
@@ -28,6 +31,20 @@ type Code struct {
 	Language    LanguageType `bson:"language" json:"language"`
 	URL         string       `bson:"url" json:"url,omitempty"`
 	ProjectUUID string       `bson:"project_uuid" json:"project_uuid"`
+	CallbackURL string       `bson:"callback_url,omitempty" json:"callback_url,omitempty"` // receives the code runs when they finish
+	Version     int          `bson:"version,omitempty" json:"version,omitempty"`           // draft source revision, see codeversion
+	AllowEgress bool         `bson:"allow_egress" json:"allow_egress,omitempty"`           // sandboxed runs keep the network access
+	Lane        string       `bson:"lane,omitempty" json:"lane,omitempty"`                 // worker pool lane of the runs, see workerpool.Lane
+
+	// PublishedVersion and PublishedSource are the revision served by the code executions, while
+	// Source and Version hold the draft being edited. Publish promotes the draft
+	PublishedVersion int    `bson:"published_version,omitempty" json:"published_version,omitempty"`
+	PublishedSource  string `bson:"published_source,omitempty" json:"published_source,omitempty"`
+
+	// UnavailableLibs are the libraries imported by the saved source that are not installed, and
+	// InstallingLibs the ones among them queued for installation. They are not stored
+	UnavailableLibs []string `bson:"-" json:"unavailable_libs,omitempty"`
+	InstallingLibs  []string `bson:"-" json:"installing_libs,omitempty"`
 
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
@@ -35,12 +52,36 @@ type Code struct {
 	Timeout int `bson:"timeout" json:"timeout"`
 }
 
+// Patch holds the changes of a code update, the empty fields keep the current values
+type Patch struct {
+	Name    string
+	Source  string
+	Type    CodeType
+	Timeout int
+	// CallbackURL, AllowEgress and Lane are kept when nil. An empty callback URL removes it, and an empty
+	// lane returns the runs to the lane of the route
+	CallbackURL *string
+	AllowEgress *bool
+	Lane        *string
+}
+
 type UseCase interface {
 	Create(ctx context.Context, code *Code) (*Code, error)
 	GetByID(ctx context.Context, id string) (*Code, error)
 	ListProjectCodes(ctx context.Context, projectUUID string, codeType string) ([]Code, error)
-	Update(ctx context.Context, id string, name string, source string, codeType string, timeout int) (*Code, error)
+	Update(ctx context.Context, id string, patch Patch) (*Code, error)
 	Delete(ctx context.Context, codeID string) error
+	// ListVersions returns the source revisions of the code, newest first
+	ListVersions(ctx context.Context, codeID string) ([]codeversion.CodeVersion, error)
+	// VersionSource returns the source of a version of the code
+	VersionSource(ctx context.Context, codeID string, version int) (string, error)
+	// Rollback restores the source of a previous version as a new version of the code
+	Rollback(ctx context.Context, codeID string, version int) (*Code, error)
+	// Publish promotes the draft of the code to the published version, validating it again as the policy
+	// of the project may have changed since the draft was saved
+	Publish(ctx context.Context, codeID string) (*Code, error)
+	// Diagnose returns the problems found in a source without saving it
+	Diagnose(ctx context.Context, projectUUID string, language LanguageType, source string) (ValidationErrors, error)
 }
 
 func NewCodeAction(name, source string, language LanguageType, codeType CodeType, url string, projectUUID string) *Code {
@@ -75,19 +116,38 @@ func (t *CodeType) Validate() error {
 	return fmt.Errorf(`code type of (%s) is not valid`, string(*t))
 }
 
+// Validate checks that there is a runtime registered for the language
 func (lang *LanguageType) Validate() error {
-
-	switch *lang {
-	case TypePy:
-		return nil
-	case TypeJS:
-		return nil
-	case TypeGo:
+	if _, ok := coderunner.LookupRuntime(string(*lang)); ok {
 		return nil
 	}
 	return fmt.Errorf(`language type (%s) is not valid`, string(*lang))
 }
 
+// Key is the id the data of the code, like versions and secrets, is stored by: the PostgreSQL UUID,
+// or the MongoDB ObjectID when the code is stored on MongoDB
+func (c *Code) Key() string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return c.MongoObjectID
+}
+
+// Published returns the source and version served by the code executions. Codes saved before drafts
+// existed have no published version and serve their source
+func (c *Code) Published() (string, int) {
+	if c.PublishedVersion == 0 {
+		return c.Source, c.Version
+	}
+	return c.PublishedSource, c.PublishedVersion
+}
+
+// publish promotes the draft source to the published version
+func (c *Code) publish() {
+	c.PublishedVersion = c.Version
+	c.PublishedSource = c.Source
+}
+
 // SetTiemout set the timeout for the execution of the code, in seconds. Min 5, max 300, default is 60 seconds
 func (c *Code) SetTimeout(timeout int) {
 	c.Timeout = timeout
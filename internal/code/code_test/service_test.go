@@ -3,7 +3,6 @@ package code_test
 import (
 	"context"
 	"log"
-	"os"
 	"strings"
 	"testing"
 
@@ -13,12 +12,18 @@ import (
 	coderepos "github.com/weni-ai/flows-code-actions/internal/code/mongodb"
 	"github.com/weni-ai/flows-code-actions/internal/codelib"
 	librepos "github.com/weni-ai/flows-code-actions/internal/codelib/mongodb"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+	versionrepos "github.com/weni-ai/flows-code-actions/internal/codeversion/mongodb"
 	"github.com/weni-ai/flows-code-actions/internal/db"
+	"github.com/weni-ai/flows-code-actions/internal/project"
 )
 
-func TestCreateCodeWithBlackList(t *testing.T) {
-	os.Setenv("FLOWS_CODE_ACTIONS_BLACKLIST", "foo,bar,baz,qux")
+// deniedProjects denies foo, bar, baz and qux to the project of the tests
+var deniedProjects = fakeProjects{
+	"5e82df29-f731-4861-8836-1b047ce03506": {CodePolicy: project.CodePolicy{Deny: []string{"foo", "bar", "baz", "qux"}}},
+}
 
+func TestCreateCodeWithDeniedNames(t *testing.T) {
 	cfg := config.NewConfig()
 
 	db, err := db.GetMongoDatabase(cfg)
@@ -30,21 +35,21 @@ func TestCreateCodeWithBlackList(t *testing.T) {
 	libService := codelib.NewCodeLibService(libRepo)
 
 	repo := coderepos.NewCodeRepository(db)
-	codeService := code.NewCodeService(cfg, repo, libService)
+	codeService := code.NewCodeService(cfg, repo, libService, codeversion.NewCodeVersionService(versionrepos.NewCodeVersionRepository(db)), deniedProjects)
 
 	_, err = codeService.Create(context.TODO(), &code.Code{
 		Name:        "Test Code",
-		Source:      "foo bar baz qux",
+		Source:      "import foo\n\ndef Run(engine):\n    bar()\n",
 		Language:    code.TypePy,
 		Type:        code.TypeEndpoint,
 		URL:         "https://example.com",
 		ProjectUUID: "5e82df29-f731-4861-8836-1b047ce03506",
 	})
-	assert.Equal(t, err.Error(), "source code contains blacklisted term")
+	assert.Equal(t, err.Error(), "source code is invalid: line 1, column 1: import of foo is not allowed; line 4, column 5: call of bar is not allowed")
 
 	cd, err := codeService.Create(context.TODO(), &code.Code{
 		Name:        "Test Code",
-		Source:      "def Run(engine):\nprint('ahoy')",
+		Source:      "def Run(engine):\n    print('ahoy')",
 		Language:    code.TypePy,
 		Type:        code.TypeEndpoint,
 		URL:         "https://example.com",
@@ -56,9 +61,7 @@ func TestCreateCodeWithBlackList(t *testing.T) {
 
 }
 
-func TestUpdateCodelibWithBlackList(t *testing.T) {
-	os.Setenv("FLOWS_CODE_ACTIONS_BLACKLIST", "foo,bar,baz,qux")
-
+func TestUpdateCodelibWithDeniedNames(t *testing.T) {
 	cfg := config.NewConfig()
 
 	db, err := db.GetMongoDatabase(cfg)
@@ -70,23 +73,23 @@ func TestUpdateCodelibWithBlackList(t *testing.T) {
 	libService := codelib.NewCodeLibService(libRepo)
 
 	repo := coderepos.NewCodeRepository(db)
-	codeService := code.NewCodeService(cfg, repo, libService)
+	codeService := code.NewCodeService(cfg, repo, libService, codeversion.NewCodeVersionService(versionrepos.NewCodeVersionRepository(db)), deniedProjects)
 
 	cd, _ := codeService.Create(context.TODO(), &code.Code{
 		Name:        "Test Code",
-		Source:      "def Run(engine):\nprint('ahoy')",
+		Source:      "def Run(engine):\n    print('ahoy')",
 		Language:    code.TypePy,
 		Type:        code.TypeEndpoint,
 		URL:         "https://example.com",
 		ProjectUUID: "5e82df29-f731-4861-8836-1b047ce03506",
 	})
 
-	_, err = codeService.Update(context.TODO(), cd.ID, "Test Code", "foo bar baz qux", string(code.TypeEndpoint), 60)
+	_, err = codeService.Update(context.TODO(), cd.ID, code.Patch{Name: "Test Code", Source: "import qux", Type: code.TypeEndpoint, Timeout: 60})
 
-	assert.Equal(t, err.Error(), "source code contains blacklisted term")
+	assert.Equal(t, err.Error(), "source code is invalid: line 1, column 1: import of qux is not allowed")
 
 	id := cd.ID
-	cdu, err := codeService.Update(context.TODO(), id, "Test Code", "def Run(engine):\nprint('ahoy2')", string(code.TypeEndpoint), 60)
+	cdu, err := codeService.Update(context.TODO(), id, code.Patch{Name: "Test Code", Source: "def Run(engine):\n    print('ahoy2')", Type: code.TypeEndpoint, Timeout: 60})
 
 	assert.NoError(t, err)
 	assert.True(t, strings.Contains(cdu.Source, "ahoy2"))
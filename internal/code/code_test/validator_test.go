@@ -0,0 +1,253 @@
+package code_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/codelib"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+type fakeProjects map[string]project.Project
+
+func (f fakeProjects) CodePolicy(ctx context.Context, projectUUID string) (*project.CodePolicy, error) {
+	p := f[projectUUID]
+	return &p.CodePolicy, nil
+}
+
+func (f fakeProjects) PythonRequirements(ctx context.Context, projectUUID string) ([]string, error) {
+	return f[projectUUID].PythonRequirements, nil
+}
+
+func (f fakeProjects) EgressPolicy(ctx context.Context, projectUUID string) (*project.EgressPolicy, error) {
+	p := f[projectUUID]
+	return &p.EgressPolicy, nil
+}
+
+func TestValidatorChain(t *testing.T) {
+	chain := code.DefaultValidatorChain()
+	policy := code.NewPolicy(code.DefaultDeniedNames, nil)
+	ctx := context.TODO()
+
+	err := chain.Validate(ctx, "def Run(engine):\n    engine.result.set('ok')\n", code.TypePy, policy)
+	assert.NoError(t, err)
+
+	err = chain.Validate(ctx, "def Run(engine):\nprint(1)\n", code.TypePy, policy)
+	var problems code.ValidationErrors
+	assert.True(t, errors.As(err, &problems))
+	assert.Equal(t, "syntax", problems[0].Validator)
+	assert.Equal(t, 2, problems[0].Line)
+
+	source := "import os as o\n" +
+		"def Run(engine):\n" +
+		"    # eval and subprocess in comments are fine\n" +
+		"    getattr(__import__('o' + 's'), 'system')('ls')\n" +
+		"    o.system('ls')\n"
+	err = chain.Validate(ctx, source, code.TypePy, policy)
+	assert.True(t, errors.As(err, &problems))
+	assert.Equal(t, code.ValidationErrors{
+		{Validator: "policy", Message: "call of __import__ is not allowed", Line: 4, Column: 13},
+		{Validator: "policy", Message: "call of os.system is not allowed", Line: 5, Column: 5},
+	}, problems)
+
+	err = chain.Validate(ctx, "package actions\n\nfunc Run(e *engine.Engine) {\n", code.TypeGo, policy)
+	assert.True(t, errors.As(err, &problems))
+	assert.Equal(t, 3, problems[0].Line)
+
+	err = chain.Validate(ctx, "function Run(engine) {\n  engine.log.info(\n}\n", code.TypeJS, policy)
+	assert.True(t, errors.As(err, &problems))
+	assert.Equal(t, 3, problems[0].Line)
+}
+
+func TestPythonPolicyValidatorBypasses(t *testing.T) {
+	validator := &code.PythonPolicyValidator{}
+	policy := code.NewPolicy(code.DefaultDeniedNames, nil)
+	ctx := context.TODO()
+
+	cases := []struct {
+		source   string
+		problems code.ValidationErrors
+	}{
+		{
+			source: "import os\nf = os.system\nf('id')\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "access to os.system is not allowed", Line: 2, Column: 5},
+			},
+		},
+		{
+			source: "from os import *\nsystem('id')\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "import of os.* is not allowed", Line: 1, Column: 1},
+			},
+		},
+		{
+			source: "import os\ngetattr(os, 'sys' + 'tem')('id')\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "getattr with a computed name is not allowed", Line: 2, Column: 1},
+			},
+		},
+		{
+			source: "import os\nos.__dict__['sys' + 'tem']('id')\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "access to __dict__ is not allowed", Line: 2, Column: 1},
+			},
+		},
+		{
+			source: "import builtins\nbuiltins.exec('1')\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "import of builtins is not allowed", Line: 1, Column: 1},
+				{Validator: "policy", Message: "call of builtins.exec is not allowed", Line: 2, Column: 1},
+			},
+		},
+		{
+			source: "globals()['__bui' + 'ltins__']\n",
+			problems: code.ValidationErrors{
+				{Validator: "policy", Message: "call of globals is not allowed", Line: 1, Column: 1},
+			},
+		},
+		{
+			source:   "from math import *\nresult = getattr(engine, 'result')\n",
+			problems: code.ValidationErrors{},
+		},
+	}
+	for _, c := range cases {
+		problems, err := validator.Validate(ctx, c.source, code.TypePy, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, c.problems, problems, c.source)
+	}
+}
+
+func TestProjectCodePolicy(t *testing.T) {
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		nil,
+		codeversion.NewCodeVersionService(versions),
+		fakeProjects{
+			"allowed": {CodePolicy: project.CodePolicy{Allow: []string{"subprocess"}}},
+			"denied":  {CodePolicy: project.CodePolicy{Deny: []string{"requests"}}},
+		},
+	)
+	ctx := context.TODO()
+	source := "import subprocess\nimport requests\n"
+
+	_, err := codeService.Create(ctx, code.NewFlowCode("default", source, code.TypePy, "default"))
+	assert.EqualError(t, err, "source code is invalid: line 1, column 1: import of subprocess is not allowed")
+
+	_, err = codeService.Create(ctx, code.NewFlowCode("allowed", source, code.TypePy, "allowed"))
+	assert.NoError(t, err)
+
+	_, err = codeService.Create(ctx, code.NewFlowCode("denied", source, code.TypePy, "denied"))
+	assert.EqualError(t, err, "source code is invalid: line 1, column 1: import of subprocess is not allowed; line 2, column 1: import of requests is not allowed")
+}
+
+type fakeLibs struct {
+	codelib.UseCase
+	libs []codelib.CodeLib
+}
+
+func (f *fakeLibs) List(ctx context.Context, language *codelib.LanguageType) ([]codelib.CodeLib, error) {
+	return f.libs, nil
+}
+
+func (f *fakeLibs) Find(ctx context.Context, name string, language *codelib.LanguageType) (*codelib.CodeLib, error) {
+	for _, lib := range f.libs {
+		if lib.Name == name {
+			return &lib, nil
+		}
+	}
+	return nil, errors.New("codelib not found")
+}
+
+type fakeInstaller struct {
+	queued []string
+}
+
+func (f *fakeInstaller) Allowed(name string) bool { return name == "numpy" }
+
+func (f *fakeInstaller) Enqueue(name string) error {
+	f.queued = append(f.queued, name)
+	return nil
+}
+
+func TestSaveDetectsLibs(t *testing.T) {
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		&fakeLibs{libs: []codelib.CodeLib{{Name: "requests", Language: codelib.TypePy}, {Name: "PyYAML", Language: codelib.TypePy}}},
+		codeversion.NewCodeVersionService(versions),
+		fakeProjects{"project": {PythonRequirements: []string{"python-dateutil==2.9.0"}}},
+	)
+	installer := &fakeInstaller{}
+	codeService.SetLibInstaller(installer)
+	ctx := context.TODO()
+
+	// the libs and requirements are matched to the imports by the module they install
+	source := "import requests\nimport collections\nimport dateutil\nimport yaml\n\ndef Run(engine):\n    pass\n"
+	cd, err := codeService.Create(ctx, code.NewFlowCode("libs", source, code.TypePy, "project"))
+	assert.NoError(t, err)
+	assert.Empty(t, cd.UnavailableLibs)
+
+	source = "import requests\nimport numpy\nimport pandas\n\ndef Run(engine):\n    pass\n"
+	cd, err = codeService.Update(ctx, cd.ID, code.Patch{Source: source})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"numpy", "pandas"}, cd.UnavailableLibs)
+	assert.Equal(t, []string{"numpy"}, cd.InstallingLibs)
+	assert.Equal(t, []string{"numpy"}, installer.queued)
+}
+
+func TestDiagnose(t *testing.T) {
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		&fakeLibs{libs: []codelib.CodeLib{{Name: "requests", Language: codelib.TypePy}}},
+		codeversion.NewCodeVersionService(versions),
+		fakeProjects{"pinned": {PythonRequirements: []string{"python-dateutil==2.9.0"}}},
+	)
+	ctx := context.TODO()
+
+	problems, err := codeService.Diagnose(ctx, "pinned", code.TypePy, "import dateutil\n\ndef Run(engine):\n    pass\n")
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = codeService.Diagnose(ctx, "pinned", code.TypePy, "import python_dateutil\n\ndef Run(engine):\n    pass\n")
+	assert.NoError(t, err)
+	assert.Equal(t, code.ValidationErrors{
+		{Validator: "library", Message: "library python_dateutil is not installed", Line: 1, Column: 1},
+	}, problems)
+
+	problems, err = codeService.Diagnose(ctx, "project", code.TypePy, "import requests\nimport collections\n\ndef Run(engine):\n    pass\n")
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = codeService.Diagnose(ctx, "project", code.TypePy, "import requests\nimport numpy\nimport subprocess\n\ndef main():\n    pass\n")
+	assert.NoError(t, err)
+	assert.Equal(t, code.ValidationErrors{
+		{Validator: "entrypoint", Message: "missing Run(engine) entry point"},
+		{Validator: "library", Message: "library numpy is not installed", Line: 2, Column: 1},
+		{Validator: "policy", Message: "import of subprocess is not allowed", Line: 3, Column: 1},
+	}, problems)
+
+	problems, err = codeService.Diagnose(ctx, "project", code.TypePy, "def Run(engine)\n    pass\n")
+	assert.NoError(t, err)
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "syntax", problems[0].Validator)
+
+	problems, err = codeService.Diagnose(ctx, "project", code.TypeGo, "package main\n\nfunc Run() {}\n")
+	assert.NoError(t, err)
+	assert.Equal(t, code.ValidationErrors{
+		{Validator: "entrypoint", Message: "Run must receive the engine argument"},
+		{Validator: "entrypoint", Message: "package must be actions", Line: 1, Column: 1},
+	}, problems)
+
+	_, err = codeService.Diagnose(ctx, "project", "cobol", "")
+	assert.Error(t, err)
+}
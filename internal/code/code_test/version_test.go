@@ -0,0 +1,188 @@
+package code_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+type memoryCodeRepo struct {
+	code.Repository
+	codes    map[string]code.Code
+	versions *memoryVersionRepo
+}
+
+func (r *memoryCodeRepo) Create(ctx context.Context, c *code.Code) (*code.Code, error) {
+	c.ID = "code-1"
+	r.codes[c.ID] = *c
+	return c, nil
+}
+
+func (r *memoryCodeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
+	c, ok := r.codes[id]
+	if !ok {
+		return nil, errors.New("code not found")
+	}
+	return &c, nil
+}
+
+func (r *memoryCodeRepo) Update(ctx context.Context, id string, c *code.Code) (*code.Code, error) {
+	r.codes[id] = *c
+	return c, nil
+}
+
+func (r *memoryCodeRepo) UpdateVersion(ctx context.Context, id string, c *code.Code, cv *codeversion.CodeVersion) (*code.Code, error) {
+	c.Version = max(r.codes[id].Version, c.Version) + 1
+	cv.Version = c.Version
+	r.codes[id] = *c
+	_, err := r.versions.Create(ctx, cv)
+	return c, err
+}
+
+type memoryVersionRepo struct {
+	versions []codeversion.CodeVersion
+}
+
+func (r *memoryVersionRepo) Create(ctx context.Context, cv *codeversion.CodeVersion) (*codeversion.CodeVersion, error) {
+	r.versions = append(r.versions, *cv)
+	return cv, nil
+}
+
+func (r *memoryVersionRepo) Get(ctx context.Context, codeID string, version int) (*codeversion.CodeVersion, error) {
+	for _, cv := range r.versions {
+		if cv.CodeID == codeID && cv.Version == version {
+			return &cv, nil
+		}
+	}
+	return nil, codeversion.ErrNotFound
+}
+
+func (r *memoryVersionRepo) ListByCodeID(ctx context.Context, codeID string) ([]codeversion.CodeVersion, error) {
+	return r.versions, nil
+}
+
+func (r *memoryVersionRepo) DeleteByCodeID(ctx context.Context, codeID string) error {
+	r.versions = nil
+	return nil
+}
+
+func TestCodeVersions(t *testing.T) {
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		nil,
+		codeversion.NewCodeVersionService(versions),
+		nil,
+	)
+	ctx := context.TODO()
+
+	cd, err := codeService.Create(ctx, code.NewFlowCode("versioned", "print(1)", code.TypePy, "project-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cd.Version)
+
+	cd, err = codeService.Update(ctx, cd.ID, code.Patch{Source: "print(2)"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cd.Version)
+
+	cd, err = codeService.Update(ctx, cd.ID, code.Patch{Name: "renamed"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cd.Version)
+
+	cd, err = codeService.Rollback(ctx, cd.ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cd.Version)
+	assert.Equal(t, "print(1)", cd.Source)
+
+	assert.Len(t, versions.versions, 3)
+	assert.Equal(t, 1, versions.versions[2].RollbackOf)
+
+	_, err = codeService.Rollback(ctx, cd.ID, 9)
+	assert.ErrorIs(t, err, codeversion.ErrNotFound)
+}
+
+func TestCodePublish(t *testing.T) {
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		nil,
+		codeversion.NewCodeVersionService(versions),
+		nil,
+	)
+	ctx := context.TODO()
+
+	cd, err := codeService.Create(ctx, code.NewFlowCode("drafted", "print(1)", code.TypePy, "project-1"))
+	assert.NoError(t, err)
+	source, version := cd.Published()
+	assert.Equal(t, "print(1)", source)
+	assert.Equal(t, 1, version)
+
+	cd, err = codeService.Update(ctx, cd.ID, code.Patch{Source: "print(2)"})
+	assert.NoError(t, err)
+	source, version = cd.Published()
+	assert.Equal(t, "print(1)", source)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, "print(2)", cd.Source)
+
+	cd, err = codeService.Publish(ctx, cd.ID)
+	assert.NoError(t, err)
+	source, version = cd.Published()
+	assert.Equal(t, "print(2)", source)
+	assert.Equal(t, 2, version)
+}
+
+func TestCodePublishedBeforeDrafts(t *testing.T) {
+	legacy := code.Code{ID: "legacy", Name: "legacy", Source: "print(1)", Language: code.TypePy, Type: code.TypeFlow}
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{"legacy": legacy}, versions: versions},
+		nil,
+		codeversion.NewCodeVersionService(versions),
+		nil,
+	)
+
+	cd, err := codeService.Update(context.TODO(), "legacy", code.Patch{Source: "print(2)"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cd.Version)
+	source, version := cd.Published()
+	assert.Equal(t, "print(1)", source)
+	assert.Equal(t, 1, version)
+	assert.Len(t, versions.versions, 2)
+}
+
+func TestCodePublishValidatesDraft(t *testing.T) {
+	projects := fakeProjects{}
+	versions := &memoryVersionRepo{}
+	codeService := code.NewCodeService(
+		config.NewConfig(),
+		&memoryCodeRepo{codes: map[string]code.Code{}, versions: versions},
+		nil,
+		codeversion.NewCodeVersionService(versions),
+		projects,
+	)
+	ctx := context.TODO()
+
+	cd, err := codeService.Create(ctx, code.NewFlowCode("drafted", "print(1)", code.TypePy, "project-1"))
+	assert.NoError(t, err)
+	cd, err = codeService.Update(ctx, cd.ID, code.Patch{Source: "import json\nprint(json.dumps(2))"})
+	assert.NoError(t, err)
+
+	// the policy of the project changed after the draft was saved
+	projects["project-1"] = project.Project{CodePolicy: project.CodePolicy{Deny: []string{"json"}}}
+	_, err = codeService.Publish(ctx, cd.ID)
+	var problems code.ValidationErrors
+	assert.True(t, errors.As(err, &problems))
+
+	cd, err = codeService.GetByID(ctx, cd.ID)
+	assert.NoError(t, err)
+	source, _ := cd.Published()
+	assert.Equal(t, "print(1)", source)
+}
@@ -0,0 +1,92 @@
+package code
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/codelib"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+// LibInstaller installs the unavailable libraries imported by the saved codes, when they are allowed
+type LibInstaller interface {
+	Allowed(name string) bool
+	Enqueue(name string) error
+}
+
+// SetLibInstaller enables the installation of the allowed libraries imported by the saved codes
+func (s *Service) SetLibInstaller(installer LibInstaller) {
+	s.installer = installer
+}
+
+// detectLibs sets the third-party libraries imported by the python source of the code that are neither
+// code libs nor project requirements as unavailable, queueing the installation of the allowed ones
+func (s *Service) detectLibs(ctx context.Context, code *Code) error {
+	if code.Language != TypePy || s.libService == nil {
+		return nil
+	}
+	imported := codelib.ExtractPythonLibs(code.Source)
+	if len(imported) == 0 {
+		return nil
+	}
+
+	var requirements []string
+	if s.projects != nil {
+		var err error
+		if requirements, err = s.projects.PythonRequirements(ctx, code.ProjectUUID); err != nil {
+			return errors.Wrap(err, "error on getting project python requirements")
+		}
+	}
+	lang := codelib.TypePy
+	libs, err := s.libService.List(ctx, &lang)
+	if err != nil {
+		return errors.Wrap(err, "error on listing code libs")
+	}
+	modules := libModules(libs)
+	required := requirementModules(requirements)
+
+	stdlib := pythonStdlibModules()
+	for _, name := range imported {
+		if stdlib[name] || required[name] {
+			continue
+		}
+		lib, found := modules[name]
+		if found && lib.Installed() {
+			continue
+		}
+		code.UnavailableLibs = append(code.UnavailableLibs, name)
+		if found && lib.Status == codelib.StatusPending {
+			code.InstallingLibs = append(code.InstallingLibs, name)
+			continue
+		}
+		if s.installer == nil || !s.installer.Allowed(name) {
+			continue
+		}
+		if err := s.installer.Enqueue(name); err != nil {
+			log.WithError(err).WithField("lib", name).Warn("error on queueing code lib installation")
+			continue
+		}
+		code.InstallingLibs = append(code.InstallingLibs, name)
+	}
+	return nil
+}
+
+// libModules indexes the code libs by the python module they install, as they are named by their module
+// or by their distribution
+func libModules(libs []codelib.CodeLib) map[string]*codelib.CodeLib {
+	modules := map[string]*codelib.CodeLib{}
+	for i := range libs {
+		modules[codelib.Module(libs[i].Name)] = &libs[i]
+	}
+	return modules
+}
+
+// requirementModules returns the python modules installed by the project requirements
+func requirementModules(requirements []string) map[string]bool {
+	modules := map[string]bool{}
+	for _, req := range requirements {
+		modules[codelib.Module(project.RequirementName(req))] = true
+	}
+	return modules
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -92,6 +93,59 @@ func (r *codeRepo) Update(ctx context.Context, id string, codeAction *code.Code)
 	return codeAction, err
 }
 
+// UpdateVersion requires a replica set, which MongoDB transactions run on. A concurrent update of the
+// code is a write conflict, retried by the transaction
+func (r *codeRepo) UpdateVersion(ctx context.Context, id string, codeAction *code.Code, cv *codeversion.CodeVersion) (*code.Code, error) {
+	codeID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on parse id to ObjectID")
+	}
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting code version session")
+	}
+	defer session.EndSession(ctx)
+
+	versions := r.collection.Database().Collection("code_version")
+	expected := codeAction.Version
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		stored := &code.Code{}
+		if err := r.collection.FindOne(sc, bson.M{"_id": codeID}).Decode(stored); err != nil {
+			return nil, err
+		}
+		codeAction.Version = max(stored.Version, expected) + 1
+		codeAction.UpdatedAt = time.Now()
+		// the version of the codes saved before versioning is missing
+		version := interface{}(stored.Version)
+		if stored.Version == 0 {
+			version = bson.M{"$in": bson.A{0, nil}}
+		}
+		result, err := r.collection.UpdateOne(sc, bson.M{"_id": codeID, "version": version}, bson.M{"$set": codeAction})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errors.New("code changed while updating its version")
+		}
+
+		cv.Version = codeAction.Version
+		cv.CreatedAt = codeAction.UpdatedAt
+		inserted, err := versions.InsertOne(sc, cv)
+		if err != nil {
+			return nil, err
+		}
+		if oid, ok := inserted.InsertedID.(primitive.ObjectID); ok {
+			cv.ID = oid.Hex()
+			cv.MongoObjectID = oid.Hex()
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error updating code version")
+	}
+	return codeAction, nil
+}
+
 func (r *codeRepo) Delete(ctx context.Context, id string) error {
 	codeID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
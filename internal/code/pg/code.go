@@ -7,6 +7,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
 	"github.com/weni-ai/flows-code-actions/internal/util"
 
 	_ "github.com/lib/pq"
@@ -23,8 +24,8 @@ func NewCodeRepository(db *sql.DB) code.Repository {
 
 func (r *codeRepo) Create(ctx context.Context, codeAction *code.Code) (*code.Code, error) {
 	query := `
-		INSERT INTO codes (mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) 
+		INSERT INTO codes (mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at, callback_url, version, published_version, published_source, allow_egress, lane) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) 
 		RETURNING id`
 
 	codeAction.CreatedAt = time.Now()
@@ -42,6 +43,12 @@ func (r *codeRepo) Create(ctx context.Context, codeAction *code.Code) (*code.Cod
 		codeAction.Timeout,
 		codeAction.CreatedAt,
 		codeAction.UpdatedAt,
+		nullString(codeAction.CallbackURL),
+		codeAction.Version,
+		nullInt(codeAction.PublishedVersion),
+		nullString(codeAction.PublishedSource),
+		codeAction.AllowEgress,
+		nullString(codeAction.Lane),
 	).Scan(&id)
 
 	if err != nil {
@@ -55,7 +62,7 @@ func (r *codeRepo) Create(ctx context.Context, codeAction *code.Code) (*code.Cod
 func (r *codeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
 	// Try to find by UUID first, then by mongo_object_id
 	query := `
-		SELECT id, mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at 
+		SELECT id, mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at, callback_url, version, published_version, published_source, allow_egress, lane 
 		FROM codes 
 		WHERE `
 
@@ -68,6 +75,10 @@ func (r *codeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
 	codeAction := &code.Code{}
 	var mongoObjectID sql.NullString
 	var url sql.NullString
+	var callbackURL sql.NullString
+	var publishedVersion sql.NullInt64
+	var publishedSource sql.NullString
+	var lane sql.NullString
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&codeAction.ID,
@@ -81,6 +92,12 @@ func (r *codeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
 		&codeAction.Timeout,
 		&codeAction.CreatedAt,
 		&codeAction.UpdatedAt,
+		&callbackURL,
+		&codeAction.Version,
+		&publishedVersion,
+		&publishedSource,
+		&codeAction.AllowEgress,
+		&lane,
 	)
 
 	if err != nil {
@@ -96,6 +113,12 @@ func (r *codeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
 	if url.Valid {
 		codeAction.URL = url.String
 	}
+	if callbackURL.Valid {
+		codeAction.CallbackURL = callbackURL.String
+	}
+	codeAction.PublishedVersion = int(publishedVersion.Int64)
+	codeAction.PublishedSource = publishedSource.String
+	codeAction.Lane = lane.String
 
 	// Set default timeout if not set
 	if codeAction.Timeout == 0 {
@@ -107,7 +130,7 @@ func (r *codeRepo) GetByID(ctx context.Context, id string) (*code.Code, error) {
 
 func (r *codeRepo) ListByProjectUUID(ctx context.Context, projectUUID string, codeType string) ([]code.Code, error) {
 	query := `
-		SELECT id, mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at 
+		SELECT id, mongo_object_id, name, type, source, language, url, project_uuid, timeout, created_at, updated_at, callback_url, version, published_version, published_source, allow_egress, lane 
 		FROM codes 
 		WHERE project_uuid = $1`
 
@@ -136,6 +159,10 @@ func (r *codeRepo) ListByProjectUUID(ctx context.Context, projectUUID string, co
 		var c code.Code
 		var mongoObjectID sql.NullString
 		var url sql.NullString
+		var callbackURL sql.NullString
+		var publishedVersion sql.NullInt64
+		var publishedSource sql.NullString
+		var lane sql.NullString
 
 		err := rows.Scan(
 			&c.ID,
@@ -149,6 +176,12 @@ func (r *codeRepo) ListByProjectUUID(ctx context.Context, projectUUID string, co
 			&c.Timeout,
 			&c.CreatedAt,
 			&c.UpdatedAt,
+			&callbackURL,
+			&c.Version,
+			&publishedVersion,
+			&publishedSource,
+			&c.AllowEgress,
+			&lane,
 		)
 		if err != nil {
 			return nil, errors.Wrap(err, "error scanning code row")
@@ -160,6 +193,12 @@ func (r *codeRepo) ListByProjectUUID(ctx context.Context, projectUUID string, co
 		if url.Valid {
 			c.URL = url.String
 		}
+		if callbackURL.Valid {
+			c.CallbackURL = callbackURL.String
+		}
+		c.PublishedVersion = int(publishedVersion.Int64)
+		c.PublishedSource = publishedSource.String
+		c.Lane = lane.String
 
 		// Set default timeout if not set
 		if c.Timeout == 0 {
@@ -180,7 +219,8 @@ func (r *codeRepo) Update(ctx context.Context, id string, codeAction *code.Code)
 	query := `
 		UPDATE codes 
 		SET name = $2, type = $3, source = $4, language = $5, url = $6, 
-		    project_uuid = $7, timeout = $8, updated_at = $9, mongo_object_id = $10
+		    project_uuid = $7, timeout = $8, updated_at = $9, mongo_object_id = $10, callback_url = $11, version = $12,
+		    published_version = $13, published_source = $14, allow_egress = $15, lane = $16
 		WHERE id::text = $1 OR mongo_object_id = $1
 		RETURNING id`
 
@@ -198,6 +238,12 @@ func (r *codeRepo) Update(ctx context.Context, id string, codeAction *code.Code)
 		codeAction.Timeout,
 		codeAction.UpdatedAt,
 		nullString(codeAction.MongoObjectID),
+		nullString(codeAction.CallbackURL),
+		codeAction.Version,
+		nullInt(codeAction.PublishedVersion),
+		nullString(codeAction.PublishedSource),
+		codeAction.AllowEgress,
+		nullString(codeAction.Lane),
 	).Scan(&returnedID)
 
 	if err != nil {
@@ -211,6 +257,76 @@ func (r *codeRepo) Update(ctx context.Context, id string, codeAction *code.Code)
 	return codeAction, nil
 }
 
+func (r *codeRepo) UpdateVersion(ctx context.Context, id string, codeAction *code.Code, cv *codeversion.CodeVersion) (*code.Code, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting code version transaction")
+	}
+	defer tx.Rollback()
+
+	// the row lock taken by the update serializes the concurrent updates of the code
+	query := `
+		UPDATE codes 
+		SET name = $2, type = $3, source = $4, language = $5, url = $6, 
+		    project_uuid = $7, timeout = $8, updated_at = $9, mongo_object_id = $10, callback_url = $11,
+		    version = GREATEST(version, $12) + 1,
+		    published_version = $13, published_source = $14, allow_egress = $15, lane = $16
+		WHERE id::text = $1 OR mongo_object_id = $1
+		RETURNING id, version`
+
+	codeAction.UpdatedAt = time.Now()
+
+	var returnedID string
+	var version int
+	err = tx.QueryRowContext(ctx, query,
+		id,
+		codeAction.Name,
+		codeAction.Type,
+		codeAction.Source,
+		codeAction.Language,
+		nullString(codeAction.URL),
+		codeAction.ProjectUUID,
+		codeAction.Timeout,
+		codeAction.UpdatedAt,
+		nullString(codeAction.MongoObjectID),
+		nullString(codeAction.CallbackURL),
+		codeAction.Version,
+		nullInt(codeAction.PublishedVersion),
+		nullString(codeAction.PublishedSource),
+		codeAction.AllowEgress,
+		nullString(codeAction.Lane),
+	).Scan(&returnedID, &version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("code not found")
+		}
+		return nil, errors.Wrap(err, "error updating code")
+	}
+
+	cv.Version = version
+	cv.CreatedAt = codeAction.UpdatedAt
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO code_versions (code_id, version, source, rollback_of, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		cv.CodeID,
+		cv.Version,
+		cv.Source,
+		nullInt(cv.RollbackOf),
+		cv.CreatedAt,
+	).Scan(&cv.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating code version")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "error committing code version")
+	}
+	codeAction.ID = returnedID
+	codeAction.Version = version
+	return codeAction, nil
+}
+
 func (r *codeRepo) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM codes WHERE id::text = $1 OR mongo_object_id = $1`
 
@@ -238,3 +354,11 @@ func nullString(s string) sql.NullString {
 	}
 	return sql.NullString{String: s, Valid: true}
 }
+
+// nullInt converts a zero int to a NULL value
+func nullInt(i int) sql.NullInt64 {
+	if i == 0 {
+		return sql.NullInt64{Valid: false}
+	}
+	return sql.NullInt64{Int64: int64(i), Valid: true}
+}
@@ -9,10 +9,16 @@ CREATE TABLE IF NOT EXISTS codes (
     name VARCHAR(255) NOT NULL,
     type VARCHAR(50) NOT NULL CHECK (type IN ('flow', 'endpoint')),
     source TEXT NOT NULL,
-    language VARCHAR(50) NOT NULL CHECK (language IN ('python', 'go', 'javascript')),
+    language VARCHAR(50) NOT NULL,
     url VARCHAR(512),
     project_uuid VARCHAR(255) NOT NULL,
     timeout INTEGER NOT NULL DEFAULT 60 CHECK (timeout >= 5 AND timeout <= 300),
+    callback_url VARCHAR(2048),
+    version INTEGER NOT NULL DEFAULT 1,
+    published_version INTEGER,
+    published_source TEXT,
+    allow_egress BOOLEAN NOT NULL DEFAULT FALSE,
+    lane VARCHAR(20),
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
@@ -28,3 +34,9 @@ CREATE INDEX IF NOT EXISTS idx_codes_created_at ON codes(created_at);
 COMMENT ON TABLE codes IS 'Stores code actions (flows and endpoints) with their metadata';
 COMMENT ON COLUMN codes.id IS 'Primary key (PostgreSQL native UUID)';
 COMMENT ON COLUMN codes.mongo_object_id IS 'MongoDB ObjectID for backward compatibility';
+COMMENT ON COLUMN codes.language IS 'Language of a runtime registered in the coderunner, validated by the application';
+COMMENT ON COLUMN codes.version IS 'Draft source revision, stored on code_versions';
+COMMENT ON COLUMN codes.published_version IS 'Source revision served by the executions';
+COMMENT ON COLUMN codes.published_source IS 'Source of the published revision';
+COMMENT ON COLUMN codes.allow_egress IS 'Keeps the network of the runs of the code when they are sandboxed';
+COMMENT ON COLUMN codes.lane IS 'Worker pool lane of the runs of the code, the lane of the route when null';
@@ -1,11 +1,19 @@
 package code
 
-import "context"
+import (
+	"context"
+
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+)
 
 type Repository interface {
 	Create(context.Context, *Code) (*Code, error)
 	GetByID(context.Context, string) (*Code, error)
 	ListByProjectUUID(context.Context, string, string) ([]Code, error)
 	Update(context.Context, string, *Code) (*Code, error)
+	// UpdateVersion saves the code as its next version together with the version record, in one transaction.
+	// The next version is one above the stored version, or above the version of the code when it is greater,
+	// so concurrent updates get consecutive versions. The code and the record get the new version
+	UpdateVersion(context.Context, string, *Code, *codeversion.CodeVersion) (*Code, error)
 	Delete(context.Context, string) error
 }
@@ -2,40 +2,65 @@ package code
 
 import (
 	"context"
-	"strings"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/weni-ai/flows-code-actions/config"
 	"github.com/weni-ai/flows-code-actions/internal/codelib"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+	"github.com/weni-ai/flows-code-actions/internal/project"
 )
 
 const maxSourecBytes = 1024 * 1024
 
+// ProjectSettings returns the settings of the projects the codes depend on
+type ProjectSettings interface {
+	CodePolicy(ctx context.Context, projectUUID string) (*project.CodePolicy, error)
+	PythonRequirements(ctx context.Context, projectUUID string) ([]string, error)
+	EgressPolicy(ctx context.Context, projectUUID string) (*project.EgressPolicy, error)
+}
+
 type Service struct {
 	repo       Repository
 	libService codelib.UseCase
+	versions   codeversion.UseCase
+	projects   ProjectSettings
+	installer  LibInstaller
+	validators *ValidatorChain
 	conf       *config.Config
 }
 
-func NewCodeService(conf *config.Config, repo Repository, libService codelib.UseCase) *Service {
-	return &Service{conf: conf, repo: repo, libService: libService}
+func NewCodeService(conf *config.Config, repo Repository, libService codelib.UseCase, versions codeversion.UseCase, projects ProjectSettings) *Service {
+	return &Service{
+		conf:       conf,
+		repo:       repo,
+		libService: libService,
+		versions:   versions,
+		projects:   projects,
+		validators: DefaultValidatorChain(),
+	}
 }
 
 func (s *Service) Create(ctx context.Context, code *Code) (*Code, error) {
-	if len(code.Source) >= maxSourecBytes {
-		return nil, errors.New("source code is too big")
-	}
-
-	blacklist := s.conf.GetBlackListTerms()
-	for _, term := range blacklist {
-		if strings.Contains(code.Source, term) {
-			return nil, errors.New("source code contains blacklisted term")
-		}
+	if err := s.Validate(ctx, code.ProjectUUID, code.Language, code.Source); err != nil {
+		return nil, err
 	}
 
 	code.SetTimeout(code.Timeout)
+	code.Version = 1
+	code.publish()
 
-	return s.repo.Create(ctx, code)
+	newCode, err := s.repo.Create(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.versions.Create(ctx, codeversion.NewCodeVersion(newCode.Key(), newCode.Version, newCode.Source)); err != nil {
+		return nil, errors.Wrap(err, "error on creating code version")
+	}
+	if err := s.detectLibs(ctx, newCode); err != nil {
+		log.WithError(err).Warn("error on detecting code libs")
+	}
+	return newCode, nil
 }
 
 func (s *Service) GetByID(ctx context.Context, id string) (*Code, error) {
@@ -46,15 +71,13 @@ func (s *Service) ListProjectCodes(ctx context.Context, projectUUID string, code
 	return s.repo.ListByProjectUUID(ctx, projectUUID, codeType)
 }
 
-func (s *Service) Update(ctx context.Context, id string, name string, source string, codeType string, timeout int) (*Code, error) {
-	if len(source) >= maxSourecBytes {
+func (s *Service) Update(ctx context.Context, id string, patch Patch) (*Code, error) {
+	if len(patch.Source) >= maxSourecBytes {
 		return nil, errors.New("source code is too big")
 	}
-
-	blacklist := s.conf.GetBlackListTerms()
-	for _, term := range blacklist {
-		if strings.Contains(source, term) {
-			return nil, errors.New("source code contains blacklisted term")
+	if patch.Type != "" {
+		if err := patch.Type.Validate(); err != nil {
+			return nil, err
 		}
 	}
 
@@ -62,33 +85,234 @@ func (s *Service) Update(ctx context.Context, id string, name string, source str
 	if err != nil {
 		return nil, err
 	}
-	if name != "" {
-		code.Name = name
+	if patch.Source != "" && patch.Source != code.Source {
+		if err := s.Validate(ctx, code.ProjectUUID, code.Language, patch.Source); err != nil {
+			return nil, err
+		}
+	}
+	if patch.Name != "" {
+		code.Name = patch.Name
+	}
+	previousSource := code.Source
+	if patch.Source != "" {
+		code.Source = patch.Source
+	}
+	if patch.Type != "" {
+		code.Type = patch.Type
+	}
+	if patch.Timeout > 0 {
+		code.SetTimeout(patch.Timeout)
 	}
-	if source != "" {
-		code.Source = source
+	if patch.CallbackURL != nil {
+		code.CallbackURL = *patch.CallbackURL
+	}
+	if patch.AllowEgress != nil {
+		code.AllowEgress = *patch.AllowEgress
+	}
+	if patch.Lane != nil {
+		code.Lane = *patch.Lane
 	}
 
-	if codeType != "" {
-		t := CodeType(codeType)
-		if err := t.Validate(); err != nil {
-			return nil, err
+	if code.Source == previousSource {
+		return s.repo.Update(ctx, id, code)
+	}
+	updated, err := s.updateVersion(ctx, id, code, previousSource, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.detectLibs(ctx, updated); err != nil {
+		log.WithError(err).Warn("error on detecting code libs")
+	}
+	return updated, nil
+}
+
+// Validate checks the source against the validator chain, with the policy of the project
+func (s *Service) Validate(ctx context.Context, projectUUID string, language LanguageType, source string) error {
+	if len(source) >= maxSourecBytes {
+		return errors.New("source code is too big")
+	}
+	policy, err := s.policy(ctx, projectUUID)
+	if err != nil {
+		return err
+	}
+	return s.validators.Validate(ctx, source, language, policy)
+}
+
+// Diagnose reports all the problems of the source instead of stopping at the first validator finding
+// some, adding the missing entry point and libraries. Only syntax errors hide the other problems
+func (s *Service) Diagnose(ctx context.Context, projectUUID string, language LanguageType, source string) (ValidationErrors, error) {
+	if err := language.Validate(); err != nil {
+		return nil, err
+	}
+	if len(source) >= maxSourecBytes {
+		return ValidationErrors{{Validator: "size", Message: "source code is too big"}}, nil
+	}
+	policy, err := s.policy(ctx, projectUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	problems, err := (&SyntaxValidator{}).Validate(ctx, source, language, policy)
+	if err != nil || len(problems) > 0 {
+		return sortProblems(problems), err
+	}
+	var requirements []string
+	if s.projects != nil && language == TypePy {
+		if requirements, err = s.projects.PythonRequirements(ctx, projectUUID); err != nil {
+			return nil, errors.Wrap(err, "error on getting project python requirements")
 		}
-		code, err := s.repo.GetByID(ctx, id)
+	}
+
+	problems = ValidationErrors{}
+	for _, v := range []Validator{&PythonPolicyValidator{}, &EntrypointValidator{}, NewLibraryValidator(s.libService, requirements)} {
+		found, err := v.Validate(ctx, source, language, policy)
 		if err != nil {
 			return nil, err
 		}
-		code.Type = t
+		problems = append(problems, found...)
+	}
+	return sortProblems(problems), nil
+}
+
+// policy returns the validation policy of the project. The denied names are the defaults plus the
+// project deny list and minus its allow list
+func (s *Service) policy(ctx context.Context, projectUUID string) (*Policy, error) {
+	denied := append([]string{}, DefaultDeniedNames...)
+	var allowed []string
+	if s.projects != nil {
+		p, err := s.projects.CodePolicy(ctx, projectUUID)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on getting project code policy")
+		}
+		denied = append(denied, p.Deny...)
+		allowed = p.Allow
+	}
+	return NewPolicy(denied, allowed), nil
+}
+
+// AllowEgress reports if the sandboxed runs of the code keep the network access
+func (s *Service) AllowEgress(ctx context.Context, id string) (bool, error) {
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return code.AllowEgress, nil
+}
+
+// PythonRequirements returns the pinned python libraries of the project of the code, run in its virtualenv
+func (s *Service) PythonRequirements(ctx context.Context, id string) ([]string, error) {
+	if s.projects == nil {
+		return nil, nil
+	}
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.projects.PythonRequirements(ctx, code.ProjectUUID)
+}
+
+// EgressPolicy returns the network policy of the project of the code, enforced on its runs
+func (s *Service) EgressPolicy(ctx context.Context, id string) (*project.EgressPolicy, error) {
+	if s.projects == nil {
+		return &project.EgressPolicy{}, nil
+	}
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.projects.EgressPolicy(ctx, code.ProjectUUID)
+}
+
+func (s *Service) ListVersions(ctx context.Context, id string) ([]codeversion.CodeVersion, error) {
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.versions.ListByCodeID(ctx, code.Key())
+}
+
+func (s *Service) VersionSource(ctx context.Context, id string, version int) (string, error) {
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	cv, err := s.versions.Get(ctx, code.Key(), version)
+	if err != nil {
+		return "", err
+	}
+	return cv.Source, nil
+}
+
+func (s *Service) Rollback(ctx context.Context, id string, version int) (*Code, error) {
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.versions.Get(ctx, code.Key(), version)
+	if err != nil {
+		return nil, err
 	}
-	if timeout > 0 {
-		code.SetTimeout(timeout)
+	if target.Source == code.Source {
+		return code, nil
 	}
 
+	previousSource := code.Source
+	code.Source = target.Source
+	return s.updateVersion(ctx, id, code, previousSource, version)
+}
+
+func (s *Service) Publish(ctx context.Context, id string) (*Code, error) {
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Validate(ctx, code.ProjectUUID, code.Language, code.Source); err != nil {
+		return nil, err
+	}
+	if code.Version == 0 {
+		// codes created before versioning get their source as the first version
+		code.Version = 1
+		if _, err := s.versions.Create(ctx, codeversion.NewCodeVersion(code.Key(), code.Version, code.Source)); err != nil {
+			return nil, errors.Wrap(err, "error on creating code version")
+		}
+	}
+	code.publish()
 	return s.repo.Update(ctx, id, code)
 }
 
+// updateVersion saves a source change of the code as its next draft version. Codes created before versioning
+// have no versions yet, so their previous source is kept as the first one
+func (s *Service) updateVersion(ctx context.Context, id string, code *Code, previousSource string, rollbackOf int) (*Code, error) {
+	key := code.Key()
+	if code.Version == 0 {
+		code.Version = 1
+		if _, err := s.versions.Create(ctx, codeversion.NewCodeVersion(key, code.Version, previousSource)); err != nil {
+			return nil, errors.Wrap(err, "error on creating code version")
+		}
+	}
+	if code.PublishedVersion == 0 {
+		// codes saved before drafts existed keep serving their previous source until published
+		code.PublishedVersion = code.Version
+		code.PublishedSource = previousSource
+	}
+	cv := codeversion.NewCodeVersion(key, 0, code.Source)
+	cv.RollbackOf = rollbackOf
+	updated, err := s.repo.UpdateVersion(ctx, id, code, cv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on saving code version")
+	}
+	return updated, nil
+}
+
 func (s *Service) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	code, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.versions.DeleteByCodeID(ctx, code.Key())
 }
 
 func removeItens(from []string, source []string) []string {
@@ -0,0 +1,360 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/codelib"
+)
+
+const validatorTimeout = 10 * time.Second
+
+// maxValidationErrors limits the problems reported for a single source
+const maxValidationErrors = 20
+
+// DefaultDeniedNames are the python modules, functions and attributes denied to every code, unless
+// allowed by its project policy
+var DefaultDeniedNames = []string{
+	"subprocess", "ctypes", "importlib", "pty", "multiprocessing",
+	"os.system", "os.popen", "os.fork", "os.forkpty", "os.kill", "os.posix_spawn",
+	"os.execl", "os.execle", "os.execlp", "os.execv", "os.execve", "os.execvp",
+	"os.spawnl", "os.spawnle", "os.spawnv", "os.spawnve",
+	"eval", "exec", "compile", "__import__", "breakpoint", "builtins", "globals", "vars", "locals",
+	"__builtins__", "__subclasses__", "__globals__", "__code__", "__bases__", "__mro__", "__dict__",
+}
+
+//go:embed validator.py
+var pythonValidatorScript string
+
+// ValidationError is a problem found in a source, at its line and column when known
+type ValidationError struct {
+	Validator string `json:"validator"`
+	Message   string `json:"message"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	return e.Message
+}
+
+// ValidationErrors is the error of the saves rejected by the validation
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = ve.Error()
+	}
+	return "source code is invalid: " + strings.Join(msgs, "; ")
+}
+
+// Policy is what the validators deny to a source
+type Policy struct {
+	Deny []string
+}
+
+// NewPolicy returns the policy of the denied names, without the allowed ones
+func NewPolicy(denied []string, allowed []string) *Policy {
+	return &Policy{Deny: removeItens(denied, allowed)}
+}
+
+type Validator interface {
+	// Validate returns the problems found in the source, or an error when it could not be checked
+	Validate(ctx context.Context, source string, language LanguageType, policy *Policy) (ValidationErrors, error)
+}
+
+// ValidatorChain runs validators in order, stopping at the first one finding problems
+type ValidatorChain struct {
+	validators []Validator
+}
+
+func NewValidatorChain(validators ...Validator) *ValidatorChain {
+	return &ValidatorChain{validators: validators}
+}
+
+// DefaultValidatorChain checks the syntax of the source and then the python policy
+func DefaultValidatorChain() *ValidatorChain {
+	return NewValidatorChain(&SyntaxValidator{}, &PythonPolicyValidator{})
+}
+
+// Validate returns ValidationErrors when a validator finds problems in the source
+func (c *ValidatorChain) Validate(ctx context.Context, source string, language LanguageType, policy *Policy) error {
+	for _, v := range c.validators {
+		problems, err := v.Validate(ctx, source, language, policy)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return sortProblems(problems)
+		}
+	}
+	return nil
+}
+
+// sortProblems orders the problems by their location, keeping up to maxValidationErrors
+func sortProblems(problems ValidationErrors) ValidationErrors {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	if len(problems) > maxValidationErrors {
+		problems = problems[:maxValidationErrors]
+	}
+	return problems
+}
+
+// SyntaxValidator checks that the source compiles
+type SyntaxValidator struct{}
+
+func (v *SyntaxValidator) Validate(ctx context.Context, source string, language LanguageType, policy *Policy) (ValidationErrors, error) {
+	switch language {
+	case TypePy:
+		return runPythonValidator(ctx, "syntax", source, nil)
+	case TypeGo:
+		return goSyntaxErrors(source), nil
+	case TypeJS:
+		return javascriptSyntaxErrors(ctx, source)
+	}
+	return nil, nil
+}
+
+// PythonPolicyValidator denies the imports, calls and attributes of the policy to python sources,
+// resolving the import aliases, from its AST. Any use of a denied name is reported, as are the star imports
+// of modules with denied members and the getattr, setattr and delattr calls with a computed name
+type PythonPolicyValidator struct{}
+
+func (v *PythonPolicyValidator) Validate(ctx context.Context, source string, language LanguageType, policy *Policy) (ValidationErrors, error) {
+	if language != TypePy || policy == nil || len(policy.Deny) == 0 {
+		return nil, nil
+	}
+	return runPythonValidator(ctx, "policy", source, policy.Deny)
+}
+
+// EntrypointValidator checks that the source defines the Run(engine) function called by the engines
+type EntrypointValidator struct{}
+
+func (v *EntrypointValidator) Validate(ctx context.Context, source string, language LanguageType, policy *Policy) (ValidationErrors, error) {
+	switch language {
+	case TypePy:
+		return runPythonValidator(ctx, "entrypoint", source, nil)
+	case TypeGo:
+		return goEntrypointErrors(source), nil
+	case TypeJS:
+		if !javascriptEntrypoint.MatchString(source) {
+			return ValidationErrors{{Validator: "entrypoint", Message: "missing Run(engine) entry point"}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// LibraryValidator checks that the third-party libraries imported by python sources are installed,
+// globally or by the project requirements
+type LibraryValidator struct {
+	libs         codelib.UseCase
+	requirements []string
+}
+
+func NewLibraryValidator(libs codelib.UseCase, requirements []string) *LibraryValidator {
+	return &LibraryValidator{libs: libs, requirements: requirements}
+}
+
+func (v *LibraryValidator) Validate(ctx context.Context, source string, language LanguageType, policy *Policy) (ValidationErrors, error) {
+	if language != TypePy || v.libs == nil {
+		return nil, nil
+	}
+	imported := codelib.ExtractPythonLibs(source)
+	if len(imported) == 0 {
+		return nil, nil
+	}
+
+	lang := codelib.TypePy
+	libs, err := v.libs.List(ctx, &lang)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on listing code libs")
+	}
+	modules := libModules(libs)
+	required := requirementModules(v.requirements)
+
+	stdlib := pythonStdlibModules()
+	problems := ValidationErrors{}
+	for _, name := range imported {
+		lib, found := modules[name]
+		if !(found && lib.Installed()) && !required[name] && !stdlib[name] {
+			problems = append(problems, ValidationError{
+				Validator: "library",
+				Message:   fmt.Sprintf("library %s is not installed", name),
+				Line:      importLine(source, name),
+				Column:    1,
+			})
+		}
+	}
+	return problems, nil
+}
+
+var (
+	pythonStdlib     map[string]bool
+	pythonStdlibOnce sync.Once
+)
+
+// pythonStdlibModules returns the standard library modules of the python interpreter, that
+// ExtractPythonLibs only partially knows
+func pythonStdlibModules() map[string]bool {
+	pythonStdlibOnce.Do(func() {
+		pythonStdlib = map[string]bool{}
+		ctx, cancel := context.WithTimeout(context.Background(), validatorTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "python", "-I", "-c",
+			"import json, sys; print(json.dumps(sorted(sys.stdlib_module_names)))").Output()
+		if err != nil {
+			log.WithError(err).Warn("error listing python standard library modules")
+			return
+		}
+		var modules []string
+		if err := json.Unmarshal(out, &modules); err != nil {
+			log.WithError(err).Warn("error listing python standard library modules")
+			return
+		}
+		for _, m := range modules {
+			pythonStdlib[m] = true
+		}
+	})
+	return pythonStdlib
+}
+
+// importLine returns the line of the first import of the python module, 0 when not found
+func importLine(source string, module string) int {
+	re := regexp.MustCompile(`^(from|import)\s+` + regexp.QuoteMeta(module) + `\b`)
+	for i, line := range strings.Split(source, "\n") {
+		if re.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func runPythonValidator(ctx context.Context, mode string, source string, deny []string) (ValidationErrors, error) {
+	ctx, cancel := context.WithTimeout(ctx, validatorTimeout)
+	defer cancel()
+
+	input, err := json.Marshal(map[string]interface{}{"mode": mode, "source": source, "deny": deny})
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "python", "-I", "-c", pythonValidatorScript)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "error running python validator: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	problems := ValidationErrors{}
+	if err := json.Unmarshal(stdout.Bytes(), &problems); err != nil {
+		return nil, errors.Wrap(err, "error reading python validator output")
+	}
+	return problems, nil
+}
+
+func goSyntaxErrors(source string) ValidationErrors {
+	_, err := parser.ParseFile(token.NewFileSet(), "action.go", source, parser.AllErrors)
+	if err == nil {
+		return nil
+	}
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return ValidationErrors{{Validator: "syntax", Message: err.Error()}}
+	}
+	problems := ValidationErrors{}
+	for _, e := range list {
+		problems = append(problems, ValidationError{Validator: "syntax", Message: e.Msg, Line: e.Pos.Line, Column: e.Pos.Column})
+	}
+	return problems
+}
+
+func goEntrypointErrors(source string) ValidationErrors {
+	file, err := parser.ParseFile(token.NewFileSet(), "action.go", source, 0)
+	if err != nil {
+		return nil
+	}
+	problems := ValidationErrors{}
+	if file.Name.Name != "actions" {
+		problems = append(problems, ValidationError{Validator: "entrypoint", Message: "package must be actions", Line: 1, Column: 1})
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "Run" {
+			continue
+		}
+		if fn.Type.Params.NumFields() != 1 {
+			problems = append(problems, ValidationError{Validator: "entrypoint", Message: "Run must receive the engine argument"})
+		}
+		return problems
+	}
+	return append(problems, ValidationError{Validator: "entrypoint", Message: "missing Run(engine) entry point"})
+}
+
+// javascriptEntrypoint matches the Run function declarations and exports run by the javascript engine
+var javascriptEntrypoint = regexp.MustCompile(`(?m)^\s*(export\s+)?(async\s+)?function\s*\*?\s*Run\s*\(|^\s*(export\s+)?(const|let|var)\s+Run\s*=|exports\.Run\s*=`)
+
+// nodeErrorLocation matches the "[stdin]:<line>" header of the node syntax errors
+var nodeErrorLocation = regexp.MustCompile(`^\[stdin\]:(\d+)`)
+
+func javascriptSyntaxErrors(ctx context.Context, source string) (ValidationErrors, error) {
+	ctx, cancel := context.WithTimeout(ctx, validatorTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "node", "--check")
+	cmd.Stdin = strings.NewReader(source)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || ctx.Err() != nil {
+		return nil, errors.Wrap(err, "error running javascript validator")
+	}
+
+	// node reports the location, the source line, a caret under the column and then the error
+	problem := ValidationError{Validator: "syntax", Message: "invalid syntax"}
+	lines := strings.Split(stderr.String(), "\n")
+	for i, line := range lines {
+		if m := nodeErrorLocation.FindStringSubmatch(line); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			if i+2 < len(lines) {
+				if col := strings.Index(lines[i+2], "^"); col >= 0 {
+					problem.Column = col + 1
+				}
+			}
+		}
+		if strings.HasPrefix(line, "SyntaxError: ") {
+			problem.Message = strings.TrimPrefix(line, "SyntaxError: ")
+			break
+		}
+	}
+	return ValidationErrors{problem}, nil
+}
@@ -0,0 +1,142 @@
+# Static analysis of the python code actions, run by the code service before saving a source.
+# Reads {"mode": "syntax" | "policy" | "entrypoint", "source": str, "deny": [str]} from stdin and writes the
+# problems found as a JSON list of {"validator", "message", "line", "column"} to stdout.
+import ast
+import json
+import sys
+
+
+def problem(validator, message, node=None, line=0, column=0):
+    if node is not None:
+        line = getattr(node, "lineno", 0)
+        column = getattr(node, "col_offset", -1) + 1
+    return {"validator": validator, "message": message, "line": line or 0, "column": column or 0}
+
+
+def check_syntax(source):
+    try:
+        compile(source, "action.py", "exec")
+    except SyntaxError as e:
+        return [problem("syntax", e.msg, line=e.lineno, column=e.offset)]
+    except ValueError as e:
+        return [problem("syntax", str(e))]
+    return []
+
+
+# attribute functions resolving the attribute name at runtime, only allowed with a constant name
+ATTRIBUTE_FUNCTIONS = ("getattr", "setattr", "delattr")
+
+
+def dotted_name(node, aliases):
+    """Returns the dotted name of a Name or Attribute chain, resolving the imported aliases"""
+    parts = []
+    while isinstance(node, ast.Attribute):
+        parts.append(node.attr)
+        node = node.value
+    if not isinstance(node, ast.Name):
+        return None
+    parts.append(aliases.get(node.id, node.id))
+    return ".".join(reversed(parts))
+
+
+def name_chain(node):
+    """Yields the nodes of a Name or Attribute chain, from the outermost"""
+    yield node
+    while isinstance(node, ast.Attribute):
+        node = node.value
+        yield node
+
+
+def check_policy(source, deny):
+    deny = set(deny)
+
+    def denied(name):
+        parts = name.split(".")
+        return any(".".join(parts[:i]) in deny for i in range(1, len(parts) + 1))
+
+    tree = ast.parse(source)
+    aliases = {}
+    for node in ast.walk(tree):
+        if isinstance(node, ast.Import):
+            for alias in node.names:
+                if alias.asname:
+                    aliases[alias.asname] = alias.name
+        elif isinstance(node, ast.ImportFrom) and node.level == 0 and node.module:
+            for alias in node.names:
+                aliases[alias.asname or alias.name] = node.module + "." + alias.name
+
+    problems = []
+    # the nodes of a reported name chain, or of the function of a call, are not reported again
+    reported = set()
+    for node in ast.walk(tree):
+        if id(node) in reported:
+            continue
+        if isinstance(node, ast.Import):
+            for alias in node.names:
+                if denied(alias.name):
+                    problems.append(problem("policy", f"import of {alias.name} is not allowed", node))
+        elif isinstance(node, ast.ImportFrom) and node.level == 0 and node.module:
+            for alias in node.names:
+                name = node.module + "." + alias.name
+                if alias.name == "*":
+                    # a star import binds the denied members of the module under names that can't be resolved
+                    if denied(node.module) or any(d.startswith(node.module + ".") for d in deny):
+                        problems.append(problem("policy", f"import of {name} is not allowed", node))
+                elif denied(name):
+                    problems.append(problem("policy", f"import of {name} is not allowed", node))
+        elif isinstance(node, ast.Call):
+            name = dotted_name(node.func, aliases)
+            if name and denied(name):
+                problems.append(problem("policy", f"call of {name} is not allowed", node))
+                reported.update(id(n) for n in name_chain(node.func))
+                continue
+            if name in ATTRIBUTE_FUNCTIONS:
+                reported.add(id(node.func))
+                attr = node.args[1] if len(node.args) > 1 else None
+                if not (isinstance(attr, ast.Constant) and isinstance(attr.value, str)):
+                    problems.append(problem("policy", f"{name} with a computed name is not allowed", node))
+                    continue
+                target = dotted_name(node.args[0], aliases)
+                if attr.value in deny:
+                    problems.append(problem("policy", f"access to {attr.value} is not allowed", node))
+                elif target and denied(target + "." + attr.value):
+                    problems.append(problem("policy", f"access to {target}.{attr.value} is not allowed", node))
+        elif isinstance(node, (ast.Attribute, ast.Name)):
+            if not isinstance(getattr(node, "ctx", None), ast.Load):
+                continue
+            name = dotted_name(node, aliases)
+            if name and denied(name):
+                problems.append(problem("policy", f"access to {name} is not allowed", node))
+            elif isinstance(node, ast.Attribute) and node.attr.startswith("__") and node.attr in deny:
+                problems.append(problem("policy", f"access to {node.attr} is not allowed", node))
+            elif name in ATTRIBUTE_FUNCTIONS:
+                problems.append(problem("policy", f"access to {name} is not allowed", node))
+            else:
+                continue
+            reported.update(id(n) for n in name_chain(node))
+    return problems
+
+
+def check_entrypoint(source):
+    for node in ast.parse(source).body:
+        if isinstance(node, (ast.FunctionDef, ast.AsyncFunctionDef)) and node.name == "Run":
+            args = node.args
+            if not (args.posonlyargs or args.args or args.vararg):
+                return [problem("entrypoint", "Run must receive the engine argument", node)]
+            return []
+    return [problem("entrypoint", "missing Run(engine) entry point")]
+
+
+def main():
+    request = json.load(sys.stdin)
+    if request.get("mode") == "policy":
+        problems = check_policy(request.get("source", ""), request.get("deny") or [])
+    elif request.get("mode") == "entrypoint":
+        problems = check_entrypoint(request.get("source", ""))
+    else:
+        problems = check_syntax(request.get("source", ""))
+    json.dump(problems, sys.stdout)
+
+
+if __name__ == "__main__":
+    main()
@@ -21,21 +21,48 @@ const (
 	TypePy LanguageType = "python"
 )
 
+type LibStatus string
+
+const (
+	StatusPending   LibStatus = "pending"
+	StatusInstalled LibStatus = "installed"
+	StatusFailed    LibStatus = "failed"
+)
+
 type CodeLib struct {
 	ID            string `json:"id,omitempty"`                              // PostgreSQL UUID (primary key)
 	MongoObjectID string `json:"mongo_object_id,omitempty" bson:"_id,omitempty"` // MongoDB ObjectID for backward compatibility
 	Name          string       `bson:"name,omitempty" json:"name,omitempty"`
 	Language      LanguageType `bson:"language,omitempty" json:"language,omitempty"`
+	Status        LibStatus    `bson:"status,omitempty" json:"status,omitempty"`
+	Output        string       `bson:"output,omitempty" json:"output,omitempty"` // pip output of the last installation
+	// Nodes are the installations of the library on each node, which installs it on its own
+	Nodes []NodeInstall `bson:"nodes,omitempty" json:"nodes"`
 
 	CreatedAt time.Time `bson:"created_at,omitempty" json:"created_at,omitempty"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// NodeInstall is the installation of a library on one node. Status and Output of the library are the
+// ones of its last installation on any node
+type NodeInstall struct {
+	Node      string    `bson:"node" json:"node"`
+	Status    LibStatus `bson:"status" json:"status"`
+	Output    string    `bson:"output,omitempty" json:"output,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
 type UseCase interface {
 	Create(ctx context.Context, codelib *CodeLib) (*CodeLib, error)
 	CreateBulk(ctx context.Context, codelibs []*CodeLib) ([]*CodeLib, error)
 	List(ctx context.Context, Language *LanguageType) ([]CodeLib, error)
 	Find(ctx context.Context, name string, language *LanguageType) (*CodeLib, error)
+	GetByID(ctx context.Context, id string) (*CodeLib, error)
+	Delete(ctx context.Context, id string) error
+	// UpdateStatus records the result of an installation of the library on the node
+	UpdateStatus(ctx context.Context, id string, node string, status LibStatus, output string) error
+	// ResetStatus sets the library as pending and drops its installations, so every node installs it again
+	ResetStatus(ctx context.Context, id string) error
 }
 
 type Repository interface {
@@ -43,15 +70,44 @@ type Repository interface {
 	CreateBulk(ctx context.Context, codelibs []*CodeLib) ([]*CodeLib, error)
 	List(ctx context.Context, Language *LanguageType) ([]CodeLib, error)
 	Find(ctx context.Context, name string, language *LanguageType) (*CodeLib, error)
+	GetByID(ctx context.Context, id string) (*CodeLib, error)
+	Delete(ctx context.Context, id string) error
+	UpdateStatus(ctx context.Context, id string, node string, status LibStatus, output string) error
+	ResetStatus(ctx context.Context, id string) error
 }
 
 func NewCodeLib(name string, language LanguageType) *CodeLib {
 	return &CodeLib{
 		Name:     name,
 		Language: language,
+		Status:   StatusPending,
 	}
 }
 
+// Installed reports if the library is installed on some node. Libraries saved before the installation
+// status existed have none, and were installed on startup
+func (l *CodeLib) Installed() bool {
+	if l.Status == "" || l.Status == StatusInstalled {
+		return true
+	}
+	for _, install := range l.Nodes {
+		if install.Status == StatusInstalled {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallOn returns the installation of the library on the node, nil when the node has not installed it
+func (l *CodeLib) InstallOn(node string) *NodeInstall {
+	for i := range l.Nodes {
+		if l.Nodes[i].Node == node {
+			return &l.Nodes[i]
+		}
+	}
+	return nil
+}
+
 func ExtractPythonLibs(pythonCode string) []string {
 	standardLibraries := []string{"base64", "datetime", "email", "hashlib", "imaplib", "io", "json", "math", "os", "random", "re", "sys", "tempfile", "time", "urllib", "urllib.parse", "urllib.request", "wave"} // must be alphabetically ordered
 	re := regexp.MustCompile(`^(from|import)\s+([\w.]+)`)
@@ -74,27 +130,36 @@ func ExtractPythonLibs(pythonCode string) []string {
 func InstallPythonLibs(libs []string) error {
 	log.Println("Installing python libs")
 	for _, lib := range libs {
-		// cmd := exec.Command("pip", "install", lib)
-		cmd := exec.Command("pip", "install", "--no-cache-dir", "--break-system-packages", lib)
-		var stdout bytes.Buffer
-		var stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-		err := cmd.Run()
-		if stderr.String() != "" {
-			log.Println("install lib stderr: ", stderr.String())
-		}
-		if stdout.String() != "" {
-			log.Println("install lib stdout: ", stdout.String())
-		}
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error on install lib: %s", lib))
+		if _, err := InstallPythonLib(lib); err != nil {
+			return err
 		}
-		log.Printf("lib installed: %s\n", lib)
 	}
 	return nil
 }
 
+// InstallPythonLib installs the library with pip, returning its output
+func InstallPythonLib(lib string) (string, error) {
+	// cmd := exec.Command("pip", "install", lib)
+	cmd := exec.Command("pip", "install", "--no-cache-dir", "--break-system-packages", lib)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if stderr.String() != "" {
+		log.Println("install lib stderr: ", stderr.String())
+	}
+	if stdout.String() != "" {
+		log.Println("install lib stdout: ", stdout.String())
+	}
+	output := stdout.String() + stderr.String()
+	if err != nil {
+		return output, errors.Wrap(err, fmt.Sprintf("Error on install lib: %s", lib))
+	}
+	log.Printf("lib installed: %s\n", lib)
+	return output, nil
+}
+
 func contains(s []string, e string) bool {
 	i := sort.SearchStrings(s, e)
 	return i < len(s) && s[i] == e
@@ -114,3 +179,13 @@ func removeDoubles(s []string) []string {
 	}
 	return s
 }
+
+var libNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateName checks that the name is a python distribution name, which pip can't take for an option or a path
+func ValidateName(name string) error {
+	if !libNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid library name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package codelib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+const (
+	installTimeout   = 10 * time.Minute
+	installQueueSize = 100
+)
+
+// Installer installs python libraries in the background, one at a time, recording the installation
+// status and output of the node on their code libs. Each node runs its own installer, which installs
+// the libraries added through the other nodes on its periodic sync. Libraries are installed as the
+// distribution of their module, and the allow list of distributions governs the libraries installed
+// automatically
+type Installer struct {
+	libs    UseCase
+	node    string
+	allowed map[string]bool
+	queue   chan string
+
+	mu      sync.Mutex
+	pending map[string]bool
+
+	// install runs pip, replaced by the tests
+	install func(lib string) (string, error)
+}
+
+func NewInstaller(libs UseCase, allowList []string, node string) *Installer {
+	allowed := map[string]bool{}
+	for _, lib := range allowList {
+		allowed[project.LibraryName(lib)] = true
+	}
+	return &Installer{
+		libs:    libs,
+		node:    node,
+		allowed: allowed,
+		queue:   make(chan string, installQueueSize),
+		pending: map[string]bool{},
+		install: InstallPythonLib,
+	}
+}
+
+// Start installs the queued libraries in the background, and syncs the libraries of the node every
+// interval until the context is done. The first sync installs again the libraries installed before,
+// since the installed packages don't outlive the node
+func (i *Installer) Start(ctx context.Context, interval time.Duration) {
+	go i.worker()
+	go func() {
+		reinstall := true
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := i.Sync(ctx, reinstall); err != nil {
+				log.WithError(err).Error("error on syncing code libs")
+			} else {
+				reinstall = false
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sync queues the python libraries this node has no installation of, and with reinstall the ones
+// it installed too. The libraries failed on this node are only installed again through the admin API
+func (i *Installer) Sync(ctx context.Context, reinstall bool) error {
+	lang := TypePy
+	libs, err := i.libs.List(ctx, &lang)
+	if err != nil {
+		return errors.Wrap(err, "error on listing code libs")
+	}
+	for _, lib := range libs {
+		install := lib.InstallOn(i.node)
+		if install != nil && (install.Status == StatusFailed || !reinstall) {
+			continue
+		}
+		if err := i.Enqueue(lib.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allowed reports if the distribution of the library is in the allow list
+func (i *Installer) Allowed(name string) bool {
+	return i.allowed[Distribution(name)]
+}
+
+// Enqueue queues the installation of the library, unless it is already queued. The library is saved
+// as a pending code lib when it has none
+func (i *Installer) Enqueue(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.pending[name] {
+		return nil
+	}
+	select {
+	case i.queue <- name:
+		i.pending[name] = true
+		return nil
+	default:
+		return errors.New("library installation queue is full")
+	}
+}
+
+func (i *Installer) worker() {
+	for name := range i.queue {
+		if err := i.installLib(name); err != nil {
+			log.WithError(err).WithField("lib", name).Error("error on installing code lib")
+		}
+		i.mu.Lock()
+		delete(i.pending, name)
+		i.mu.Unlock()
+	}
+}
+
+func (i *Installer) installLib(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+
+	lang := TypePy
+	lib, err := i.libs.Find(ctx, name, &lang)
+	if err != nil || lib == nil {
+		if lib, err = i.libs.Create(ctx, NewCodeLib(name, TypePy)); err != nil {
+			return errors.Wrap(err, "error on creating code lib")
+		}
+	}
+
+	output, installErr := i.install(Distribution(name))
+	status := StatusInstalled
+	if installErr != nil {
+		status = StatusFailed
+	}
+	if err := i.libs.UpdateStatus(ctx, lib.ID, i.node, status, output); err != nil {
+		return errors.Wrap(err, "error on updating code lib status")
+	}
+	return installErr
+}
@@ -0,0 +1,130 @@
+package codelib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryLibs struct {
+	UseCase
+	mu   sync.Mutex
+	libs map[string]*CodeLib
+}
+
+func (m *memoryLibs) Find(ctx context.Context, name string, language *LanguageType) (*CodeLib, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if lib, ok := m.libs[name]; ok {
+		found := *lib
+		return &found, nil
+	}
+	return nil, errors.New("codelib not found")
+}
+
+func (m *memoryLibs) Create(ctx context.Context, lib *CodeLib) (*CodeLib, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lib.ID = lib.Name
+	m.libs[lib.Name] = lib
+	return lib, nil
+}
+
+func (m *memoryLibs) List(ctx context.Context, language *LanguageType) ([]CodeLib, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	libs := []CodeLib{}
+	for _, lib := range m.libs {
+		libs = append(libs, *lib)
+	}
+	return libs, nil
+}
+
+func (m *memoryLibs) UpdateStatus(ctx context.Context, id string, node string, status LibStatus, output string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lib := m.libs[id]
+	lib.Status = status
+	lib.Output = output
+	nodes := []NodeInstall{}
+	for _, install := range lib.Nodes {
+		if install.Node != node {
+			nodes = append(nodes, install)
+		}
+	}
+	lib.Nodes = append(nodes, NodeInstall{Node: node, Status: status, Output: output, UpdatedAt: time.Now()})
+	return nil
+}
+
+func TestInstaller(t *testing.T) {
+	libs := &memoryLibs{libs: map[string]*CodeLib{
+		"numpy": {ID: "numpy", Name: "numpy", Language: TypePy, Status: StatusInstalled},
+	}}
+	installer := NewInstaller(libs, []string{"Requests", "PyYAML"}, "node-a")
+	installer.install = func(name string) (string, error) {
+		if name == "numpy" {
+			return "No matching distribution found for numpy", errors.New("exit status 1")
+		}
+		return "Successfully installed " + name, nil
+	}
+	go installer.worker()
+
+	assert.True(t, installer.Allowed("requests"))
+	assert.True(t, installer.Allowed("yaml"))
+	assert.False(t, installer.Allowed("numpy"))
+
+	assert.NoError(t, installer.Enqueue("requests"))
+	assert.NoError(t, installer.Enqueue("yaml"))
+	assert.NoError(t, installer.Enqueue("numpy"))
+	assert.Eventually(t, func() bool {
+		requests, err := libs.Find(context.TODO(), "requests", nil)
+		if err != nil || requests.Status != StatusInstalled {
+			return false
+		}
+		if yaml, err := libs.Find(context.TODO(), "yaml", nil); err != nil || yaml.Status != StatusInstalled {
+			return false
+		}
+		numpy, _ := libs.Find(context.TODO(), "numpy", nil)
+		return numpy.Status == StatusFailed
+	}, time.Second, 10*time.Millisecond)
+
+	requests, _ := libs.Find(context.TODO(), "requests", nil)
+	assert.Equal(t, TypePy, requests.Language)
+	assert.Equal(t, "Successfully installed requests", requests.Output)
+	// the module is installed as its distribution
+	yaml, _ := libs.Find(context.TODO(), "yaml", nil)
+	assert.Equal(t, "Successfully installed pyyaml", yaml.Output)
+	numpy, _ := libs.Find(context.TODO(), "numpy", nil)
+	assert.False(t, numpy.Installed())
+	assert.Equal(t, "No matching distribution found for numpy", numpy.Output)
+	assert.Equal(t, StatusFailed, numpy.InstallOn("node-a").Status)
+	assert.Nil(t, numpy.InstallOn("node-b"))
+}
+
+func TestInstallerSync(t *testing.T) {
+	libs := &memoryLibs{libs: map[string]*CodeLib{
+		"requests": {ID: "requests", Name: "requests", Language: TypePy, Status: StatusInstalled,
+			Nodes: []NodeInstall{{Node: "node-a", Status: StatusInstalled}}},
+		"numpy": {ID: "numpy", Name: "numpy", Language: TypePy, Status: StatusFailed,
+			Nodes: []NodeInstall{{Node: "node-a", Status: StatusFailed}, {Node: "node-b", Status: StatusInstalled}}},
+		"pandas": {ID: "pandas", Name: "pandas", Language: TypePy, Status: StatusInstalled,
+			Nodes: []NodeInstall{{Node: "node-b", Status: StatusInstalled}}},
+	}}
+	installer := NewInstaller(libs, nil, "node-a")
+	ctx := context.TODO()
+
+	// the libraries installed through the other nodes are installed on the sync
+	assert.NoError(t, installer.Sync(ctx, false))
+	assert.Equal(t, map[string]bool{"pandas": true}, installer.pending)
+
+	// on startup the installed ones are installed again, the failed ones are left to the admin API
+	assert.NoError(t, installer.Sync(ctx, true))
+	assert.Equal(t, map[string]bool{"pandas": true, "requests": true}, installer.pending)
+
+	numpy, _ := libs.Find(ctx, "numpy", nil)
+	assert.True(t, numpy.Installed())
+}
@@ -0,0 +1,66 @@
+package codelib
+
+import (
+	"strings"
+
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+// moduleDistributions maps the python modules to the distributions installing them, for the modules whose
+// import name is not their distribution name. An import is only installed as its distribution, so importing
+// bs4 never installs a package published under the import name
+var moduleDistributions = map[string]string{
+	"Crypto":          "pycryptodome",
+	"Levenshtein":     "python-Levenshtein",
+	"MySQLdb":         "mysqlclient",
+	"OpenSSL":         "pyOpenSSL",
+	"PIL":             "Pillow",
+	"attr":            "attrs",
+	"bs4":             "beautifulsoup4",
+	"cv2":             "opencv-python",
+	"dateutil":        "python-dateutil",
+	"docx":            "python-docx",
+	"dotenv":          "python-dotenv",
+	"fitz":            "PyMuPDF",
+	"googleapiclient": "google-api-python-client",
+	"jose":            "python-jose",
+	"jwt":             "PyJWT",
+	"magic":           "python-magic",
+	"pptx":            "python-pptx",
+	"serial":          "pyserial",
+	"sklearn":         "scikit-learn",
+	"slugify":         "python-slugify",
+	"telegram":        "python-telegram-bot",
+	"websocket":       "websocket-client",
+	"yaml":            "PyYAML",
+	"zmq":             "pyzmq",
+}
+
+// distributionModules is the reverse of moduleDistributions, by normalized distribution name
+var distributionModules = map[string]string{}
+
+func init() {
+	for module, distribution := range moduleDistributions {
+		distributionModules[project.LibraryName(distribution)] = module
+	}
+}
+
+// Distribution returns the normalized name of the distribution installing the python module
+func Distribution(module string) string {
+	if distribution, ok := moduleDistributions[module]; ok {
+		return project.LibraryName(distribution)
+	}
+	return project.LibraryName(module)
+}
+
+// Module returns the python module installed by the library, named by its module or its distribution
+func Module(name string) string {
+	if module, ok := distributionModules[project.LibraryName(name)]; ok {
+		return module
+	}
+	if _, ok := moduleDistributions[name]; ok {
+		return name
+	}
+	// the other distributions are installing the module of their name, with underscores
+	return strings.ReplaceAll(project.LibraryName(name), "-", "_")
+}
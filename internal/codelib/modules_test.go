@@ -0,0 +1,21 @@
+package codelib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleDistributions(t *testing.T) {
+	assert.Equal(t, "pyyaml", Distribution("yaml"))
+	assert.Equal(t, "beautifulsoup4", Distribution("bs4"))
+	assert.Equal(t, "pillow", Distribution("PIL"))
+	assert.Equal(t, "requests", Distribution("requests"))
+	assert.Equal(t, "typing-extensions", Distribution("typing_extensions"))
+
+	assert.Equal(t, "yaml", Module("PyYAML"))
+	assert.Equal(t, "bs4", Module("bs4"))
+	assert.Equal(t, "PIL", Module("pillow"))
+	assert.Equal(t, "dateutil", Module("python_dateutil"))
+	assert.Equal(t, "typing_extensions", Module("typing-extensions"))
+}
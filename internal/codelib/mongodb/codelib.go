@@ -65,6 +65,7 @@ func (r *codelibRepo) List(ctx context.Context, lang *codelib.LanguageType) ([]c
 		if err := cls.Decode(&cl); err != nil {
 			return nil, err
 		}
+		cl.ID = cl.MongoObjectID
 		libs = append(libs, cl)
 	}
 	if err := cls.Err(); err != nil {
@@ -85,5 +86,83 @@ func (r *codelibRepo) Find(ctx context.Context, name string, language *codelib.L
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, err
 	}
+	lib.ID = lib.MongoObjectID
 	return lib, nil
 }
+
+func (r *codelibRepo) GetByID(ctx context.Context, id string) (*codelib.CodeLib, error) {
+	libID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	lib := &codelib.CodeLib{}
+	if err := r.collection.FindOne(ctx, bson.M{"_id": libID}).Decode(lib); err != nil {
+		return nil, err
+	}
+	lib.ID = lib.MongoObjectID
+	return lib, nil
+}
+
+func (r *codelibRepo) Delete(ctx context.Context, id string) error {
+	libID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": libID})
+	return err
+}
+
+func (r *codelibRepo) UpdateStatus(ctx context.Context, id string, node string, status codelib.LibStatus, output string) error {
+	libID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	// only the node writes its installation, so pulling and pushing it again can't lose another one
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": libID}, bson.M{
+		"$pull": bson.M{"nodes": bson.M{"node": node}},
+	}); err != nil {
+		return err
+	}
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":     status,
+			"output":     output,
+			"updated_at": now,
+		},
+		"$push": bson.M{
+			"nodes": codelib.NodeInstall{Node: node, Status: status, Output: output, UpdatedAt: now},
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": libID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *codelibRepo) ResetStatus(ctx context.Context, id string) error {
+	libID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     codelib.StatusPending,
+			"output":     "",
+			"nodes":      bson.A{},
+			"updated_at": time.Now(),
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": libID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package pg
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,8 +23,8 @@ func NewCodeLibRepo(db *sql.DB) codelib.Repository {
 
 func (r *codelibRepo) Create(ctx context.Context, cl *codelib.CodeLib) (*codelib.CodeLib, error) {
 	query := `
-		INSERT INTO codelibs (mongo_object_id, name, language, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5) 
+		INSERT INTO codelibs (mongo_object_id, name, language, status, output, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) 
 		RETURNING id`
 
 	cl.CreatedAt = time.Now()
@@ -34,6 +35,8 @@ func (r *codelibRepo) Create(ctx context.Context, cl *codelib.CodeLib) (*codelib
 		nullString(cl.MongoObjectID),
 		cl.Name,
 		cl.Language,
+		libStatus(cl.Status),
+		cl.Output,
 		cl.CreatedAt,
 		cl.UpdatedAt,
 	).Scan(&id)
@@ -60,8 +63,8 @@ func (r *codelibRepo) CreateBulk(ctx context.Context, cls []*codelib.CodeLib) ([
 
 	// Prepare statement for bulk insert
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO codelibs (mongo_object_id, name, language, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5) 
+		INSERT INTO codelibs (mongo_object_id, name, language, status, output, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) 
 		RETURNING id`)
 	if err != nil {
 		return nil, errors.Wrap(err, "error preparing bulk insert statement")
@@ -78,6 +81,8 @@ func (r *codelibRepo) CreateBulk(ctx context.Context, cls []*codelib.CodeLib) ([
 			nullString(cl.MongoObjectID),
 			cl.Name,
 			cl.Language,
+			libStatus(cl.Status),
+			cl.Output,
 			cl.CreatedAt,
 			cl.UpdatedAt,
 		).Scan(&id)
@@ -99,7 +104,7 @@ func (r *codelibRepo) CreateBulk(ctx context.Context, cls []*codelib.CodeLib) ([
 
 func (r *codelibRepo) List(ctx context.Context, lang *codelib.LanguageType) ([]codelib.CodeLib, error) {
 	query := `
-		SELECT id, mongo_object_id, name, language, created_at, updated_at 
+		SELECT id, mongo_object_id, name, language, status, output, nodes, created_at, updated_at 
 		FROM codelibs`
 
 	args := []interface{}{}
@@ -122,12 +127,16 @@ func (r *codelibRepo) List(ctx context.Context, lang *codelib.LanguageType) ([]c
 	for rows.Next() {
 		var cl codelib.CodeLib
 		var mongoObjectID sql.NullString
-		
+		var nodesJSON []byte
+
 		err := rows.Scan(
 			&cl.ID,
 			&mongoObjectID,
 			&cl.Name,
 			&cl.Language,
+			&cl.Status,
+			&cl.Output,
+			&nodesJSON,
 			&cl.CreatedAt,
 			&cl.UpdatedAt,
 		)
@@ -138,6 +147,9 @@ func (r *codelibRepo) List(ctx context.Context, lang *codelib.LanguageType) ([]c
 		if mongoObjectID.Valid {
 			cl.MongoObjectID = mongoObjectID.String
 		}
+		if err := json.Unmarshal(nodesJSON, &cl.Nodes); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling codelib nodes")
+		}
 
 		libs = append(libs, cl)
 	}
@@ -151,7 +163,7 @@ func (r *codelibRepo) List(ctx context.Context, lang *codelib.LanguageType) ([]c
 
 func (r *codelibRepo) Find(ctx context.Context, name string, lang *codelib.LanguageType) (*codelib.CodeLib, error) {
 	query := `
-		SELECT id, mongo_object_id, name, language, created_at, updated_at 
+		SELECT id, mongo_object_id, name, language, status, output, nodes, created_at, updated_at 
 		FROM codelibs 
 		WHERE name = $1`
 
@@ -165,12 +177,55 @@ func (r *codelibRepo) Find(ctx context.Context, name string, lang *codelib.Langu
 
 	cl := &codelib.CodeLib{}
 	var mongoObjectID sql.NullString
+	var nodesJSON []byte
 	
 	err := r.db.QueryRowContext(ctx, query, args...).Scan(
 		&cl.ID,
 		&mongoObjectID,
 		&cl.Name,
 		&cl.Language,
+		&cl.Status,
+		&cl.Output,
+		&nodesJSON,
+		&cl.CreatedAt,
+		&cl.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("codelib not found")
+		}
+		return nil, errors.Wrap(err, "error finding codelib")
+	}
+
+	if mongoObjectID.Valid {
+		cl.MongoObjectID = mongoObjectID.String
+	}
+	if err := json.Unmarshal(nodesJSON, &cl.Nodes); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling codelib nodes")
+	}
+
+	return cl, nil
+}
+
+func (r *codelibRepo) GetByID(ctx context.Context, id string) (*codelib.CodeLib, error) {
+	query := `
+		SELECT id, mongo_object_id, name, language, status, output, nodes, created_at, updated_at
+		FROM codelibs
+		WHERE id = $1`
+
+	cl := &codelib.CodeLib{}
+	var mongoObjectID sql.NullString
+	var nodesJSON []byte
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&cl.ID,
+		&mongoObjectID,
+		&cl.Name,
+		&cl.Language,
+		&cl.Status,
+		&cl.Output,
+		&nodesJSON,
 		&cl.CreatedAt,
 		&cl.UpdatedAt,
 	)
@@ -185,10 +240,95 @@ func (r *codelibRepo) Find(ctx context.Context, name string, lang *codelib.Langu
 	if mongoObjectID.Valid {
 		cl.MongoObjectID = mongoObjectID.String
 	}
+	if err := json.Unmarshal(nodesJSON, &cl.Nodes); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling codelib nodes")
+	}
 
 	return cl, nil
 }
 
+func (r *codelibRepo) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM codelibs WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "error deleting codelib")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("codelib not found")
+	}
+
+	return nil
+}
+
+// UpdateStatus updates the installation of the codelib on the node, and its last status and output
+func (r *codelibRepo) UpdateStatus(ctx context.Context, id string, node string, status codelib.LibStatus, output string) error {
+	query := `
+		UPDATE codelibs
+		SET status = $3, output = $4, updated_at = $5,
+			nodes = COALESCE((SELECT jsonb_agg(n) FROM jsonb_array_elements(nodes) n WHERE n->>'node' <> $2), '[]'::jsonb) || $6::jsonb
+		WHERE id = $1`
+
+	now := time.Now()
+	installJSON, err := json.Marshal([]codelib.NodeInstall{{Node: node, Status: status, Output: output, UpdatedAt: now}})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling codelib node")
+	}
+
+	result, err := r.db.ExecContext(ctx, query, id, node, status, output, now, installJSON)
+	if err != nil {
+		return errors.Wrap(err, "error updating codelib status")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("codelib not found")
+	}
+
+	return nil
+}
+
+// ResetStatus sets the codelib as pending and drops its installations on the nodes
+func (r *codelibRepo) ResetStatus(ctx context.Context, id string) error {
+	query := `
+		UPDATE codelibs
+		SET status = $2, output = '', nodes = '[]'::jsonb, updated_at = $3
+		WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, codelib.StatusPending, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "error resetting codelib status")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("codelib not found")
+	}
+
+	return nil
+}
+
+// libStatus defaults the status of the codelibs saved without one to installed, as the ones
+// saved before the installation status existed
+func libStatus(status codelib.LibStatus) codelib.LibStatus {
+	if status == "" {
+		return codelib.StatusInstalled
+	}
+	return status
+}
+
 // nullString converts an empty string to sql.NullString
 func nullString(s string) sql.NullString {
 	if s == "" {
@@ -8,6 +8,9 @@ CREATE TABLE IF NOT EXISTS codelibs (
     mongo_object_id TEXT UNIQUE,
     name VARCHAR(255) NOT NULL,
     language VARCHAR(50) NOT NULL CHECK (language IN ('python')),
+    status VARCHAR(20) NOT NULL DEFAULT 'installed' CHECK (status IN ('pending', 'installed', 'failed')),
+    output TEXT NOT NULL DEFAULT '',
+    nodes JSONB NOT NULL DEFAULT '[]'::jsonb,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
@@ -26,3 +29,6 @@ CREATE UNIQUE INDEX IF NOT EXISTS idx_codelibs_unique_name_language ON codelibs(
 COMMENT ON TABLE codelibs IS 'Stores code libraries (e.g., Python packages) available for use';
 COMMENT ON COLUMN codelibs.id IS 'Primary key (PostgreSQL native UUID)';
 COMMENT ON COLUMN codelibs.mongo_object_id IS 'MongoDB ObjectID for backward compatibility';
+COMMENT ON COLUMN codelibs.status IS 'Installation status of the library: pending, installed or failed';
+COMMENT ON COLUMN codelibs.output IS 'pip output of the last installation of the library';
+COMMENT ON COLUMN codelibs.nodes IS 'Installation status and pip output of the library on each node';
@@ -25,3 +25,19 @@ func (s *Service) List(ctx context.Context, language *LanguageType) ([]CodeLib,
 func (s *Service) Find(ctx context.Context, name string, language *LanguageType) (*CodeLib, error) {
 	return s.repo.Find(ctx, name, language)
 }
+
+func (s *Service) GetByID(ctx context.Context, id string) (*CodeLib, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *Service) UpdateStatus(ctx context.Context, id string, node string, status LibStatus, output string) error {
+	return s.repo.UpdateStatus(ctx, id, node, status, output)
+}
+
+func (s *Service) ResetStatus(ctx context.Context, id string) error {
+	return s.repo.ResetStatus(ctx, id)
+}
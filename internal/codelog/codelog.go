@@ -15,6 +15,15 @@ const (
 	TypeError LogType = "error"
 )
 
+// ParseLogType returns the log type with the given name, TypeInfo when it is not a known type
+func ParseLogType(name string) LogType {
+	switch t := LogType(name); t {
+	case TypeDebug, TypeInfo, TypeError:
+		return t
+	}
+	return TypeInfo
+}
+
 type CodeLog struct {
 	ID string `bson:"_id,omitempty" json:"id,omitempty"`
 
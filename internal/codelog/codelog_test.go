@@ -0,0 +1,15 @@
+package codelog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogType(t *testing.T) {
+	assert.Equal(t, TypeDebug, ParseLogType("debug"))
+	assert.Equal(t, TypeError, ParseLogType("error"))
+	assert.Equal(t, TypeInfo, ParseLogType("info"))
+	assert.Equal(t, TypeInfo, ParseLogType("warning"))
+	assert.Equal(t, TypeInfo, ParseLogType(""))
+}
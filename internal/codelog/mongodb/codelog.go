@@ -52,7 +52,9 @@ func (r *codelogRepo) Count(ctx context.Context, runID, codeID string) (int64, e
 }
 
 func (r *codelogRepo) Create(ctx context.Context, codelog *codelog.CodeLog) (*codelog.CodeLog, error) {
-	codelog.CreatedAt = time.Now()
+	if codelog.CreatedAt.IsZero() {
+		codelog.CreatedAt = time.Now()
+	}
 	codelog.UpdatedAt = time.Now()
 	result, err := r.collection.InsertOne(ctx, codelog)
 	if err != nil {
@@ -0,0 +1,226 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/codelog"
+
+	_ "github.com/lib/pq"
+)
+
+type codelogRepo struct {
+	db *sql.DB
+}
+
+// NewCodeLogRepository creates a new PostgreSQL repository for codelog entities
+func NewCodeLogRepository(db *sql.DB) codelog.Repository {
+	return &codelogRepo{db: db}
+}
+
+func (r *codelogRepo) Create(ctx context.Context, cl *codelog.CodeLog) (*codelog.CodeLog, error) {
+	query := `
+		INSERT INTO codelogs (run_id, code_id, type, content, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	if cl.CreatedAt.IsZero() {
+		cl.CreatedAt = time.Now()
+	}
+	cl.UpdatedAt = time.Now()
+
+	var id string
+	err := r.db.QueryRowContext(ctx, query,
+		cl.RunID,
+		cl.CodeID,
+		cl.Type,
+		cl.Content,
+		cl.CreatedAt,
+		cl.UpdatedAt,
+	).Scan(&id)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating codelog")
+	}
+
+	cl.ID = id
+	return cl, nil
+}
+
+func (r *codelogRepo) GetByID(ctx context.Context, id string) (*codelog.CodeLog, error) {
+	query := `
+		SELECT id, run_id, code_id, type, content, created_at, updated_at
+		FROM codelogs
+		WHERE id::text = $1`
+
+	cl := &codelog.CodeLog{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&cl.ID,
+		&cl.RunID,
+		&cl.CodeID,
+		&cl.Type,
+		&cl.Content,
+		&cl.CreatedAt,
+		&cl.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("codelog not found")
+		}
+		return nil, errors.Wrap(err, "error getting codelog by id")
+	}
+
+	return cl, nil
+}
+
+func (r *codelogRepo) ListRunLogs(ctx context.Context, runID string, codeID string, limit, page int) ([]codelog.CodeLog, error) {
+	if runID == "" && codeID == "" {
+		return nil, errors.New("must specify a run ID or a code ID")
+	}
+
+	where, args := runLogsFilter(runID, codeID)
+	query := `
+		SELECT id, run_id, code_id, type, content, created_at, updated_at
+		FROM codelogs
+		WHERE ` + where + ` ORDER BY created_at ASC`
+
+	if limit > 0 {
+		if page < 1 {
+			page = 1
+		}
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+		args = append(args, limit, (page-1)*limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing codelogs")
+	}
+	defer rows.Close()
+
+	logs := []codelog.CodeLog{}
+	for rows.Next() {
+		var cl codelog.CodeLog
+		err := rows.Scan(
+			&cl.ID,
+			&cl.RunID,
+			&cl.CodeID,
+			&cl.Type,
+			&cl.Content,
+			&cl.CreatedAt,
+			&cl.UpdatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning codelog row")
+		}
+		logs = append(logs, cl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating codelog rows")
+	}
+
+	return logs, nil
+}
+
+func (r *codelogRepo) Count(ctx context.Context, runID, codeID string) (int64, error) {
+	if runID == "" && codeID == "" {
+		return 0, errors.New("must specify a run ID or a code ID")
+	}
+
+	where, args := runLogsFilter(runID, codeID)
+	query := `SELECT COUNT(*) FROM codelogs WHERE ` + where
+
+	var count int64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "error counting codelogs")
+	}
+	return count, nil
+}
+
+func (r *codelogRepo) Update(ctx context.Context, id string, content string) (*codelog.CodeLog, error) {
+	query := `
+		UPDATE codelogs
+		SET content = $2, updated_at = $3
+		WHERE id::text = $1
+		RETURNING id, run_id, code_id, type, content, created_at, updated_at`
+
+	cl := &codelog.CodeLog{}
+	err := r.db.QueryRowContext(ctx, query, id, content, time.Now()).Scan(
+		&cl.ID,
+		&cl.RunID,
+		&cl.CodeID,
+		&cl.Type,
+		&cl.Content,
+		&cl.CreatedAt,
+		&cl.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("codelog not found")
+		}
+		return nil, errors.Wrap(err, "error updating codelog")
+	}
+
+	return cl, nil
+}
+
+func (r *codelogRepo) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM codelogs WHERE id::text = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return errors.Wrap(err, "error deleting codelog")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("codelog not found")
+	}
+
+	return nil
+}
+
+func (r *codelogRepo) DeleteOlder(ctx context.Context, date time.Time, limit int64) (int64, error) {
+	query := `
+		DELETE FROM codelogs
+		WHERE id IN (
+			SELECT id FROM codelogs
+			WHERE created_at < $1
+			ORDER BY created_at ASC
+			LIMIT $2
+		)`
+
+	result, err := r.db.ExecContext(ctx, query, date, limit)
+	if err != nil {
+		return 0, errors.Wrap(err, "error deleting older codelogs")
+	}
+
+	deletedCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting deleted count")
+	}
+
+	return deletedCount, nil
+}
+
+// runLogsFilter builds the WHERE clause shared by ListRunLogs and Count
+func runLogsFilter(runID, codeID string) (string, []interface{}) {
+	switch {
+	case runID != "" && codeID != "":
+		return "run_id = $1 AND code_id = $2", []interface{}{runID, codeID}
+	case runID != "":
+		return "run_id = $1", []interface{}{runID}
+	default:
+		return "code_id = $1", []interface{}{codeID}
+	}
+}
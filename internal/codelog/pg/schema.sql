@@ -0,0 +1,26 @@
+-- PostgreSQL schema for codelogs table (postgres-first strategy)
+-- Stores log entries emitted by code executions
+
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+CREATE TABLE IF NOT EXISTS codelogs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id TEXT NOT NULL,
+    code_id TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('debug', 'info', 'error')),
+    content TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_codelogs_run_id ON codelogs(run_id);
+CREATE INDEX IF NOT EXISTS idx_codelogs_code_id ON codelogs(code_id);
+CREATE INDEX IF NOT EXISTS idx_codelogs_run_id_code_id ON codelogs(run_id, code_id);
+CREATE INDEX IF NOT EXISTS idx_codelogs_created_at ON codelogs(created_at);
+
+-- Comments
+COMMENT ON TABLE codelogs IS 'Stores log entries emitted by code executions';
+COMMENT ON COLUMN codelogs.id IS 'Primary key (PostgreSQL native UUID)';
+COMMENT ON COLUMN codelogs.run_id IS 'Reference to the coderun (PostgreSQL UUID or MongoDB ObjectID)';
+COMMENT ON COLUMN codelogs.code_id IS 'Reference to the code (PostgreSQL UUID or MongoDB ObjectID)';
@@ -115,9 +115,11 @@ func (r *codelogRepo) Create(ctx context.Context, log *codelog.CodeLog) (*codelo
 		log.ID = primitive.NewObjectID().Hex()
 	}
 
-	// Set timestamps
+	// Set timestamps, keeping the creation time reported by the engine if any
 	now := time.Now()
-	log.CreatedAt = now
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = now
+	}
 	log.UpdatedAt = now
 
 	// Serialize log to JSON
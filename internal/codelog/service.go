@@ -10,6 +10,9 @@ import (
 	"github.com/weni-ai/flows-code-actions/config"
 )
 
+// maxContentSize is the max length of a log content
+const maxContentSize = 8000
+
 type Service struct {
 	repo Repository
 }
@@ -19,7 +22,9 @@ func NewCodeLogService(repo Repository) *Service {
 }
 
 func (s *Service) Create(ctx context.Context, codelog *CodeLog) (*CodeLog, error) {
-	codelog.Content = codelog.Content[:8000]
+	if len(codelog.Content) > maxContentSize {
+		codelog.Content = codelog.Content[:maxContentSize]
+	}
 	return s.repo.Create(ctx, codelog)
 }
 
@@ -25,6 +25,7 @@ type CodeRun struct {
 
 	CodeID        string                 `bson:"code_id" json:"code_id"`           // PostgreSQL UUID or MongoDB ObjectID
 	CodeMongoID   string                 `json:"code_mongo_id,omitempty"`          // MongoDB ObjectID of the code
+	CodeVersion   int                    `bson:"code_version,omitempty" json:"code_version,omitempty"` // version of the code source executed
 	Status        CodeRunStatus          `bson:"status" json:"status"`
 	Result        string                 `bson:"result" json:"result"`
 	Extra         map[string]interface{} `bson:"extra" json:"extra"`
@@ -57,6 +58,10 @@ func (c *CodeRun) StatusCode() (int, error) {
 			return v, nil
 		case int32:
 			return int(v), nil
+		case int64:
+			return int(v), nil
+		case float64:
+			return int(v), nil
 		case string:
 			if scInt, err := strconv.Atoi(v); err == nil {
 				return scInt, nil
@@ -45,8 +45,8 @@ func (r *codeRunRepo) Create(ctx context.Context, cr *coderun.CodeRun) (*coderun
 	}
 
 	query := `
-		INSERT INTO coderuns (mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at)
-		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO coderuns (mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at, code_version)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id`
 
 	// Marshal JSON fields
@@ -78,6 +78,7 @@ func (r *codeRunRepo) Create(ctx context.Context, cr *coderun.CodeRun) (*coderun
 		headersJSON,
 		cr.CreatedAt,
 		cr.UpdatedAt,
+		nullInt(cr.CodeVersion),
 	).Scan(&id)
 
 	if err != nil {
@@ -90,7 +91,7 @@ func (r *codeRunRepo) Create(ctx context.Context, cr *coderun.CodeRun) (*coderun
 
 func (r *codeRunRepo) GetByID(ctx context.Context, id string) (*coderun.CodeRun, error) {
 	query := `
-		SELECT id, mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at
+		SELECT id, mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at, code_version
 		FROM coderuns
 		WHERE `
 
@@ -102,6 +103,7 @@ func (r *codeRunRepo) GetByID(ctx context.Context, id string) (*coderun.CodeRun,
 
 	cr := &coderun.CodeRun{}
 	var mongoObjectID, codeID, codeMongoID sql.NullString
+	var codeVersion sql.NullInt64
 	var extraJSON, paramsJSON, headersJSON []byte
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
@@ -117,6 +119,7 @@ func (r *codeRunRepo) GetByID(ctx context.Context, id string) (*coderun.CodeRun,
 		&headersJSON,
 		&cr.CreatedAt,
 		&cr.UpdatedAt,
+		&codeVersion,
 	)
 
 	if err != nil {
@@ -129,6 +132,7 @@ func (r *codeRunRepo) GetByID(ctx context.Context, id string) (*coderun.CodeRun,
 	if mongoObjectID.Valid {
 		cr.MongoObjectID = mongoObjectID.String
 	}
+	cr.CodeVersion = int(codeVersion.Int64)
 	if codeID.Valid {
 		cr.CodeID = codeID.String
 	}
@@ -156,7 +160,7 @@ func (r *codeRunRepo) ListByCodeID(ctx context.Context, codeID string, filter ma
 	// Search by code_id (UUID) or code_mongo_id (MongoDB ObjectID)
 	// Use explicit casting for UUID comparison
 	query := `
-		SELECT id, mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at
+		SELECT id, mongo_object_id, code_id, code_mongo_id, status, result, extra, params, body, headers, created_at, updated_at, code_version
 		FROM coderuns
 		WHERE `
 
@@ -198,6 +202,7 @@ func (r *codeRunRepo) ListByCodeID(ctx context.Context, codeID string, filter ma
 	for rows.Next() {
 		cr := coderun.CodeRun{}
 		var mongoObjectID, dbCodeID, codeMongoID sql.NullString
+		var codeVersion sql.NullInt64
 		var extraJSON, paramsJSON, headersJSON []byte
 
 		err := rows.Scan(
@@ -213,6 +218,7 @@ func (r *codeRunRepo) ListByCodeID(ctx context.Context, codeID string, filter ma
 			&headersJSON,
 			&cr.CreatedAt,
 			&cr.UpdatedAt,
+			&codeVersion,
 		)
 		if err != nil {
 			return nil, errors.Wrap(err, "error scanning coderun row")
@@ -221,6 +227,7 @@ func (r *codeRunRepo) ListByCodeID(ctx context.Context, codeID string, filter ma
 		if mongoObjectID.Valid {
 			cr.MongoObjectID = mongoObjectID.String
 		}
+		cr.CodeVersion = int(codeVersion.Int64)
 		if dbCodeID.Valid {
 			cr.CodeID = dbCodeID.String
 		}
@@ -275,7 +282,7 @@ func (r *codeRunRepo) Update(ctx context.Context, id string, cr *coderun.CodeRun
 	query := `
 		UPDATE coderuns
 		SET mongo_object_id = $2, code_id = NULLIF($3, '')::uuid, code_mongo_id = $4, status = $5, result = $6, 
-		    extra = $7, params = $8, body = $9, headers = $10, updated_at = $11
+		    extra = $7, params = $8, body = $9, headers = $10, updated_at = $11, code_version = $12
 		WHERE `
 
 	if util.IsUUID(id) {
@@ -315,6 +322,7 @@ func (r *codeRunRepo) Update(ctx context.Context, id string, cr *coderun.CodeRun
 		cr.Body,
 		headersJSON,
 		cr.UpdatedAt,
+		nullInt(cr.CodeVersion),
 	).Scan(&returnedID)
 
 	if err != nil {
@@ -356,6 +364,14 @@ func nullString(s string) sql.NullString {
 	return sql.NullString{String: s, Valid: true}
 }
 
+// nullInt converts a zero int to a NULL value
+func nullInt(i int) sql.NullInt64 {
+	if i == 0 {
+		return sql.NullInt64{Valid: false}
+	}
+	return sql.NullInt64{Int64: int64(i), Valid: true}
+}
+
 func (r *codeRunRepo) DeleteOlder(ctx context.Context, date time.Time, limit int64) (int64, error) {
 	query := `
 		DELETE FROM coderuns
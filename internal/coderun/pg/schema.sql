@@ -14,6 +14,7 @@ CREATE TABLE IF NOT EXISTS coderuns (
     params JSONB DEFAULT '{}'::jsonb,
     body TEXT,
     headers JSONB DEFAULT '{}'::jsonb,
+    code_version INTEGER,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
@@ -40,3 +41,4 @@ COMMENT ON COLUMN coderuns.status IS 'Execution status: queued, started, complet
 COMMENT ON COLUMN coderuns.extra IS 'Extra metadata (e.g., status_code, content_type)';
 COMMENT ON COLUMN coderuns.params IS 'Execution parameters';
 COMMENT ON COLUMN coderuns.headers IS 'HTTP headers for endpoint executions';
+COMMENT ON COLUMN coderuns.code_version IS 'Version of the code source executed by the run';
@@ -0,0 +1,292 @@
+package coderunner
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/metrics"
+)
+
+// artifactBuildTimeout bounds the build of an artifact, which goes on when the runs waiting for it end
+const artifactBuildTimeout = 5 * time.Minute
+
+// artifacts is the cache of the artifacts prepared by the runtimes, set up by configureRuntimes
+var artifacts *artifactCache
+
+// artifactCache keeps the artifacts prepared for the runs, like compiled binaries and python bytecode, on the
+// local disk. Artifacts are directories addressed by their language and the hash of what they are built from,
+// so they are built once and shared by the codes with the same source. The least recently used artifacts are
+// removed when the cache grows over its size limit, but for the ones in use by a run
+type artifactCache struct {
+	dir     string
+	maxSize int64
+
+	loadOnce sync.Once
+	mu       sync.Mutex
+	entries  map[string]*artifactEntry
+	// lru holds the entries from the most to the least recently used
+	lru    *list.List
+	size   int64
+	builds map[string]*artifactBuild
+}
+
+type artifactEntry struct {
+	language string
+	key      string
+	size     int64
+	refs     int
+	elem     *list.Element
+}
+
+// artifactBuild is a build of an artifact, shared by the runs waiting for it
+type artifactBuild struct {
+	done chan struct{}
+	err  error
+	// entry is the built artifact, in use by each of the waiters left once done
+	entry   *artifactEntry
+	waiters int
+}
+
+func newArtifactCache(dir string, maxSize int64) *artifactCache {
+	return &artifactCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: map[string]*artifactEntry{},
+		lru:     list.New(),
+		builds:  map[string]*artifactBuild{},
+	}
+}
+
+// artifactHash is the content address of an artifact built from the given parts
+func artifactHash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// artifact returns the directory of the artifact of the language with the given hash, building it on a miss
+// on a temporary directory moved into the cache once done. The build runs on a context of its own, so it is
+// not failed for every run waiting for it when one of them ends. The artifact is kept until released, even
+// when the cache must evict it meanwhile
+func (c *artifactCache) artifact(ctx context.Context, language string, hash string, build func(ctx context.Context, dir string) error) (string, func(), error) {
+	c.loadOnce.Do(c.load)
+	key := filepath.Join(language, hash)
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		c.mu.Unlock()
+		metrics.AddArtifactCacheHit(language)
+		// the modification time keeps the recency of the artifacts across restarts
+		now := time.Now()
+		os.Chtimes(c.path(key), now, now)
+		return c.path(key), c.releaser(entry), nil
+	}
+	b, ok := c.builds[key]
+	if !ok {
+		b = &artifactBuild{done: make(chan struct{})}
+		c.builds[key] = b
+		metrics.AddArtifactCacheMiss(language)
+		go c.build(language, key, b, build)
+	}
+	b.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-b.done:
+		if b.err != nil {
+			return "", nil, b.err
+		}
+		return c.path(key), c.releaser(b.entry), nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		select {
+		case <-b.done:
+			if b.entry != nil {
+				b.entry.refs--
+				c.evict()
+			}
+		default:
+			b.waiters--
+		}
+		c.mu.Unlock()
+		return "", nil, errors.Wrap(ctx.Err(), "timeout waiting for artifact build")
+	}
+}
+
+// build builds the artifact and adds it to the cache, in use by the runs still waiting for it
+func (c *artifactCache) build(language string, key string, b *artifactBuild, build func(ctx context.Context, dir string) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), artifactBuildTimeout)
+	defer cancel()
+	size, err := c.buildDir(ctx, key, build)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.builds, key)
+	if err == nil {
+		b.entry = c.add(language, key, size)
+		b.entry.refs = b.waiters
+		c.evict()
+	}
+	b.err = err
+	close(b.done)
+}
+
+// buildDir builds the artifact on a temporary directory moved to its path, returning its size
+func (c *artifactCache) buildDir(ctx context.Context, key string, build func(ctx context.Context, dir string) error) (int64, error) {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, errors.Wrap(err, "error creating artifact cache directory")
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".build-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return 0, err
+	}
+	if err := build(ctx, tmpDir); err != nil {
+		return 0, err
+	}
+	size, err := dirSize(tmpDir)
+	if err != nil {
+		return 0, err
+	}
+	os.RemoveAll(path)
+	if err := os.Rename(tmpDir, path); err != nil {
+		return 0, errors.Wrap(err, "error on caching artifact")
+	}
+	return size, nil
+}
+
+// releaser returns the function a run calls once it no longer uses the artifact
+func (c *artifactCache) releaser(entry *artifactEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			entry.refs--
+			c.evict()
+		})
+	}
+}
+
+func (c *artifactCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// add inserts the entry as the most recently used
+func (c *artifactCache) add(language string, key string, size int64) *artifactEntry {
+	entry := &artifactEntry{language: language, key: key, size: size}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[key] = entry
+	c.size += size
+	metrics.SetArtifactCacheSize(float64(c.size))
+	return entry
+}
+
+// evict removes the least recently used artifacts not in use until the cache fits its size limit
+func (c *artifactCache) evict() {
+	if c.maxSize <= 0 {
+		return
+	}
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxSize; {
+		entry := elem.Value.(*artifactEntry)
+		prev := elem.Prev()
+		if entry.refs == 0 && c.entries[entry.key] == entry {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.key)
+			c.size -= entry.size
+			if err := os.RemoveAll(c.path(entry.key)); err != nil {
+				log.WithError(err).Warn("error on removing cached artifact")
+			}
+			metrics.AddArtifactCacheEviction(entry.language)
+		}
+		elem = prev
+	}
+	metrics.SetArtifactCacheSize(float64(c.size))
+}
+
+// load indexes the artifacts left on disk by a previous run of the server, ordered by their last use
+func (c *artifactCache) load() {
+	type found struct {
+		language string
+		key      string
+		size     int64
+		usedAt   time.Time
+	}
+	var loaded []found
+	languages, err := os.ReadDir(c.dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("error on loading artifact cache")
+	}
+	for _, language := range languages {
+		if !language.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(c.dir, language.Name()))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			key := filepath.Join(language.Name(), e.Name())
+			// leftovers of builds interrupted by a restart
+			if strings.HasPrefix(e.Name(), ".") {
+				os.RemoveAll(c.path(key))
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || !e.IsDir() {
+				continue
+			}
+			size, err := dirSize(c.path(key))
+			if err != nil {
+				continue
+			}
+			loaded = append(loaded, found{language.Name(), key, size, info.ModTime()})
+		}
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].usedAt.Before(loaded[j].usedAt) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, a := range loaded {
+		c.add(a.language, a.key, a.size)
+	}
+	c.evict()
+}
+
+// dirSize returns the size of the regular files under the directory
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,143 @@
+package coderunner
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := newArtifactCache(dir, 6)
+	builds := 0
+	build := func(content string) func(context.Context, string) error {
+		return func(ctx context.Context, dir string) error {
+			builds++
+			return os.WriteFile(filepath.Join(dir, "artifact"), []byte(content), 0644)
+		}
+	}
+	ctx := context.Background()
+
+	a, releaseA, err := cache.artifact(ctx, "go", artifactHash("a"), build("aaaa"))
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(filepath.Join(a, "artifact"))
+	assert.Equal(t, "aaaa", string(data))
+	_, releaseHit, err := cache.artifact(ctx, "go", artifactHash("a"), build("aaaa"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, builds)
+	releaseA()
+	releaseHit()
+
+	b, releaseB, err := cache.artifact(ctx, "go", artifactHash("b"), build("bbbb"))
+	assert.NoError(t, err)
+	// an artifact in use is kept over the size limit
+	c, releaseC, err := cache.artifact(ctx, "python", artifactHash("c"), build("cccc"))
+	assert.NoError(t, err)
+	assert.NoDirExists(t, a)
+	assert.DirExists(t, b)
+	assert.Equal(t, int64(8), cache.size)
+
+	releaseB()
+	releaseB()
+	assert.NoDirExists(t, b)
+	assert.DirExists(t, c)
+	assert.Equal(t, int64(4), cache.size)
+	releaseC()
+
+	_, _, err = cache.artifact(ctx, "go", artifactHash("d"), func(ctx context.Context, dir string) error { return assert.AnError })
+	assert.Equal(t, assert.AnError, err)
+	entries, _ := os.ReadDir(filepath.Join(dir, "go"))
+	assert.Len(t, entries, 0)
+
+	// artifacts left on disk are loaded, the least recently used ones first evicted
+	old := filepath.Join(dir, "go", artifactHash("old"))
+	assert.NoError(t, os.MkdirAll(old, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(old, "artifact"), []byte("old"), 0644))
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(old, past, past))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "go", ".build-1"), 0755))
+
+	cache = newArtifactCache(dir, 6)
+	e, release, err := cache.artifact(ctx, "go", artifactHash("e"), build("eeee"))
+	assert.NoError(t, err)
+	release()
+	assert.NoDirExists(t, old)
+	assert.NoDirExists(t, filepath.Join(dir, "go", ".build-1"))
+	assert.NoDirExists(t, c)
+	assert.DirExists(t, e)
+	assert.Equal(t, int64(4), cache.size)
+}
+
+func TestArtifactCacheSharedBuild(t *testing.T) {
+	cache := newArtifactCache(t.TempDir(), 0)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	build := func(ctx context.Context, dir string) error {
+		close(started)
+		select {
+		case <-finish:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return os.WriteFile(filepath.Join(dir, "artifact"), []byte("a"), 0644)
+	}
+
+	// the run starting the build ends before it is done, which does not fail the other runs waiting for it
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := cache.artifact(ctx, "go", artifactHash("a"), build)
+		errs <- err
+	}()
+	<-started
+	type result struct {
+		dir     string
+		release func()
+		err     error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		dir, release, err := cache.artifact(context.Background(), "go", artifactHash("a"), build)
+		waiter <- result{dir, release, err}
+	}()
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	close(finish)
+	r := <-waiter
+	assert.NoError(t, r.err)
+	assert.FileExists(t, filepath.Join(r.dir, "artifact"))
+	assert.Equal(t, 1, cache.entries[filepath.Join("go", artifactHash("a"))].refs)
+	r.release()
+	assert.Equal(t, 0, cache.entries[filepath.Join("go", artifactHash("a"))].refs)
+}
+
+func TestCopyPythonBytecode(t *testing.T) {
+	if _, err := exec.LookPath("python"); err != nil {
+		t.Skip("python is not installed")
+	}
+	cache := artifacts
+	artifacts = newArtifactCache(t.TempDir(), 0)
+	defer func() { artifacts = cache }()
+
+	source := "value = 42\n"
+	workDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "action.py"), []byte(source), 0644))
+	assert.NoError(t, copyPythonBytecode(context.Background(), source, workDir))
+	assert.FileExists(t, filepath.Join(workDir, "__pycache__", "action."+pythonCacheTag+".pyc"))
+
+	cmd := exec.Command("python", "-v", "-c", "import action; print(action.value)")
+	cmd.Dir = workDir
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "code object from")
+	assert.Contains(t, strings.Split(string(out), "\n"), "42")
+
+	assert.Error(t, copyPythonBytecode(context.Background(), "def broken(:\n", t.TempDir()))
+}
@@ -0,0 +1,309 @@
+package coderunner
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/cgroups/v3"
+	"github.com/containerd/cgroups/v3/cgroup1"
+	"github.com/containerd/cgroups/v3/cgroup2"
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/config"
+	"golang.org/x/sys/unix"
+)
+
+// cgroupMountpoint is where the unified cgroup v2 hierarchy is mounted
+const cgroupMountpoint = "/sys/fs/cgroup"
+
+// cpuPeriod is the period of the cpu quota, in microseconds, the kernel default
+const cpuPeriod = uint64(100000)
+
+// RunUsage is the resource usage of a run, read from its cgroup when the engine exits
+type RunUsage struct {
+	// PeakMemory is the maximum memory used, in bytes
+	PeakMemory uint64
+	// CPUTime is the user and system cpu time, in seconds
+	CPUTime float64
+	// OOMKilled is set when a process of the run was killed for exceeding the memory limit
+	OOMKilled bool
+}
+
+// extra is the usage as recorded on the code run extra
+func (u *RunUsage) extra() map[string]interface{} {
+	return map[string]interface{}{
+		"peak_memory": int64(u.PeakMemory),
+		"cpu_time":    u.CPUTime,
+		"oom_killed":  u.OOMKilled,
+	}
+}
+
+// runCgroup limits and accounts the engine processes of a single run
+type runCgroup interface {
+	// prepare sets the command to be started inside the cgroup, when the cgroup version allows it
+	prepare(cmd *exec.Cmd) error
+	// attach moves the started engine process into the cgroup, when it could not be started inside it
+	attach(pid int) error
+	// usage reads the resources used by the run
+	usage() (*RunUsage, error)
+	// delete kills the processes left by the engine and removes the cgroup
+	delete() error
+}
+
+// newRunCgroup creates the cgroup of the run under the configured parent, with the configured limits
+func newRunCgroup(conf *config.Config, runID string) (runCgroup, error) {
+	group := path.Join("/", conf.ResourceManagement.CgroupParent, runID)
+	if cgroups.Mode() == cgroups.Unified {
+		return newCgroup2Run(conf, group)
+	}
+	return newCgroup1Run(conf, group)
+}
+
+// cgroup2Run is a cgroup v2 run cgroup, the engine is cloned directly into it
+type cgroup2Run struct {
+	manager *cgroup2.Manager
+	path    string
+	dir     *os.File
+}
+
+func newCgroup2Run(conf *config.Config, group string) (*cgroup2Run, error) {
+	resources := cgroup2Resources(conf)
+	if err := delegateCgroup2(conf.ResourceManagement.CgroupParent, resources.EnabledControllers()); err != nil {
+		return nil, errors.Wrap(err, "failed to delegate cgroup controllers")
+	}
+	manager, err := cgroup2.NewManager(cgroupMountpoint, group, resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cgroup")
+	}
+	return &cgroup2Run{manager: manager, path: filepath.Join(cgroupMountpoint, group)}, nil
+}
+
+func (c *cgroup2Run) prepare(cmd *exec.Cmd) error {
+	dir, err := os.Open(c.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open cgroup")
+	}
+	c.dir = dir
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return nil
+}
+
+// attach only releases the cgroup dir when the engine was started inside the cgroup, and otherwise moves
+// the engine into it, as the runs forked by the warm python workers
+func (c *cgroup2Run) attach(pid int) error {
+	if c.dir == nil {
+		return c.manager.AddProc(uint64(pid))
+	}
+	return c.closeDir()
+}
+
+func (c *cgroup2Run) usage() (*RunUsage, error) {
+	metrics, err := c.manager.Stat()
+	if err != nil {
+		return nil, err
+	}
+	usage := &RunUsage{}
+	if metrics.Memory != nil {
+		// memory.peak is only available from linux 5.19
+		usage.PeakMemory = metrics.Memory.MaxUsage
+	}
+	if metrics.CPU != nil {
+		usage.CPUTime = float64(metrics.CPU.UsageUsec) / 1e6
+	}
+	if metrics.MemoryEvents != nil {
+		usage.OOMKilled = metrics.MemoryEvents.OomKill > 0
+	}
+	return usage, nil
+}
+
+func (c *cgroup2Run) delete() error {
+	c.closeDir()
+	procs, err := c.manager.Procs(true)
+	if err != nil {
+		return err
+	}
+	if len(procs) > 0 {
+		if err := c.manager.Kill(); err != nil {
+			return err
+		}
+	}
+	return retryCgroupDelete(c.manager.Delete)
+}
+
+func (c *cgroup2Run) closeDir() error {
+	if c.dir == nil {
+		return nil
+	}
+	err := c.dir.Close()
+	c.dir = nil
+	return err
+}
+
+// cgroup2Resources converts the resource config to cgroup v2 limits
+func cgroup2Resources(conf *config.Config) *cgroup2.Resources {
+	resources := cgroup2.ToResources(ResourceConfig(conf))
+	if quota := conf.ResourceManagement.CPU.Quota; quota != nil {
+		period := cpuPeriod
+		if resources.CPU == nil {
+			resources.CPU = &cgroup2.CPU{}
+		}
+		resources.CPU.Max = cgroup2.NewCPUMax(quota, &period)
+	}
+	return resources
+}
+
+var cgroup2Delegation struct {
+	once sync.Once
+	err  error
+}
+
+// delegateCgroup2 enables the controllers on the cgroup of the runner when the run cgroups are nested in
+// it, as when the runner is the root of a container cgroup namespace. Controllers can't be enabled on a
+// cgroup with processes, but on the root one, so the processes of the runner cgroup are moved to a leaf
+func delegateCgroup2(parent string, controllers []string) error {
+	cgroup2Delegation.once.Do(func() {
+		if len(controllers) == 0 {
+			return
+		}
+		data, err := os.ReadFile("/proc/self/cgroup")
+		if err != nil {
+			cgroup2Delegation.err = err
+			return
+		}
+		own := unifiedCgroupPath(string(data))
+		if own == "" || !isCgroupAncestor(own, path.Join("/", parent)) {
+			return
+		}
+		ownDir := filepath.Join(cgroupMountpoint, own)
+		err = enableControllers(ownDir, controllers)
+		if errors.Is(err, unix.EBUSY) {
+			if err = moveCgroupProcs(ownDir, filepath.Join(ownDir, "runner")); err == nil {
+				err = enableControllers(ownDir, controllers)
+			}
+		}
+		cgroup2Delegation.err = err
+	})
+	return cgroup2Delegation.err
+}
+
+// unifiedCgroupPath returns the cgroup v2 path of a /proc/<pid>/cgroup file
+func unifiedCgroupPath(procCgroup string) string {
+	for _, line := range strings.Split(procCgroup, "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::")
+		}
+	}
+	return ""
+}
+
+// isCgroupAncestor reports if the group is the parent or an ancestor of child
+func isCgroupAncestor(group string, child string) bool {
+	if group == "/" {
+		return child != "/"
+	}
+	return strings.HasPrefix(child, group+"/")
+}
+
+func enableControllers(dir string, controllers []string) error {
+	values := make([]string, len(controllers))
+	for i, controller := range controllers {
+		values[i] = "+" + controller
+	}
+	return os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(values, " ")), 0)
+}
+
+func moveCgroupProcs(from string, to string) error {
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		err := os.WriteFile(filepath.Join(to, "cgroup.procs"), []byte(pid), 0)
+		// processes may exit meanwhile
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cgroup1Run is a cgroup v1 run cgroup. Processes can't be started inside v1 cgroups, so the engine
+// is only limited once attached, right after it is started
+type cgroup1Run struct {
+	cg cgroup1.Cgroup
+}
+
+func newCgroup1Run(conf *config.Config, group string) (*cgroup1Run, error) {
+	cg, err := cgroup1.New(cgroup1.StaticPath(group), ResourceConfig(conf))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cgroup")
+	}
+	return &cgroup1Run{cg: cg}, nil
+}
+
+func (c *cgroup1Run) prepare(cmd *exec.Cmd) error {
+	return nil
+}
+
+func (c *cgroup1Run) attach(pid int) error {
+	return c.cg.AddProc(uint64(pid))
+}
+
+func (c *cgroup1Run) usage() (*RunUsage, error) {
+	metrics, err := c.cg.Stat(cgroup1.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+	usage := &RunUsage{}
+	if metrics.Memory != nil && metrics.Memory.Usage != nil {
+		usage.PeakMemory = metrics.Memory.Usage.Max
+	}
+	if metrics.CPU != nil && metrics.CPU.Usage != nil {
+		usage.CPUTime = float64(metrics.CPU.Usage.Total) / 1e9
+	}
+	if metrics.MemoryOomControl != nil {
+		usage.OOMKilled = metrics.MemoryOomControl.OomKill > 0
+	}
+	return usage, nil
+}
+
+func (c *cgroup1Run) delete() error {
+	if subsystems := c.cg.Subsystems(); len(subsystems) > 0 {
+		procs, err := c.cg.Processes(subsystems[0].Name(), true)
+		if err != nil {
+			return err
+		}
+		for _, proc := range procs {
+			syscall.Kill(proc.Pid, syscall.SIGKILL)
+		}
+	}
+	return retryCgroupDelete(c.cg.Delete)
+}
+
+// retryCgroupDelete retries removing a cgroup for a while, since killed processes leave it asynchronously
+func retryCgroupDelete(remove func() error) error {
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = remove(); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package coderunner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+)
+
+func TestUnifiedCgroupPath(t *testing.T) {
+	assert.Equal(t, "/", unifiedCgroupPath("0::/\n"))
+	assert.Equal(t, "/system.slice/codeactions.service", unifiedCgroupPath("1:name=systemd:/\n0::/system.slice/codeactions.service\n"))
+	assert.Equal(t, "", unifiedCgroupPath("4:memory:/\n1:cpu:/\n"))
+
+	assert.True(t, isCgroupAncestor("/", "/codeactions"))
+	assert.True(t, isCgroupAncestor("/app", "/app/codeactions"))
+	assert.False(t, isCgroupAncestor("/app", "/application/codeactions"))
+	assert.False(t, isCgroupAncestor("/system.slice", "/codeactions"))
+}
+
+func TestCgroup2Resources(t *testing.T) {
+	resourceConfig = nil
+	defer func() { resourceConfig = nil }()
+
+	quota := int64(50000)
+	limit := int64(128 << 20)
+	resources := cgroup2Resources(&config.Config{ResourceManagement: config.ResourceConfig{
+		CPU:    config.CPUConfig{Quota: &quota},
+		Memory: config.MemoryConfig{Limit: &limit},
+	}})
+	assert.Equal(t, "50000 100000", string(resources.CPU.Max))
+	assert.Equal(t, limit, *resources.Memory.Max)
+	assert.ElementsMatch(t, []string{"cpu", "memory"}, resources.EnabledControllers())
+}
+
+func TestRunUsageExtra(t *testing.T) {
+	usage := &RunUsage{PeakMemory: 64 << 20, CPUTime: 0.25, OOMKilled: true}
+	assert.Equal(t, map[string]interface{}{
+		"peak_memory": int64(64 << 20),
+		"cpu_time":    0.25,
+		"oom_killed":  true,
+	}, usage.extra())
+}
@@ -4,16 +4,44 @@ import (
 	"context"
 
 	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/project"
 )
 
 type UseCase interface {
 	RunCode(
 		ctx context.Context,
 		codeID string,
+		codeVersion int,
 		code string,
 		language string,
 		params map[string]interface{},
 		body string,
 		headers map[string]interface{},
 	) (*coderun.CodeRun, error)
+	// QueueCode creates a queued code run, to be executed later by RunQueued
+	QueueCode(
+		ctx context.Context,
+		codeID string,
+		codeVersion int,
+		params map[string]interface{},
+		body string,
+		headers map[string]interface{},
+	) (*coderun.CodeRun, error)
+	// RunQueued executes a code run created by QueueCode
+	RunQueued(ctx context.Context, run *coderun.CodeRun, code string, language string) (*coderun.CodeRun, error)
+	// FailRun marks a code run that could not be executed as failed
+	FailRun(ctx context.Context, run *coderun.CodeRun, reason error) (*coderun.CodeRun, error)
+}
+
+// CodeSettings returns the settings of a code that change how its runs are executed: the pinned python
+// libraries and the network policy of its project, and whether sandboxed runs keep the network access
+type CodeSettings interface {
+	PythonRequirements(ctx context.Context, codeID string) ([]string, error)
+	AllowEgress(ctx context.Context, codeID string) (bool, error)
+	EgressPolicy(ctx context.Context, codeID string) (*project.EgressPolicy, error)
+}
+
+// SecretResolver returns the decrypted secrets available to a code by name
+type SecretResolver interface {
+	ResolveSecrets(ctx context.Context, codeID string) (map[string]string, error)
 }
@@ -0,0 +1,67 @@
+package coderunner
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/codelog"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+// proxyEnvNames are the variables the http clients of the engines, like python requests, the go net/http
+// and curl, take the proxy from. Node only honors them when NODE_USE_ENV_PROXY is set
+var proxyEnvNames = []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy", "ALL_PROXY", "all_proxy"}
+
+// SetEgressProxy makes the engines connect through the proxy enforcing the network policy of the code projects
+func (s *Service) SetEgressProxy(proxy *egress.Proxy) {
+	s.proxy = proxy
+}
+
+// resolveEgressPolicy loads the network policy of the run code project, when there is an egress proxy to enforce it
+func (s *Service) resolveEgressPolicy(ctx context.Context, run *Run) error {
+	if s.proxy == nil {
+		return nil
+	}
+	run.EgressPolicy = &project.EgressPolicy{}
+	if s.settings == nil {
+		return nil
+	}
+	policy, err := s.settings.EgressPolicy(ctx, run.CodeID)
+	if err != nil {
+		return errors.Wrap(err, "error on resolving egress policy")
+	}
+	run.EgressPolicy = policy
+	return nil
+}
+
+// registerEgress allows the run on the egress proxy under its project policy, saving the connections it
+// blocks as error logs of the run. It returns the proxy url of the run
+func (s *Service) registerEgress(ctx context.Context, run *Run) (string, error) {
+	policy, err := egress.NewPolicy(run.EgressPolicy)
+	if err != nil {
+		return "", errors.Wrap(err, "error on compiling egress policy")
+	}
+	logCtx := context.WithoutCancel(ctx)
+	token, err := s.proxy.Register(policy, func(reason string) {
+		log.WithField("code_id", run.CodeID).WithField("run_id", run.RunID).Warn(reason)
+		s.saveEngineLog(logCtx, run.CodeID, run.RunID, engineMessage{LogType: string(codelog.TypeError), Content: reason})
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error on registering run on egress proxy")
+	}
+	run.EgressProxy = s.proxy.Addr()
+	run.EgressSocket = s.proxy.Socket()
+	return token, nil
+}
+
+// proxyEnv returns the environment making the engine connect through the proxy url. The proxy exclusions the
+// runner may have are cleared, since they would bypass the policy
+func proxyEnv(proxyURL string) []string {
+	env := make([]string, 0, len(proxyEnvNames)+3)
+	for _, name := range proxyEnvNames {
+		env = append(env, name+"="+proxyURL)
+	}
+	return append(env, "NO_PROXY=", "no_proxy=", "NODE_USE_ENV_PROXY=1")
+}
@@ -0,0 +1,29 @@
+package coderunner
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/weni-ai/flows-code-actions/config"
+)
+
+// Executor adapts the engine command of a prepared run before it is started, to isolate it from the runner
+type Executor interface {
+	Wrap(run *Run, cmd *exec.Cmd) error
+}
+
+// NewExecutor returns the executor selected by the sandbox config
+func NewExecutor(conf config.SandboxConfig) (Executor, error) {
+	switch conf.Executor {
+	case "", "process":
+		return &processExecutor{}, nil
+	case "sandbox":
+		return &sandboxExecutor{conf: conf}, nil
+	}
+	return nil, fmt.Errorf("unknown executor %q", conf.Executor)
+}
+
+// processExecutor runs the engines as plain processes of the runner, sharing its filesystem and network
+type processExecutor struct{}
+
+func (e *processExecutor) Wrap(run *Run, cmd *exec.Cmd) error { return nil }
@@ -0,0 +1,128 @@
+package coderunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// goCacheDir is the build cache of the go toolchain, the compiled actions are kept in the artifact cache
+var goCacheDir = ""
+
+func init() {
+	RegisterRuntime(&goRuntime{})
+}
+
+type goRuntime struct{}
+
+func (r *goRuntime) Language() string { return "go" }
+
+func (r *goRuntime) Prepare(ctx context.Context, run *Run) error {
+	exe, release, err := buildGoAction(ctx, run.Source)
+	if err != nil {
+		return err
+	}
+	run.Artifact = exe
+	run.release = release
+	return nil
+}
+
+func (r *goRuntime) Execute(ctx context.Context, run *Run) (*exec.Cmd, error) {
+	cmd := exec.Command(run.Artifact)
+	cmd.Env = engineEnv()
+	return cmd, nil
+}
+
+// Cleanup releases the compiled binary, which stays cached for the next runs
+func (r *goRuntime) Cleanup(run *Run) error {
+	if run.release != nil {
+		run.release()
+	}
+	return nil
+}
+
+// goEngineFiles are the go engine sources, relative to its directory, built along with the action code
+var goEngineFiles = []string{"main.go", filepath.Join("engine", "engine.go")}
+
+// buildGoAction compiles the go engine with the given action code, returning the path to the binary and the
+// function releasing it. Binaries are kept in the artifact cache, addressed by the engine and action sources,
+// so each source is compiled only once
+func buildGoAction(ctx context.Context, code string) (string, func(), error) {
+	engineDir := filepath.Join(enginesDir(), "go")
+	sources := map[string][]byte{}
+	parts := []string{goEngineModule, code}
+	for _, file := range goEngineFiles {
+		data, err := os.ReadFile(filepath.Join(engineDir, file))
+		if err != nil {
+			return "", nil, errors.Wrap(err, "Error on reading go engine file")
+		}
+		sources[file] = data
+		parts = append(parts, file, string(data))
+	}
+
+	dir, release, err := artifacts.artifact(ctx, "go", artifactHash(parts...), func(ctx context.Context, dir string) error {
+		return compileGoAction(ctx, sources, code, filepath.Join(dir, "action"))
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "action"), release, nil
+}
+
+// compileGoAction builds the go engine sources with the action code into the exe binary
+func compileGoAction(ctx context.Context, sources map[string][]byte, code string, exe string) error {
+	tmpDir, err := os.MkdirTemp("", "coderunner")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for file, data := range sources {
+		dst := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return errors.Wrap(err, "Error on copy go engine file")
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "actions"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "actions", "action.go"), []byte(code), 0644); err != nil {
+		return fmt.Errorf("error creating temp file %q: %v", tmpDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(goEngineModule), 0644); err != nil {
+		return errors.Wrap(err, "Error on create go.mod file")
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", exe, ".")
+	cmd.Dir = tmpDir
+	cmd.Env = append(os.Environ(),
+		"GOCACHE="+filepath.Join(goCacheDir, "gocache"),
+		"GO111MODULE=on",
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=off",
+		"CGO_ENABLED=0",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			errs := strings.Replace(string(out), tmpDir+"/", "", -1)
+			return errors.New("errors: " + errs)
+		}
+		return fmt.Errorf("error building go source: %v", err)
+	}
+	return nil
+}
+
+// goEngineModule is the go.mod of the go engine build, keeping the same import paths
+// used by actions inside this repository
+const goEngineModule = `module github.com/weni-ai/flows-code-actions/engines/go
+
+go 1.21
+`
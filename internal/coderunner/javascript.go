@@ -0,0 +1,37 @@
+package coderunner
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+)
+
+func init() {
+	RegisterRuntime(&javascriptRuntime{})
+}
+
+type javascriptRuntime struct{}
+
+func (r *javascriptRuntime) Language() string { return "javascript" }
+
+func (r *javascriptRuntime) Prepare(ctx context.Context, run *Run) error {
+	tempDir, err := prepareEngineDir("js", "main.js", "action.js", run.Source)
+	if err != nil {
+		return err
+	}
+	run.WorkDir = tempDir
+	run.Artifact = tempDir + "/main.js"
+	return nil
+}
+
+func (r *javascriptRuntime) Execute(ctx context.Context, run *Run) (*exec.Cmd, error) {
+	cmd := exec.Command("node", run.Artifact)
+
+	// Pass environment variables to Node process, without the runner secrets, resolving engine dependencies from engines/js
+	cmd.Env = append(engineEnv(), "NODE_PATH="+filepath.Join(enginesDir(), "js", "node_modules"))
+	return cmd, nil
+}
+
+func (r *javascriptRuntime) Cleanup(run *Run) error {
+	return removeWorkDir(run)
+}
@@ -0,0 +1,152 @@
+package coderunner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/codelog"
+)
+
+// engineOutputFD is the file descriptor number the engines write their messages to
+const engineOutputFD = 3
+
+// engineOutputFDEnv tells the engines which file descriptor is the output channel
+const engineOutputFDEnv = "FLOWS_CODE_ACTIONS_ENGINE_OUTPUT_FD"
+
+const (
+	messageTypeResult = "result"
+	messageTypeLog    = "log"
+)
+
+// engineMessage is a JSON line written by an engine on the output channel
+type engineMessage struct {
+	Type string `json:"type"`
+
+	Result      string `json:"result"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+
+	LogType   string     `json:"log_type"`
+	Content   string     `json:"content"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+// engineResult is the last result set by the action
+type engineResult struct {
+	Value       string
+	StatusCode  int
+	ContentType string
+}
+
+// engineOutput gathers the result reported by an engine during a run
+type engineOutput struct {
+	Result *engineResult
+	// Logs is the number of log records received
+	Logs int
+}
+
+// logHandler is called for every log record as soon as the engine sends it
+type logHandler func(msg engineMessage)
+
+// outputChannel is the pipe shared with an engine process
+type outputChannel struct {
+	reader *os.File
+	writer *os.File
+	done   chan struct{}
+	output *engineOutput
+	onLog  logHandler
+}
+
+func newOutputChannel(onLog logHandler) (*outputChannel, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "error on creating engine output channel")
+	}
+	return &outputChannel{reader: r, writer: w, done: make(chan struct{}), output: &engineOutput{}, onLog: onLog}, nil
+}
+
+// start reads the channel until the engine closes it
+func (c *outputChannel) start() {
+	go func() {
+		defer close(c.done)
+		defer c.reader.Close()
+		readEngineOutput(c.reader, c.output, c.onLog)
+	}()
+}
+
+// wait closes the parent side of the pipe and waits for the engine messages to be consumed
+func (c *outputChannel) wait() *engineOutput {
+	c.writer.Close()
+	<-c.done
+	return c.output
+}
+
+func readEngineOutput(r io.Reader, output *engineOutput, onLog logHandler) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		msg := engineMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.WithError(err).Warn("invalid engine output message")
+			continue
+		}
+		switch msg.Type {
+		case messageTypeResult:
+			output.Result = &engineResult{Value: msg.Result, StatusCode: msg.StatusCode, ContentType: msg.ContentType}
+		case messageTypeLog:
+			output.Logs++
+			if onLog != nil {
+				onLog(msg)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Warn("error on reading engine output")
+	}
+}
+
+// saveEngineLog writes a log record streamed by the engine through the configured codelog repository,
+// the logs of an unknown type saved as info
+func (s *Service) saveEngineLog(ctx context.Context, codeID string, coderunID string, msg engineMessage) {
+	if s.codeLog == nil {
+		return
+	}
+	codeLog := codelog.NewCodeLog(coderunID, codeID, codelog.ParseLogType(msg.LogType), msg.Content)
+	if msg.Timestamp != nil {
+		codeLog.CreatedAt = *msg.Timestamp
+	}
+	if _, err := s.codeLog.Create(ctx, codeLog); err != nil {
+		log.WithError(err).Error("error on saving code run log")
+	}
+}
+
+// saveEngineOutput persists the result reported by the engine and the resource usage of the run on the code run
+func (s *Service) saveEngineOutput(ctx context.Context, run *Run, output *engineOutput) error {
+	hasResult := output != nil && output.Result != nil
+	if !hasResult && run.Usage == nil {
+		return nil
+	}
+	cr, err := s.codeRun.GetByID(ctx, run.RunID)
+	if err != nil {
+		return err
+	}
+	if cr.Extra == nil {
+		cr.Extra = map[string]interface{}{}
+	}
+	if hasResult {
+		cr.Result = output.Result.Value
+		cr.Extra["status_code"] = output.Result.StatusCode
+		cr.Extra["content_type"] = output.Result.ContentType
+	}
+	if run.Usage != nil {
+		cr.Extra["resources"] = run.Usage.extra()
+	}
+	_, err = s.codeRun.Update(ctx, run.RunID, cr)
+	return err
+}
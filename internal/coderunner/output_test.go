@@ -0,0 +1,34 @@
+package coderunner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadEngineOutput(t *testing.T) {
+	lines := strings.Join([]string{
+		`{"type":"log","log_type":"info","content":"started","timestamp":"2024-12-15T22:00:00Z"}`,
+		`not a json line`,
+		`{"type":"result","result":"first","status_code":200,"content_type":"text"}`,
+		`{"type":"result","result":"{\"ok\":true}","status_code":201,"content_type":"json"}`,
+	}, "\n")
+
+	logs := []engineMessage{}
+	output := &engineOutput{}
+	readEngineOutput(strings.NewReader(lines), output, func(msg engineMessage) {
+		logs = append(logs, msg)
+	})
+
+	assert.Equal(t, 1, output.Logs)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "info", logs[0].LogType)
+	assert.Equal(t, "started", logs[0].Content)
+	assert.Equal(t, 2024, logs[0].Timestamp.Year())
+
+	assert.NotNil(t, output.Result)
+	assert.Equal(t, `{"ok":true}`, output.Result.Value)
+	assert.Equal(t, 201, output.Result.StatusCode)
+	assert.Equal(t, "json", output.Result.ContentType)
+}
@@ -0,0 +1,31 @@
+package coderunner
+
+import (
+	"os/exec"
+)
+
+// engineProcess is a started engine, a process of the runner or a run forked by a warm python worker
+type engineProcess interface {
+	pid() int
+	// resume lets the engine read its input, once it is attached to the cgroup of the run
+	resume()
+	wait() error
+	kill()
+}
+
+// cmdProcess is an engine started as a child process of the runner, reading its input as soon as it starts
+type cmdProcess struct {
+	cmd *exec.Cmd
+}
+
+func startCmdProcess(cmd *exec.Cmd) (*cmdProcess, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdProcess{cmd: cmd}, nil
+}
+
+func (p *cmdProcess) pid() int    { return p.cmd.Process.Pid }
+func (p *cmdProcess) resume()     {}
+func (p *cmdProcess) wait() error { return p.cmd.Wait() }
+func (p *cmdProcess) kill()       { p.cmd.Process.Kill() }
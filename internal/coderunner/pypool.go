@@ -0,0 +1,540 @@
+package coderunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/config"
+	"golang.org/x/sys/unix"
+)
+
+// pythonWorkerFDEnv tells the warm python workers which file descriptor is their control socket
+const pythonWorkerFDEnv = "FLOWS_CODE_ACTIONS_PYTHON_WORKER_FD"
+
+// pythonPreloadEnv lists the modules the warm python workers import before forking the runs
+const pythonPreloadEnv = "FLOWS_CODE_ACTIONS_PYTHON_PRELOAD"
+
+// pythonWorkerStartTimeout bounds the start of a worker, importing the preloaded modules
+const pythonWorkerStartTimeout = 30 * time.Second
+
+// PythonPool keeps warm python workers per interpreter, the system one and the virtualenvs of the project
+// requirements. Workers import the preloaded modules once and fork a child for every run, which takes the
+// stdio and the output channel of the run and loads its action module, so each run still has a process of
+// its own. Workers are replaced after forking the configured number of runs, or when their memory grows
+// over the threshold
+type PythonPool struct {
+	conf   config.PythonPoolConfig
+	script string
+
+	mu   sync.Mutex
+	sets map[string]*pythonWorkerSet
+}
+
+// NewPythonPool creates the pool, workers are started on the first run of each interpreter
+func NewPythonPool(conf config.PythonPoolConfig) *PythonPool {
+	return &PythonPool{
+		conf:   conf,
+		script: filepath.Join(enginesDir(), "py", "worker.py"),
+		sets:   map[string]*pythonWorkerSet{},
+	}
+}
+
+// warmup starts the workers of the interpreter ahead of its first run
+func (p *PythonPool) warmup(interpreter string) {
+	path, err := exec.LookPath(interpreter)
+	if err != nil {
+		log.WithError(err).Warn("error on warming up python workers")
+		return
+	}
+	set := p.workerSet(path)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for len(set.workers)+set.spawning < p.conf.Size {
+		w, err := p.spawn(path)
+		if err != nil {
+			log.WithError(err).Warn("error on warming up python workers")
+			return
+		}
+		set.workers = append(set.workers, w)
+	}
+}
+
+// start runs the python engine command on a warm worker of its interpreter. The engine waits for its
+// input until the process is resumed
+func (p *PythonPool) start(ctx context.Context, cmd *exec.Cmd, stdout io.Writer, stderr io.Writer) (engineProcess, error) {
+	if len(cmd.Args) != 2 {
+		return nil, errors.New("python command is not an engine main file")
+	}
+	set := p.workerSet(cmd.Path)
+	w, recycle, err := set.acquire()
+	if err != nil {
+		return nil, err
+	}
+	proc, err := w.fork(ctx, cmd, stdout, stderr)
+	if err != nil || recycle {
+		set.remove(w)
+		w.retire()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// workerSet returns the workers of the interpreter, retiring the least recently used interpreter ones
+// when there are more interpreters than configured
+func (p *PythonPool) workerSet(interpreter string) *pythonWorkerSet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	set, ok := p.sets[interpreter]
+	if !ok {
+		set = &pythonWorkerSet{pool: p, interpreter: interpreter}
+		p.sets[interpreter] = set
+	}
+	set.usedAt = time.Now()
+
+	for len(p.sets) > p.conf.Interpreters && p.conf.Interpreters > 0 {
+		var oldest *pythonWorkerSet
+		for _, s := range p.sets {
+			if s != set && (oldest == nil || s.usedAt.Before(oldest.usedAt)) {
+				oldest = s
+			}
+		}
+		if oldest == nil {
+			break
+		}
+		delete(p.sets, oldest.interpreter)
+		go oldest.retireAll()
+	}
+	return set
+}
+
+// spawn starts a worker of the interpreter, returning once it imported the preloaded modules
+func (p *PythonPool) spawn(interpreter string) (*pythonWorker, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on creating python worker control socket")
+	}
+	control := os.NewFile(uintptr(fds[0]), "python-worker-control")
+	remote := os.NewFile(uintptr(fds[1]), "python-worker-control")
+	defer remote.Close()
+
+	cmd := exec.Command(interpreter, p.script)
+	cmd.Env = append(engineEnv(), pythonWorkerFDEnv+"=3", pythonPreloadEnv+"="+p.conf.Preload)
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		control.Close()
+		return nil, errors.Wrap(err, "error on starting python worker")
+	}
+	w := &pythonWorker{cmd: cmd, control: control, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(w.exited)
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 256)
+		n, err := unix.Read(fds[0], buf)
+		if err == nil && !bytes.Contains(buf[:max(n, 0)], []byte(`"ready"`)) {
+			err = errors.New("python worker exited before it was ready")
+		}
+		ready <- err
+	}()
+	timer := time.NewTimer(pythonWorkerStartTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+	case <-timer.C:
+		err = errors.New("timeout waiting for python worker to start")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		control.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// pythonWorkerSet is the warm workers of an interpreter
+type pythonWorkerSet struct {
+	pool        *PythonPool
+	interpreter string
+	usedAt      time.Time
+
+	mu       sync.Mutex
+	workers  []*pythonWorker
+	spawning int
+	next     int
+}
+
+// acquire returns the next live worker, starting one when there is none. Missing workers are started in
+// background. The worker must be recycled once the run is forked when it reached its runs or memory limit
+func (s *pythonWorkerSet) acquire() (*pythonWorker, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live := s.workers[:0]
+	for _, w := range s.workers {
+		if w.alive() {
+			live = append(live, w)
+		} else {
+			w.retire()
+		}
+	}
+	s.workers = live
+
+	if len(s.workers) == 0 {
+		w, err := s.pool.spawn(s.interpreter)
+		if err != nil {
+			return nil, false, err
+		}
+		s.workers = append(s.workers, w)
+	}
+	for i := len(s.workers) + s.spawning; i < s.pool.conf.Size; i++ {
+		s.spawning++
+		go s.spawnBackground()
+	}
+
+	s.next = (s.next + 1) % len(s.workers)
+	w := s.workers[s.next]
+	w.runs++
+	recycle := s.pool.conf.MaxRuns > 0 && w.runs >= s.pool.conf.MaxRuns
+	if s.pool.conf.MaxMemory > 0 {
+		if rss, err := processRSS(w.cmd.Process.Pid); err == nil && rss > s.pool.conf.MaxMemory {
+			recycle = true
+		}
+	}
+	return w, recycle, nil
+}
+
+func (s *pythonWorkerSet) spawnBackground() {
+	w, err := s.pool.spawn(s.interpreter)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spawning--
+	if err != nil {
+		log.WithError(err).Warn("error on starting python worker")
+		return
+	}
+	s.workers = append(s.workers, w)
+}
+
+// remove takes the worker out of the set, so no other run is sent to it
+func (s *pythonWorkerSet) remove(w *pythonWorker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, worker := range s.workers {
+		if worker == w {
+			s.workers = append(s.workers[:i], s.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *pythonWorkerSet) retireAll() {
+	s.mu.Lock()
+	workers := s.workers
+	s.workers = nil
+	s.mu.Unlock()
+	for _, w := range workers {
+		w.retire()
+	}
+}
+
+// pythonWorker is a warm python process forking the runs sent on its control socket
+type pythonWorker struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	// runs is the number of runs sent to the worker, guarded by the set mutex
+	runs int
+
+	// mu guards the control socket, closed when the worker is retired
+	mu      sync.RWMutex
+	control *os.File
+}
+
+// pythonJob is the run sent to a worker, along with the fds of the run
+type pythonJob struct {
+	Main string   `json:"main"`
+	Dir  string   `json:"dir"`
+	Env  []string `json:"env"`
+}
+
+// pythonReport is the pid of the forked run, then its exit code, negative when killed by a signal
+type pythonReport struct {
+	Pid    int  `json:"pid"`
+	Status *int `json:"status"`
+}
+
+func (w *pythonWorker) alive() bool {
+	select {
+	case <-w.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// retire closes the control socket of the worker, which exits once its running runs finish
+func (w *pythonWorker) retire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.control != nil {
+		w.control.Close()
+		w.control = nil
+	}
+}
+
+// fork sends the run to the worker with the stdio of the engine and its output channel, and waits for the
+// pid of the forked run
+func (w *pythonWorker) fork(ctx context.Context, cmd *exec.Cmd, stdout io.Writer, stderr io.Writer) (*warmProcess, error) {
+	dir := cmd.Dir
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = cwd
+	}
+	job, err := json.Marshal(pythonJob{Main: cmd.Args[1], Dir: dir, Env: cmd.Environ()})
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	pipe := func() (*os.File, *os.File) {
+		r, w, perr := os.Pipe()
+		if perr != nil {
+			err = perr
+			return nil, nil
+		}
+		files = append(files, r, w)
+		return r, w
+	}
+	stdinR, stdinW := pipe()
+	stdoutR, stdoutW := pipe()
+	stderrR, stderrW := pipe()
+	if err != nil {
+		closeAll()
+		return nil, errors.Wrap(err, "error on creating python run pipes")
+	}
+	var output *os.File
+	if len(cmd.ExtraFiles) > 0 {
+		output = cmd.ExtraFiles[0]
+	} else {
+		if output, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+			closeAll()
+			return nil, err
+		}
+		files = append(files, output)
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		closeAll()
+		return nil, errors.Wrap(err, "error on creating python run report socket")
+	}
+	report := os.NewFile(uintptr(fds[0]), "python-run-report")
+	reportRemote := os.NewFile(uintptr(fds[1]), "python-run-report")
+	files = append(files, reportRemote)
+	// the forked run waits on the gate until it is resumed, once it is in the cgroup of the run
+	gateR, gateW := pipe()
+	if err != nil {
+		closeAll()
+		report.Close()
+		return nil, errors.Wrap(err, "error on creating python run gate")
+	}
+
+	rights := unix.UnixRights(int(stdinR.Fd()), int(stdoutW.Fd()), int(stderrW.Fd()), int(output.Fd()), int(reportRemote.Fd()), int(gateR.Fd()))
+	w.mu.RLock()
+	if w.control == nil {
+		err = errors.New("python worker was retired")
+	} else {
+		err = unix.Sendmsg(int(w.control.Fd()), job, rights, nil, 0)
+	}
+	w.mu.RUnlock()
+	// the worker holds its copies of the run fds now, and the engine output is closed by the runner
+	stdinR.Close()
+	stdoutW.Close()
+	stderrW.Close()
+	reportRemote.Close()
+	gateR.Close()
+	if len(cmd.ExtraFiles) == 0 {
+		output.Close()
+	}
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		stderrR.Close()
+		report.Close()
+		gateW.Close()
+		return nil, errors.Wrap(err, "error on sending run to python worker")
+	}
+
+	p := &warmProcess{ctx: ctx, input: cmd.Stdin, stdin: stdinW, gate: gateW, report: report, reader: bufio.NewReader(report)}
+	msg, err := p.readReport()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		stderrR.Close()
+		report.Close()
+		gateW.Close()
+		return nil, errors.Wrap(err, "error on forking python run")
+	}
+	p.runPid = msg.Pid
+	for _, c := range []struct {
+		dst io.Writer
+		src *os.File
+	}{{stdout, stdoutR}, {stderr, stderrR}} {
+		p.copies.Add(1)
+		go func(dst io.Writer, src *os.File) {
+			defer p.copies.Done()
+			defer src.Close()
+			if dst != nil {
+				io.Copy(dst, src)
+			} else {
+				io.Copy(io.Discard, src)
+			}
+		}(c.dst, c.src)
+	}
+	return p, nil
+}
+
+// warmProcess is a run forked by a python worker, which reports its exit code
+type warmProcess struct {
+	ctx    context.Context
+	runPid int
+	input  io.Reader
+	stdin  *os.File
+	gate   *os.File
+	report *os.File
+	reader *bufio.Reader
+	copies sync.WaitGroup
+
+	stdinOnce sync.Once
+	gateOnce  sync.Once
+	mu        sync.Mutex
+	exited    bool
+}
+
+func (p *warmProcess) pid() int { return p.runPid }
+
+// resume opens the gate of the run, which starts the engine main file, and sends the input of the run
+func (p *warmProcess) resume() {
+	p.gateOnce.Do(func() {
+		p.gate.Write([]byte{1})
+		p.gate.Close()
+	})
+	go func() {
+		if p.input != nil {
+			io.Copy(p.stdin, p.input)
+		}
+		p.closeStdin()
+	}()
+}
+
+// wait waits for the exit code of the run, killing it when the context of the run is done
+func (p *warmProcess) wait() error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			p.kill()
+		case <-done:
+		}
+	}()
+
+	msg, err := p.readReport()
+	p.mu.Lock()
+	p.exited = true
+	p.mu.Unlock()
+	p.report.Close()
+	p.closeGate()
+	p.closeStdin()
+	p.copies.Wait()
+	if err != nil {
+		return errors.Wrap(err, "python worker exited during the run")
+	}
+	if msg.Status == nil {
+		return errors.New("python worker did not report the run exit code")
+	}
+	if status := *msg.Status; status < 0 {
+		return fmt.Errorf("signal: %s", syscall.Signal(-status))
+	} else if status > 0 {
+		return fmt.Errorf("exit status %d", status)
+	}
+	return nil
+}
+
+func (p *warmProcess) kill() {
+	p.closeGate()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.exited {
+		syscall.Kill(p.runPid, syscall.SIGKILL)
+	}
+}
+
+// closeGate closes the gate of a run that was not resumed, which exits without running the engine
+func (p *warmProcess) closeGate() {
+	p.gateOnce.Do(func() { p.gate.Close() })
+}
+
+func (p *warmProcess) closeStdin() {
+	p.stdinOnce.Do(func() { p.stdin.Close() })
+}
+
+func (p *warmProcess) readReport() (*pythonReport, error) {
+	line, err := p.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	msg := &pythonReport{}
+	if err := json.Unmarshal(line, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// processRSS returns the resident memory of the process, in bytes
+func processRSS(pid int) (int64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				break
+			}
+			kb, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, errors.New("process resident memory not found")
+}
@@ -0,0 +1,102 @@
+package coderunner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+)
+
+func TestPythonPool(t *testing.T) {
+	interpreter, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python is not installed")
+	}
+	workDir := t.TempDir()
+	// a preloaded module changed by a run must not leak into the next runs of the worker
+	script := strings.Join([]string{
+		"import os, sys, json",
+		"data = sys.stdin.read()",
+		"print('leaked' if hasattr(json, 'touched') else 'clean', os.environ.get('RUN_ENV'), os.getcwd(), sep=',')",
+		"json.touched = True",
+		"os.write(3, ('out:' + data).encode())",
+	}, "\n")
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "main.py"), []byte(script), 0644))
+
+	pool := NewPythonPool(config.PythonPoolConfig{Size: 1, MaxRuns: 2, Interpreters: 1, Preload: "json"})
+	pool.script = filepath.Join("..", "..", "engines", "py", "worker.py")
+
+	run := func(input string, env string) (string, string, error) {
+		r, w, err := os.Pipe()
+		assert.NoError(t, err)
+		defer r.Close()
+		cmd := exec.Command(interpreter, "main.py")
+		cmd.Dir = workDir
+		cmd.Env = []string{"RUN_ENV=" + env}
+		cmd.Stdin = strings.NewReader(input)
+		cmd.ExtraFiles = []*os.File{w}
+		var stdout, stderr bytes.Buffer
+		proc, err := pool.start(context.Background(), cmd, &stdout, &stderr)
+		w.Close()
+		if err != nil {
+			return "", "", err
+		}
+		proc.resume()
+		err = proc.wait()
+		output, _ := io.ReadAll(r)
+		return stdout.String(), string(output), err
+	}
+
+	pids := map[int]bool{}
+	for i, env := range []string{"first", "second", "third"} {
+		stdout, output, err := run(env+"-input", env)
+		assert.NoError(t, err)
+		assert.Equal(t, "clean,"+env+","+workDir+"\n", stdout)
+		assert.Equal(t, "out:"+env+"-input", output)
+
+		set := pool.workerSet(interpreter)
+		set.mu.Lock()
+		for _, w := range set.workers {
+			pids[w.cmd.Process.Pid] = true
+		}
+		set.mu.Unlock()
+		if i == 0 {
+			assert.Len(t, pids, 1)
+		}
+	}
+	// the worker is replaced after forking two runs
+	assert.Len(t, pids, 2)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "main.py"), []byte("import sys\nsys.exit(3)\n"), 0644))
+	_, _, err = run("", "")
+	assert.EqualError(t, err, "exit status 3")
+
+	// no code of the run executes before it is resumed, once in the cgroup of the run
+	marker := filepath.Join(workDir, "imported")
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "main.py"), []byte("open('imported', 'w').close()\n"), 0644))
+	cmd := exec.Command(interpreter, "main.py")
+	cmd.Dir = workDir
+	proc, err := pool.start(context.Background(), cmd, nil, nil)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.NoFileExists(t, marker)
+	proc.kill()
+	assert.Error(t, proc.wait())
+	assert.NoFileExists(t, marker)
+
+	pool.workerSet(interpreter).retireAll()
+}
+
+func TestProcessRSS(t *testing.T) {
+	rss, err := processRSS(os.Getpid())
+	assert.NoError(t, err)
+	assert.Greater(t, rss, int64(0))
+}
@@ -0,0 +1,109 @@
+package coderunner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// pythonCompileScript compiles the action with hash based invalidation, so the bytecode is valid for any
+// action file with the same source, whatever its modification time
+const pythonCompileScript = `import py_compile, sys
+py_compile.compile(sys.argv[1], cfile=sys.argv[2], doraise=True, invalidation_mode=py_compile.PycInvalidationMode.CHECKED_HASH)`
+
+var (
+	pythonCacheTag     string
+	pythonCacheTagOnce sync.Once
+)
+
+func init() {
+	RegisterRuntime(&pythonRuntime{})
+}
+
+// pythonRuntime runs the python engine with the interpreter of the virtualenv of the project requirements,
+// or with the system one when the project has none
+type pythonRuntime struct{}
+
+func (r *pythonRuntime) Language() string { return "python" }
+
+func (r *pythonRuntime) Prepare(ctx context.Context, run *Run) error {
+	if run.Interpreter == "" {
+		run.Interpreter = "python"
+	}
+
+	tempDir, err := prepareEngineDir("py", "main.py", "action.py", run.Source)
+	if err != nil {
+		return err
+	}
+	run.WorkDir = tempDir
+	run.Artifact = tempDir + "/main.py"
+	if err := copyPythonBytecode(ctx, run.Source, tempDir); err != nil {
+		// the interpreter compiles the action itself, reporting its syntax errors
+		log.WithError(err).Debug("error on preparing python bytecode")
+	}
+	return nil
+}
+
+func (r *pythonRuntime) Execute(ctx context.Context, run *Run) (*exec.Cmd, error) {
+	cmd := exec.Command(run.Interpreter, run.Artifact)
+
+	// Pass environment variables to Python process, without the runner secrets
+	cmd.Env = engineEnv()
+	return cmd, nil
+}
+
+func (r *pythonRuntime) Cleanup(run *Run) error {
+	return removeWorkDir(run)
+}
+
+// copyPythonBytecode places the cached bytecode of the action in the pycache of the work dir, compiling it on a
+// cache miss. Virtualenvs share the bytecode of their base interpreter, which has the same cache tag
+func copyPythonBytecode(ctx context.Context, source string, workDir string) error {
+	pythonCacheTagOnce.Do(func() {
+		out, err := exec.Command("python", "-c", "import sys; print(sys.implementation.cache_tag or '')").Output()
+		if err != nil {
+			log.WithError(err).Warn("error getting python cache tag")
+		}
+		pythonCacheTag = strings.TrimSpace(string(out))
+	})
+	if pythonCacheTag == "" {
+		return errors.New("python bytecode is not cached by the interpreter")
+	}
+
+	dir, release, err := artifacts.artifact(ctx, "python", artifactHash(pythonCacheTag, source), func(ctx context.Context, dir string) error {
+		src := filepath.Join(dir, "action.py")
+		if err := os.WriteFile(src, []byte(source), 0644); err != nil {
+			return err
+		}
+		var output bytes.Buffer
+		cmd := exec.CommandContext(ctx, "python", "-c", pythonCompileScript, src, filepath.Join(dir, "action.pyc"))
+		cmd.Env = engineEnv()
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := cmd.Run(); err != nil {
+			return errors.Wrap(err, strings.TrimSpace(output.String()))
+		}
+		return os.Remove(src)
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	data, err := os.ReadFile(filepath.Join(dir, "action.pyc"))
+	if err != nil {
+		return err
+	}
+	pycache := filepath.Join(workDir, "__pycache__")
+	if err := os.MkdirAll(pycache, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(pycache, "action."+pythonCacheTag+".pyc"), data, 0644)
+}
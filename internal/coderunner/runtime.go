@@ -0,0 +1,233 @@
+package coderunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+// Run holds everything a runtime needs to execute a code action
+type Run struct {
+	CodeID  string
+	RunID   string
+	Source  string
+	Params  map[string]interface{}
+	Body    string
+	Headers map[string]interface{}
+	// Secrets are injected in the engine environment by name, prefixed with SecretEnvPrefix
+	Secrets map[string]string
+	// Requirements are the pinned python libraries of the code project, installed in its virtualenv
+	Requirements []string
+	// AllowEgress keeps the network access of the run when it is sandboxed
+	AllowEgress bool
+	// EgressPolicy is the network policy of the code project, when enforced by the egress proxy
+	EgressPolicy *project.EgressPolicy
+	// EgressProxy is the loopback address of the egress proxy the engine connects through, and EgressSocket
+	// its unix socket, reachable from the sandboxes without network
+	EgressProxy  string
+	EgressSocket string
+
+	// WorkDir is the temporary directory created by the runtime on Prepare, if any
+	WorkDir string
+	// OutputDir is a directory the run writes in, like the virtualenv of an installation, if any
+	OutputDir string
+	// Artifact is the prepared executable or entrypoint, if any
+	Artifact string
+	// Interpreter executes the artifact, for the runtimes selecting it per run
+	Interpreter string
+	// Usage is the resource usage of the run, when resource management is enabled
+	Usage *RunUsage
+
+	// release frees the cached artifact used by the run, if any
+	release func()
+}
+
+// Runtime prepares and executes code actions of a language
+type Runtime interface {
+	// Language is the code language handled by the runtime
+	Language() string
+	// Prepare sets up what is needed to execute the run, like engine files or compiled binaries
+	Prepare(ctx context.Context, run *Run) error
+	// Execute returns the engine process command for a prepared run
+	Execute(ctx context.Context, run *Run) (*exec.Cmd, error)
+	// Cleanup releases what was created on Prepare
+	Cleanup(run *Run) error
+}
+
+var (
+	runtimesMu sync.RWMutex
+	runtimes   = map[string]Runtime{}
+)
+
+// RegisterRuntime makes a runtime available for its language, replacing any runtime already registered for it
+func RegisterRuntime(rt Runtime) {
+	runtimesMu.Lock()
+	defer runtimesMu.Unlock()
+	runtimes[rt.Language()] = rt
+}
+
+// LookupRuntime returns the runtime registered for the language
+func LookupRuntime(language string) (Runtime, bool) {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+	rt, ok := runtimes[language]
+	return rt, ok
+}
+
+// Languages returns the languages with a registered runtime, alphabetically ordered
+func Languages() []string {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+	languages := make([]string, 0, len(runtimes))
+	for language := range runtimes {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// configureRuntimes sets the package-level artifact cache, go build cache and virtualenvs directories from
+// the runtime config
+func configureRuntimes(conf config.RuntimeConfig) {
+	artifacts = newArtifactCache(conf.ArtifactCacheDir, conf.ArtifactCacheSize)
+	goCacheDir = conf.GoCacheDir
+	venvsDir = conf.PythonVenvsDir
+}
+
+// enginesDir returns the directory where the language engines are located
+func enginesDir() string {
+	//TODO: figure out how to handle temporary files dir
+	currentDir := "/home/rafaelsoares/weni/weni-ai/codeactions"
+	if environment != "local" {
+		currentDir = "/app"
+	}
+	return currentDir + "/engines"
+}
+
+// prepareEngineDir creates a temporary dir with the engine main file of the given language and the action code
+func prepareEngineDir(lang string, mainFile string, actionFile string, code string) (string, error) {
+	tempDir, err := os.MkdirTemp("./", "code-")
+	if err != nil {
+		fmt.Println("Error ao criar diretório temporário:", err)
+		return "", err
+	}
+
+	sourceFile := enginesDir() + "/" + lang + "/" + mainFile
+	destinatinFile := tempDir + "/" + mainFile
+	data, err := os.ReadFile(sourceFile)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", errors.Wrap(err, "Error on reading main file")
+	}
+	err = os.WriteFile(destinatinFile, data, 0644)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", errors.Wrap(err, "Error on copy main file")
+	}
+
+	codeFile := tempDir + "/" + actionFile
+	err = os.WriteFile(codeFile, []byte(code), 0644)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", errors.Wrap(err, "Error on create code file")
+	}
+	return tempDir, nil
+}
+
+// engineInput is the invocation envelope written to the engine stdin as a single JSON document
+type engineInput struct {
+	RunID   string                 `json:"run_id"`
+	CodeID  string                 `json:"code_id"`
+	Params  map[string]interface{} `json:"params"`
+	Body    string                 `json:"body"`
+	Headers map[string]interface{} `json:"headers"`
+}
+
+// newEngineInput encodes the run invocation envelope read by the engines main files
+func newEngineInput(run *Run) ([]byte, error) {
+	input := engineInput{
+		RunID:   run.RunID,
+		CodeID:  run.CodeID,
+		Params:  run.Params,
+		Body:    run.Body,
+		Headers: run.Headers,
+	}
+	if input.Params == nil {
+		input.Params = map[string]interface{}{}
+	}
+	if input.Headers == nil {
+		input.Headers = map[string]interface{}{}
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on encoding engine input")
+	}
+	return data, nil
+}
+
+// scrubbedEnvPrefixes are the environment variables holding database, storage and auth secrets,
+// which must not reach the user code
+var scrubbedEnvPrefixes = []string{
+	"FLOWS_CODE_ACTIONS_DB_",
+	"FLOWS_CODE_ACTIONS_MONGO_",
+	"FLOWS_CODE_ACTIONS_POSTGRES_",
+	"FLOWS_CODE_ACTIONS_S3_",
+	"FLOWS_CODE_ACTIONS_AUTH_TOKEN",
+	"FLOWS_CODE_ACTIONS_OIDC_",
+	"FLOWS_CODE_ACTIONS_REDIS",
+	"FLOWS_CODE_ACTIONS_RABBITMQ_",
+	"FLOWS_CODE_ACTIONS_SENTRY_DSN",
+	"FLOWS_CODE_ACTIONS_SECRETS_",
+	"AWS_",
+	"DATABASE_URL",
+}
+
+// engineEnv returns the runner environment without the secrets listed in scrubbedEnvPrefixes
+func engineEnv() []string {
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if !isScrubbedEnv(kv) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func isScrubbedEnv(kv string) bool {
+	for _, prefix := range scrubbedEnvPrefixes {
+		if strings.HasPrefix(kv, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretEnvPrefix prefixes the code secrets in the engine environment, where engine.secrets.get() reads them from
+const SecretEnvPrefix = "FLOWS_CODE_ACTIONS_SECRET_"
+
+// secretEnv returns the secrets as engine environment variables
+func secretEnv(secrets map[string]string) []string {
+	env := make([]string, 0, len(secrets))
+	for name, value := range secrets {
+		env = append(env, SecretEnvPrefix+name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// removeWorkDir removes the run temporary directory, if any
+func removeWorkDir(run *Run) error {
+	if run.WorkDir == "" {
+		return nil
+	}
+	return os.RemoveAll(run.WorkDir)
+}
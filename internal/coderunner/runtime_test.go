@@ -0,0 +1,68 @@
+package coderunner
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRuntime struct{}
+
+func (r *fakeRuntime) Language() string                                         { return "fake" }
+func (r *fakeRuntime) Prepare(ctx context.Context, run *Run) error              { return nil }
+func (r *fakeRuntime) Execute(ctx context.Context, run *Run) (*exec.Cmd, error) { return nil, nil }
+func (r *fakeRuntime) Cleanup(run *Run) error                                   { return nil }
+
+func TestRuntimeRegistry(t *testing.T) {
+	assert.Equal(t, []string{"go", "javascript", "python"}, Languages())
+
+	_, ok := LookupRuntime("fake")
+	assert.False(t, ok)
+
+	RegisterRuntime(&fakeRuntime{})
+	defer func() {
+		runtimesMu.Lock()
+		delete(runtimes, "fake")
+		runtimesMu.Unlock()
+	}()
+
+	rt, ok := LookupRuntime("fake")
+	assert.True(t, ok)
+	assert.Equal(t, "fake", rt.Language())
+	assert.Contains(t, Languages(), "fake")
+}
+
+func TestEngineEnv(t *testing.T) {
+	t.Setenv("FLOWS_CODE_ACTIONS_DB_URI", "postgres://user:secret@db/codeactions")
+	t.Setenv("FLOWS_CODE_ACTIONS_S3_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("FLOWS_CODE_ACTIONS_AUTH_TOKEN", "secret")
+	t.Setenv("FLOWS_CODE_ACTIONS_ENVIRONMENT", "test")
+
+	env := engineEnv()
+	assert.Contains(t, env, "FLOWS_CODE_ACTIONS_ENVIRONMENT=test")
+	for _, kv := range env {
+		assert.NotContains(t, kv, "secret")
+	}
+}
+
+func TestSecretEnv(t *testing.T) {
+	t.Setenv("FLOWS_CODE_ACTIONS_SECRETS_MASTER_KEY", "secret")
+	for _, kv := range engineEnv() {
+		assert.NotContains(t, kv, "secret")
+	}
+
+	env := secretEnv(map[string]string{"API_TOKEN": "token", "BASE_URL": "https://api.weni.ai"})
+	assert.Equal(t, []string{
+		"FLOWS_CODE_ACTIONS_SECRET_API_TOKEN=token",
+		"FLOWS_CODE_ACTIONS_SECRET_BASE_URL=https://api.weni.ai",
+	}, env)
+}
+
+func TestVenvKey(t *testing.T) {
+	key := venvKey([]string{"requests==2.31.0"})
+	assert.Len(t, key, 32)
+	assert.Equal(t, key, venvKey([]string{"requests==2.31.0"}))
+	assert.NotEqual(t, key, venvKey([]string{"requests==2.32.0"}))
+}
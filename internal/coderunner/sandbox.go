@@ -0,0 +1,502 @@
+package coderunner
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxInitArg is the argv[0] the runner binary is executed with to set up a sandbox from inside
+// its namespaces, before executing the engine
+const sandboxInitArg = "codeactions-sandbox-init"
+
+// sandboxRoot is where the root of the sandbox is staged, on a tmpfs hiding the runner one
+const sandboxRoot = "/tmp/root"
+
+// writableBindPrefix marks the binds of the sandbox init args bound writable
+const writableBindPrefix = "rw:"
+
+func init() {
+	if len(os.Args) > 3 && os.Args[0] == sandboxInitArg {
+		sandboxInit(os.Args[1:])
+	}
+}
+
+// sandboxExecutor runs each engine in fresh user, mount, PID, IPC, UTS and network namespaces, with a
+// read-only view of the runner root, a private tmpfs on /tmp, no capabilities and a seccomp filter.
+// Runs of codes allowing egress only reach the egress proxy when there is one, forwarded from the sandbox
+// loopback to the proxy socket, and keep the network namespace of the runner otherwise
+type sandboxExecutor struct {
+	conf config.SandboxConfig
+}
+
+func (e *sandboxExecutor) Wrap(run *Run, cmd *exec.Cmd) error {
+	if seccompArch == 0 {
+		return errors.Errorf("sandbox is not supported on %s", runtime.GOARCH)
+	}
+	if run.WorkDir != "" {
+		// the work dir is created private to the runner, and the sandbox runs as another user
+		if err := os.Chmod(run.WorkDir, 0755); err != nil {
+			return errors.Wrap(err, "error on sharing work dir with the sandbox")
+		}
+	}
+	if cmd.Dir == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		cmd.Dir = dir
+	}
+	if cmd.Env == nil {
+		cmd.Env = engineEnv()
+	}
+	cmd.Env = append(cmd.Env, "HOME=/tmp", "TMPDIR=/tmp")
+
+	binds, err := sandboxBinds(run, cmd.Dir)
+	if err != nil {
+		return err
+	}
+
+	network := "none"
+	flags := uintptr(unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS)
+	switch {
+	case run.AllowEgress && run.EgressSocket != "":
+		_, port, err := net.SplitHostPort(run.EgressProxy)
+		if err != nil {
+			return errors.Wrap(err, "error on parsing egress proxy address")
+		}
+		network = "proxy:" + port + ":" + run.EgressSocket
+		binds = append(binds, run.EgressSocket)
+		flags |= unix.CLONE_NEWNET
+	case run.AllowEgress:
+		network = "host"
+	default:
+		flags |= unix.CLONE_NEWNET
+	}
+
+	args := append([]string{sandboxInitArg, e.conf.TmpSize, network}, binds...)
+	args = append(args, "--", cmd.Path)
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: flags,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		// a root runner maps the sandbox root to the unprivileged ids and switches to them, dropping
+		// its supplementary groups, otherwise the sandbox would run as an unmapped host root
+		uid, gid = e.conf.UID, e.conf.GID
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = true
+	}
+	if run.OutputDir != "" {
+		// the output dir is written by the sandbox user
+		if err := os.Chown(run.OutputDir, uid, gid); err != nil {
+			return errors.Wrap(err, "error on sharing output dir with the sandbox")
+		}
+	}
+	// without privileges only the runner own ids can be mapped
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+	return nil
+}
+
+// sandboxBinds returns the absolute paths of the run files the engine needs, bound read-only in the
+// sandbox: the work dir or the artifact, and the virtualenv of the interpreter. The output dir is
+// bound writable, prefixed with writableBindPrefix
+func sandboxBinds(run *Run, dir string) ([]string, error) {
+	paths := []string{}
+	if run.WorkDir != "" {
+		paths = append(paths, run.WorkDir)
+	} else if run.Artifact != "" {
+		paths = append(paths, run.Artifact)
+	}
+	if filepath.IsAbs(run.Interpreter) {
+		paths = append(paths, filepath.Dir(filepath.Dir(run.Interpreter)))
+	}
+
+	binds := []string{}
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, errors.Wrap(err, "error on binding run files in the sandbox")
+		}
+		binds = append(binds, path)
+	}
+	if run.OutputDir != "" {
+		path := run.OutputDir
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, errors.Wrap(err, "error on binding output dir in the sandbox")
+		}
+		binds = append(binds, writableBindPrefix+path)
+	}
+	return binds, nil
+}
+
+// sandboxInit runs in the namespaces of the sandbox, set up by Wrap. It builds the sandbox
+// filesystem, drops the capabilities, installs the syscall filter and executes the engine.
+// args are the tmpfs size, the network mode, the paths to bind, "--" and the engine command.
+// The network mode is "none", "host", or "proxy:<port>:<socket>" to forward the proxy port
+// of the sandbox loopback to the proxy socket
+func sandboxInit(args []string) {
+	// no_new_privs, the capability bounding set and the seccomp filter are set per thread,
+	// so they must be set on the thread executing the engine
+	runtime.LockOSThread()
+
+	sep := 2
+	for sep < len(args) && args[sep] != "--" {
+		sep++
+	}
+	if sep >= len(args)-1 {
+		fmt.Fprintln(os.Stderr, "sandbox: missing command")
+		os.Exit(126)
+	}
+	if err := setupSandbox(args[0], args[1] != "host", args[2:sep]); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+	argv := args[sep+1:]
+	if proxy, ok := strings.CutPrefix(args[1], "proxy:"); ok {
+		port, socket, _ := strings.Cut(proxy, ":")
+		os.Exit(runForwardingEgress(argv, port, socket))
+	}
+	err := syscall.Exec(argv[0], argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "sandbox: error executing %s: %v\n", argv[0], err)
+	os.Exit(127)
+}
+
+// runForwardingEgress starts the engine as a child of the sandbox init, which stays forwarding the egress
+// proxy connections, and returns the exit status of the engine. The engine is forked from the locked
+// thread, so it inherits its syscall filter
+func runForwardingEgress(argv []string, port string, socket string) int {
+	if err := forwardEgress(port, socket); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: error forwarding egress proxy: %v\n", err)
+		return 126
+	}
+	cmd := &exec.Cmd{
+		Path:        argv[0],
+		Args:        argv,
+		Env:         os.Environ(),
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL},
+	}
+	if _, err := unix.FcntlInt(engineOutputFD, unix.F_GETFD, 0); err == nil {
+		cmd.ExtraFiles = []*os.File{os.NewFile(engineOutputFD, "engine-output")}
+	}
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: error executing %s: %v\n", argv[0], err)
+		return 127
+	}
+	return 0
+}
+
+// forwardEgress forwards the connections to the port of the sandbox loopback to the egress proxy socket,
+// the only way out of the sandbox network namespace
+func forwardEgress(port string, socket string) error {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				proxy, err := net.Dial("unix", socket)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				egress.Pipe(conn, proxy)
+			}()
+		}
+	}()
+	return nil
+}
+
+func setupSandbox(tmpSize string, isolateNetwork bool, binds []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := setupSandboxFS(tmpSize, cwd, binds); err != nil {
+		return err
+	}
+	if err := os.Chdir(cwd); err != nil {
+		return errors.Wrap(err, "error changing to work dir")
+	}
+	if isolateNetwork {
+		if err := loopbackUp(); err != nil {
+			return errors.Wrap(err, "error setting up loopback")
+		}
+	}
+	if err := dropCapabilities(); err != nil {
+		return errors.Wrap(err, "error dropping capabilities")
+	}
+	if err := applySeccomp(); err != nil {
+		return errors.Wrap(err, "error installing seccomp filter")
+	}
+	return nil
+}
+
+// setupSandboxFS pivots to a read-only bind of the runner root, with a private tmpfs on /tmp and
+// the proc of the sandbox PID namespace. The runner work directory, holding the files of the other
+// runs, is hidden and only the binds of the run files are visible
+func setupSandboxFS(tmpSize string, cwd string, binds []string) error {
+	// the run files are opened before they are hidden by the staging tmpfs, and bound from their fds
+	paths := make([]string, len(binds))
+	writable := make([]bool, len(binds))
+	fds := make([]int, len(binds))
+	for i, bind := range binds {
+		path, rw := strings.CutPrefix(bind, writableBindPrefix)
+		paths[i], writable[i] = path, rw
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return errors.Wrapf(err, "error opening %s", path)
+		}
+		defer unix.Close(fd)
+		fds[i] = fd
+	}
+
+	// mounts made from now on are not propagated back to the runner
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return errors.Wrap(err, "error making mounts private")
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=1m"); err != nil {
+		return errors.Wrap(err, "error mounting staging tmpfs")
+	}
+	if err := os.Mkdir(sandboxRoot, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("/", sandboxRoot, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "error binding root")
+	}
+	if err := remountReadOnly(sandboxRoot); err != nil {
+		return err
+	}
+	tmpOptions := "mode=1777"
+	if tmpSize != "" {
+		tmpOptions += ",size=" + tmpSize
+	}
+	if err := unix.Mount("tmpfs", sandboxRoot+"/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpOptions); err != nil {
+		return errors.Wrap(err, "error mounting tmpfs")
+	}
+	if err := unix.Mount("proc", sandboxRoot+"/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return errors.Wrap(err, "error mounting proc")
+	}
+	if cwd != "/" {
+		if err := os.MkdirAll(sandboxRoot+cwd, 0755); err != nil {
+			return err
+		}
+		if err := unix.Mount("tmpfs", sandboxRoot+cwd, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+			return errors.Wrap(err, "error hiding work directory")
+		}
+	}
+	for i, path := range paths {
+		if err := bindRunFile(fds[i], sandboxRoot+path, !writable[i]); err != nil {
+			return errors.Wrapf(err, "error binding %s", path)
+		}
+	}
+	if cwd != "/" {
+		if err := unix.Mount("", sandboxRoot+cwd, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+			return errors.Wrap(err, "error remounting work directory read-only")
+		}
+	}
+
+	if err := os.Chdir(sandboxRoot); err != nil {
+		return err
+	}
+	// pivoting the root onto itself stacks the old root over the new one, detached right after
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return errors.Wrap(err, "error pivoting root")
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return errors.Wrap(err, "error detaching old root")
+	}
+	return os.Chdir("/")
+}
+
+// remountReadOnly remounts read-only every mount under root, but /tmp and /proc that are replaced.
+// The flags locked by the parent user namespace, like nosuid and nodev, must be kept on remounts
+func remountReadOnly(root string) error {
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mnt := range mounts {
+		if mnt != root && !strings.HasPrefix(mnt, root+"/") {
+			continue
+		}
+		rel := strings.TrimPrefix(mnt, root)
+		if rel == "/tmp" || strings.HasPrefix(rel, "/tmp/") || rel == "/proc" || strings.HasPrefix(rel, "/proc/") {
+			continue
+		}
+		var st unix.Statfs_t
+		if err := unix.Statfs(mnt, &st); err != nil {
+			// mounts shadowed by other mounts can't be reached from the sandbox
+			continue
+		}
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+		for stFlag, msFlag := range mountFlags {
+			if st.Flags&stFlag != 0 {
+				flags |= msFlag
+			}
+		}
+		if err := unix.Mount("", mnt, "", flags, ""); err != nil {
+			return errors.Wrapf(err, "error remounting %s read-only", rel)
+		}
+	}
+	return nil
+}
+
+// bindRunFile binds the file or directory opened as fd on target, creating the mount point
+func bindRunFile(fd int, target string, readOnly bool) error {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(target); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, nil, 0644); err != nil {
+			return err
+		}
+	}
+	source := fmt.Sprintf("/proc/self/fd/%d", fd)
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	if !readOnly {
+		return nil
+	}
+	return remountReadOnly(target)
+}
+
+// mountFlags maps the statfs flags to the mount flags
+var mountFlags = map[int64]uintptr{
+	unix.ST_NOSUID:      unix.MS_NOSUID,
+	unix.ST_NODEV:       unix.MS_NODEV,
+	unix.ST_NOEXEC:      unix.MS_NOEXEC,
+	unix.ST_NOATIME:     unix.MS_NOATIME,
+	unix.ST_NODIRATIME:  unix.MS_NODIRATIME,
+	unix.ST_RELATIME:    unix.MS_RELATIME,
+	unix.ST_SYNCHRONOUS: unix.MS_SYNCHRONOUS,
+	unix.ST_MANDLOCK:    unix.MS_MANDLOCK,
+}
+
+// mountPoints returns the mount points of the process mount namespace, in mount order
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPoint(fields[4]))
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes of spaces, tabs, newlines and backslashes in mountinfo
+func unescapeMountPoint(path string) string {
+	if !strings.Contains(path, `\`) {
+		return filepath.Clean(path)
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return filepath.Clean(b.String())
+}
+
+// loopbackUp brings up the loopback interface of the empty network namespace of the sandbox
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// dropCapabilities empties the bounding, ambient and inheritable sets, so the engine is executed
+// without capabilities even as the root of the sandbox user namespace
+func dropCapabilities() error {
+	for c := 0; c <= 63; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			if err == unix.EINVAL {
+				break
+			}
+			return err
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return err
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return err
+	}
+	data[0].Inheritable = 0
+	data[1].Inheritable = 0
+	return unix.Capset(&hdr, &data[0])
+}
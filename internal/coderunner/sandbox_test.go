@@ -0,0 +1,135 @@
+package coderunner
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+func TestNewExecutor(t *testing.T) {
+	executor, err := NewExecutor(config.SandboxConfig{Executor: "process"})
+	assert.NoError(t, err)
+	assert.IsType(t, &processExecutor{}, executor)
+
+	executor, err = NewExecutor(config.SandboxConfig{Executor: "sandbox"})
+	assert.NoError(t, err)
+	assert.IsType(t, &sandboxExecutor{}, executor)
+
+	_, err = NewExecutor(config.SandboxConfig{Executor: "docker"})
+	assert.Error(t, err)
+}
+
+func TestUnescapeMountPoint(t *testing.T) {
+	assert.Equal(t, "/mnt/my data", unescapeMountPoint(`/mnt/my\040data`))
+	assert.Equal(t, "/var/lib", unescapeMountPoint("/var/lib/"))
+}
+
+func TestSandboxExecutor(t *testing.T) {
+	if seccompArch == 0 {
+		t.Skip("sandbox is not supported on this arch")
+	}
+	// the runner work directory holds the work dirs of the runs, only the run one is visible
+	runnerDir := t.TempDir()
+	assert.NoError(t, os.Chmod(filepath.Dir(runnerDir), 0755))
+	assert.NoError(t, os.Chmod(runnerDir, 0755))
+	workDir, err := os.MkdirTemp(runnerDir, "code-")
+	assert.NoError(t, err)
+	otherDir, err := os.MkdirTemp(runnerDir, "code-")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(otherDir, "action.py"), nil, 0644))
+	outputDir, err := os.MkdirTemp(runnerDir, "venv-")
+	assert.NoError(t, err)
+	script := strings.Join([]string{
+		"touch /etc/sandbox-test 2>/dev/null && echo etc-writable",
+		"touch /tmp/sandbox-test && echo tmp-writable",
+		"touch main.py 2>/dev/null && echo workdir-writable",
+		"cat main.sh >/dev/null && echo workdir-visible",
+		"ls ../" + filepath.Base(otherDir) + " 2>/dev/null && echo other-visible",
+		"grep -c : /proc/net/dev",
+		"echo $$",
+		"unshare -U true 2>/dev/null || echo unshare-denied",
+		"touch " + filepath.Join(outputDir, "output") + " && echo output-writable",
+	}, "; ")
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "main.sh"), []byte(script), 0644))
+
+	executor := &sandboxExecutor{conf: config.SandboxConfig{Executor: "sandbox", UID: 65534, GID: 65534, TmpSize: "16m"}}
+	cmd := exec.Command("/bin/sh", "main.sh")
+	cmd.Env = []string{"PATH=/usr/bin:/bin"}
+	cmd.Dir = workDir
+	assert.NoError(t, executor.Wrap(&Run{WorkDir: workDir, OutputDir: outputDir}, cmd))
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Skipf("namespaces are not available: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("sandbox failed: %v: %s", err, stderr.String())
+	}
+	assert.Equal(t, "tmp-writable\nworkdir-visible\n1\n1\nunshare-denied\noutput-writable\n", stdout.String())
+	assert.FileExists(t, filepath.Join(outputDir, "output"))
+}
+
+func TestSandboxExecutorEgressProxy(t *testing.T) {
+	if seccompArch == 0 {
+		t.Skip("sandbox is not supported on this arch")
+	}
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is not available")
+	}
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("reached"))
+	}))
+	defer target.Close()
+
+	socketDir := t.TempDir()
+	assert.NoError(t, os.Chmod(filepath.Dir(socketDir), 0755))
+	assert.NoError(t, os.Chmod(socketDir, 0755))
+	proxy, err := egress.NewProxy(filepath.Join(socketDir, "egress.sock"))
+	assert.NoError(t, err)
+	defer proxy.Close()
+
+	run := func(allowed []string) (string, []string) {
+		var blocked []string
+		policy, _ := egress.NewPolicy(&project.EgressPolicy{AllowedCIDRs: allowed})
+		token, err := proxy.Register(policy, func(reason string) { blocked = append(blocked, reason) })
+		assert.NoError(t, err)
+		defer proxy.Unregister(token)
+
+		script := "curl -s -o /dev/null -w '%{http_code}\\n' " + target.URL + "; curl -s --noproxy '*' " + target.URL + " || echo direct-denied"
+		executor := &sandboxExecutor{conf: config.SandboxConfig{Executor: "sandbox", UID: 65534, GID: 65534, TmpSize: "16m"}}
+		cmd := exec.Command("/bin/sh", "-c", script)
+		cmd.Env = append([]string{"PATH=/usr/bin:/bin"}, proxyEnv(proxy.URL(token))...)
+		cmd.Dir = "/"
+		egressRun := &Run{AllowEgress: true, EgressProxy: proxy.Addr(), EgressSocket: proxy.Socket()}
+		assert.NoError(t, executor.Wrap(egressRun, cmd))
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Start(); err != nil {
+			t.Skipf("namespaces are not available: %v", err)
+		}
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("sandbox failed: %v: %s", err, stderr.String())
+		}
+		return stdout.String(), blocked
+	}
+
+	output, blocked := run([]string{"127.0.0.1"})
+	assert.Equal(t, "200\ndirect-denied\n", output)
+	assert.Empty(t, blocked)
+
+	output, blocked = run(nil)
+	assert.Equal(t, "403\ndirect-denied\n", output)
+	assert.Len(t, blocked, 1)
+}
@@ -0,0 +1,7 @@
+package coderunner
+
+import "golang.org/x/sys/unix"
+
+const seccompArch = unix.AUDIT_ARCH_AARCH64
+
+var seccompArchDenied = []uint32{}
@@ -0,0 +1,8 @@
+//go:build !amd64 && !arm64
+
+package coderunner
+
+// the sandbox filter is only built for amd64 and arm64, the sandbox executor fails elsewhere
+const seccompArch = 0
+
+var seccompArchDenied = []uint32{}
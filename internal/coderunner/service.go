@@ -3,61 +3,130 @@ package coderunner
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
-	"time"
 
-	"github.com/containerd/cgroups/v3/cgroup1"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/weni-ai/flows-code-actions/config"
 	"github.com/weni-ai/flows-code-actions/internal/codelog"
 	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"github.com/weni-ai/flows-code-actions/internal/metrics"
 )
 
 var resourceConfig *specs.LinuxResources
 
 type Service struct {
-	codeRun *coderun.Service
-	codeLog *codelog.Service
-	confs   *config.Config
+	codeRun  *coderun.Service
+	codeLog  *codelog.Service
+	secrets  SecretResolver
+	settings CodeSettings
+	executor Executor
+	proxy    *egress.Proxy
+	pyPool   *PythonPool
+	confs    *config.Config
 }
 
-func NewCodeRunnerService(confs *config.Config, coderun *coderun.Service, codelog *codelog.Service) *Service {
-	return &Service{codeRun: coderun, codeLog: codelog, confs: confs}
+func NewCodeRunnerService(confs *config.Config, coderun *coderun.Service, codelog *codelog.Service, secrets SecretResolver, settings CodeSettings) *Service {
+	configureRuntimes(confs.Runtime)
+	return &Service{codeRun: coderun, codeLog: codelog, secrets: secrets, settings: settings, executor: &processExecutor{}, confs: confs}
 }
 
-func (s *Service) RunCode(ctx context.Context, codeID string, code string, language string, params map[string]interface{}, body string, headers map[string]interface{}) (*coderun.CodeRun, error) {
+// SetExecutor replaces the executor of the engine processes, which runs them as plain processes by default
+func (s *Service) SetExecutor(executor Executor) {
+	s.executor = executor
+}
+
+// SetPythonPool runs the python engines on the warm workers of the pool. Sandboxed runs need namespaces of
+// their own, so the pool is only used by the process executor
+func (s *Service) SetPythonPool(pool *PythonPool) {
+	s.pyPool = pool
+	if _, ok := s.executor.(*processExecutor); ok {
+		go pool.warmup("python")
+	}
+}
+
+func (s *Service) RunCode(ctx context.Context, codeID string, codeVersion int, code string, language string, params map[string]interface{}, body string, headers map[string]interface{}) (*coderun.CodeRun, error) {
 	cr := &coderun.CodeRun{
-		CodeID:  codeID,
-		Status:  coderun.StatusStarted,
-		Params:  params,
-		Body:    body,
-		Headers: headers,
+		CodeID:      codeID,
+		CodeVersion: codeVersion,
+		Status:      coderun.StatusStarted,
+		Params:      params,
+		Body:        body,
+		Headers:     headers,
 	}
 
 	newCodeRun, err := s.codeRun.Create(ctx, cr)
 	if err != nil {
 		return nil, err
 	}
+	return s.runCode(ctx, newCodeRun, code, language)
+}
 
-	switch language {
-	case "python":
-		_, err = s.runPython(ctx, codeID, newCodeRun.ID, code, params, body, headers)
-	case "javascript":
-		_, err = runJs(ctx, code)
-	case "go":
-		_, err = runGo(ctx, code)
-	default:
+func (s *Service) QueueCode(ctx context.Context, codeID string, codeVersion int, params map[string]interface{}, body string, headers map[string]interface{}) (*coderun.CodeRun, error) {
+	cr := &coderun.CodeRun{
+		CodeID:      codeID,
+		CodeVersion: codeVersion,
+		Status:      coderun.StatusQueued,
+		Params:      params,
+		Body:        body,
+		Headers:     headers,
+	}
+	return s.codeRun.Create(ctx, cr)
+}
+
+func (s *Service) RunQueued(ctx context.Context, cr *coderun.CodeRun, code string, language string) (*coderun.CodeRun, error) {
+	cr.Status = coderun.StatusStarted
+	startedRun, err := s.codeRun.Update(ctx, cr.ID, cr)
+	if err != nil {
+		return nil, err
+	}
+	return s.runCode(ctx, startedRun, code, language)
+}
+
+func (s *Service) FailRun(ctx context.Context, cr *coderun.CodeRun, reason error) (*coderun.CodeRun, error) {
+	cr.Status = coderun.StatusFailed
+	cr.Result = reason.Error()
+	return s.codeRun.Update(ctx, cr.ID, cr)
+}
+
+// runCode executes a started code run, updating it as completed or failed
+func (s *Service) runCode(ctx context.Context, newCodeRun *coderun.CodeRun, code string, language string) (*coderun.CodeRun, error) {
+	rt, ok := LookupRuntime(language)
+	if !ok {
 		return nil, errors.New("unsupported language code type")
 	}
+
+	run := &Run{
+		CodeID:  newCodeRun.CodeID,
+		RunID:   newCodeRun.ID,
+		Source:  code,
+		Params:  newCodeRun.Params,
+		Body:    newCodeRun.Body,
+		Headers: newCodeRun.Headers,
+	}
+	err := s.resolveSecrets(ctx, run)
+	if err == nil && rt.Language() == "python" {
+		err = s.resolveRequirements(ctx, run)
+	}
+	if err == nil {
+		err = s.resolveEgress(ctx, run)
+	}
+	if err == nil {
+		err = s.resolveEgressPolicy(ctx, run)
+	}
+	if err == nil {
+		err = s.execute(ctx, rt, run)
+	}
 	if err != nil {
 		log.WithError(err).Error(err.Error())
+		// keep what was saved on the run while executing, like its resource usage
+		if savedRun, gerr := s.codeRun.GetByID(ctx, newCodeRun.ID); gerr == nil {
+			newCodeRun = savedRun
+		}
 		newCodeRun.Status = coderun.StatusFailed
 		newCodeRun.Result = errors.Wrap(err, "error on executing code").Error()
 		errcoderun, cerr := s.codeRun.Update(ctx, newCodeRun.ID, newCodeRun)
@@ -81,260 +150,218 @@ func init() {
 	environment = config.Getenv("FLOWS_CODE_ACTIONS_ENVIRONMENT", "local")
 }
 
-func (s *Service) runPython(ctx context.Context, codeID string, coderunID string, code string, params map[string]interface{}, body string, header map[string]interface{}) (string, error) {
-	tempDir, err := os.MkdirTemp("./", "code-")
-	if err != nil {
-		fmt.Println("Error ao criar diretório temporário:", err)
-		return "", err
+// execute runs the code through the given runtime, saving what the engine reported on the code run
+func (s *Service) execute(ctx context.Context, rt Runtime, run *Run) error {
+	if err := rt.Prepare(ctx, run); err != nil {
+		return err
 	}
-	defer os.RemoveAll(tempDir)
+	defer func() {
+		if err := rt.Cleanup(run); err != nil {
+			log.WithError(err).Error("error on cleaning up runtime")
+		}
+	}()
 
-	//TODO: figure out how to handle temporary files dir
-	currentDir := "/home/rafaelsoares/weni/weni-ai/codeactions"
-	if environment != "local" {
-		currentDir = "/app"
-	}
-	sourceFile := currentDir + "/engines/py/main.py"
-	destinatinFile := tempDir + "/main.py"
-	data, err := os.ReadFile(sourceFile)
-	if err != nil {
-		return "", errors.Wrap(err, "Error on reading main file")
-	}
-	err = os.WriteFile(destinatinFile, data, 0644)
+	input, err := newEngineInput(run)
 	if err != nil {
-		return "", errors.Wrap(err, "Error on copy main file")
+		return err
 	}
 
-	codeFile := tempDir + "/action.py"
-	err = os.WriteFile(codeFile, []byte(code), 0644)
+	cmd, err := rt.Execute(ctx, run)
 	if err != nil {
-		return "", errors.Wrap(err, "Error on create code file")
+		return err
 	}
-
-	paramsArgs := ""
-	if len(params) > 0 {
-		paramsArgs = "-a "
-		paramsJson, err := json.Marshal(params)
-		if err != nil {
-			return "", err
+	if len(run.Secrets) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = engineEnv()
 		}
-		paramsArgs += string(paramsJson)
+		cmd.Env = append(cmd.Env, secretEnv(run.Secrets)...)
 	}
-
-	headerArg := ""
-	if len(header) > 0 {
-		headerArg = "-H "
-		headerJson, err := json.Marshal(header)
+	if s.proxy != nil {
+		token, err := s.registerEgress(ctx, run)
 		if err != nil {
-			return "", err
+			return err
+		}
+		defer s.proxy.Unregister(token)
+		if cmd.Env == nil {
+			cmd.Env = engineEnv()
 		}
-		headerArg += string(headerJson)
+		cmd.Env = append(cmd.Env, proxyEnv(s.proxy.URL(token))...)
 	}
-
-	bodyArg := ""
-	if body != "" {
-		bodyArg = fmt.Sprintf("-b %s", body)
+	// the invocation envelope goes through stdin so payloads are neither limited by ARG_MAX nor visible in the process list
+	cmd.Stdin = bytes.NewReader(input)
+	if err := s.executor.Wrap(run, cmd); err != nil {
+		return errors.Wrap(err, "error on setting up executor")
 	}
 
-	idRunArg := fmt.Sprintf("-r %s", coderunID)
-	idCodeArg := fmt.Sprintf("-c %s", codeID)
-
-	var cmd *exec.Cmd
-	if paramsArgs != "" {
-		if bodyArg != "" {
-			cmd = exec.Command("python", tempDir+"/main.py", paramsArgs, bodyArg, idRunArg, idCodeArg, headerArg)
-		} else {
-			cmd = exec.Command("python", tempDir+"/main.py", paramsArgs, idRunArg, idCodeArg, headerArg)
-		}
-	} else {
-		if bodyArg != "" {
-			cmd = exec.Command("python", tempDir+"/main.py", bodyArg, idRunArg, idCodeArg, headerArg)
-		} else {
-			cmd = exec.Command("python", tempDir+"/main.py", idRunArg, idCodeArg, headerArg)
-		}
+	var pool *PythonPool
+	if _, ok := s.executor.(*processExecutor); ok && rt.Language() == "python" {
+		pool = s.pyPool
 	}
-	
-	// Pass environment variables to Python process
-	cmd.Env = os.Environ()
-	
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Start(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("process took too long. out: %s, err: %s", stdout.String(), stderr.String())
-		}
+	_, output, err := s.runEngine(ctx, run, cmd, pool)
+	if saveErr := s.saveEngineOutput(context.WithoutCancel(ctx), run, output); saveErr != nil {
+		log.WithError(saveErr).Error("error on saving engine output")
 	}
+	return err
+}
 
-	if s.confs.ResourceManagement.Enabled {
-		cg, err := InitCGroup(ctx, s.confs, codeID)
-		if err != nil {
-			return "", err
-		}
-		cg.AddProc(uint64(cmd.Process.Pid))
+// resolveSecrets loads the secrets of the run code, when there is a secret resolver
+func (s *Service) resolveSecrets(ctx context.Context, run *Run) error {
+	if s.secrets == nil {
+		return nil
 	}
+	secrets, err := s.secrets.ResolveSecrets(ctx, run.CodeID)
+	if err != nil {
+		return errors.Wrap(err, "error on resolving code secrets")
+	}
+	run.Secrets = secrets
+	return nil
+}
 
-	if err := cmd.Wait(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("process took too long. out: %s, err: %s", stdout.String(), stderr.String())
-		}
+// resolveRequirements loads the python requirements of the run code project, when there is a resolver, and
+// selects the interpreter of their virtualenv
+func (s *Service) resolveRequirements(ctx context.Context, run *Run) error {
+	if s.settings == nil {
+		return nil
 	}
-	if stdout.String() != "" {
-		log.Println("code run stdout: ", stdout.String())
+	requirements, err := s.settings.PythonRequirements(ctx, run.CodeID)
+	if err != nil {
+		return errors.Wrap(err, "error on resolving python requirements")
 	}
-	if stderr.String() != "" {
-		return stderr.String(), fmt.Errorf("error executing code: %s", stderr.String())
+	run.Requirements = requirements
+	if len(requirements) == 0 {
+		return nil
 	}
-	return stdout.String(), nil
+	python, err := s.pythonVenv(ctx, requirements)
+	if err != nil {
+		return err
+	}
+	run.Interpreter = python
+	return nil
 }
 
-func runJs(ctx context.Context, code string) (string, error) {
-	cmd := exec.Command("node", "-e", code)
-	codeBuffer := bytes.NewBufferString(code)
-	cmd.Stdin = codeBuffer
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("process took too long. out: %s, err: %s", stdout.String(), stderr.String())
-		}
+// resolveEgress loads whether the run code keeps the network access, only needed by the sandbox executor
+func (s *Service) resolveEgress(ctx context.Context, run *Run) error {
+	if s.settings == nil {
+		return nil
 	}
-	if stderr.String() != "" {
-		return "", fmt.Errorf("error executing code: %s", stderr.String())
+	if _, ok := s.executor.(*sandboxExecutor); !ok {
+		return nil
 	}
-	return stdout.String(), nil
-}
-
-func runGo(ctx context.Context, code string) (string, error) {
-	tmpDir, err := os.MkdirTemp("", "coderunner")
+	allow, err := s.settings.AllowEgress(ctx, run.CodeID)
 	if err != nil {
-		return "", err
+		return errors.Wrap(err, "error on resolving code egress")
 	}
-	defer os.RemoveAll(tmpDir)
+	run.AllowEgress = allow
+	return nil
+}
 
-	if err := os.WriteFile(tmpDir+"/main.go", []byte(code), 0644); err != nil {
-		return "", fmt.Errorf("error creating temp file %q: %v", tmpDir, err)
+// runEngine starts the engine process in a cgroup of the run when resource management is enabled, and
+// collects what the engine reported on its output channel. Logs are saved as soon as the engine sends them.
+// With a python pool the engine is forked by a warm worker, falling back to a new process when it fails
+func (s *Service) runEngine(ctx context.Context, run *Run, cmd *exec.Cmd, pool *PythonPool) (string, *engineOutput, error) {
+	// logs sent right before a timeout must still be saved
+	logCtx := context.WithoutCancel(ctx)
+	channel, err := newOutputChannel(func(msg engineMessage) {
+		s.saveEngineLog(logCtx, run.CodeID, run.RunID, msg)
+	})
+	if err != nil {
+		return "", nil, err
 	}
+	cmd.ExtraFiles = []*os.File{channel.writer}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", engineOutputFDEnv, engineOutputFD))
 
-	goCache := filepath.Join(tmpDir, "gocache")
-	cmd := exec.CommandContext(ctx, "go", "run", tmpDir+"/main.go")
-	var goPath string
-	cmd.Env = []string{"GOCACHE=" + goCache}
-
-	useModules := false
-	if useModules {
-		// Create a GOPATH just for modules to be downloaded
-		// into GOPATH/pkg/mod.
-		goPath, err = os.MkdirTemp("", "gopath")
+	var cg runCgroup
+	if s.confs.ResourceManagement.Enabled {
+		cg, err = newRunCgroup(s.confs, run.RunID)
+		if err == nil {
+			defer func() {
+				if err := cg.delete(); err != nil {
+					log.WithError(err).Warn("error on deleting run cgroup")
+				}
+			}()
+			if pool == nil {
+				err = cg.prepare(cmd)
+			}
+		}
 		if err != nil {
-			return "", fmt.Errorf("error creating temp directory: %v", err)
+			channel.writer.Close()
+			channel.reader.Close()
+			return "", nil, err
 		}
-		defer os.RemoveAll(goPath)
-		cmd.Env = append(cmd.Env, "GO111MODULE=on", "GOPROXY=https://proxy.golang.org")
-	} else {
-		goPath = os.Getenv("GOPATH")
-		cmd.Env = append(cmd.Env, "GO111MODULE=off")
 	}
 
-	cmd.Env = append(cmd.Env, "GOPATH="+goPath)
-	var recOut bytes.Buffer
-	var recErr bytes.Buffer
-	cmd.Stdout = &recOut
-	cmd.Stderr = &recErr
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("process took too long. out: %s, err: %s", recOut.String(), recErr.String())
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	var proc engineProcess
+	if pool != nil {
+		if proc, err = pool.start(ctx, cmd, &stdout, &stderr); err != nil {
+			log.WithError(err).Warn("error on starting engine on python worker")
+			proc, err = nil, nil
+			if cg != nil {
+				err = cg.prepare(cmd)
+			}
 		}
 	}
-	if recErr.String() != "" {
-		return "", fmt.Errorf("error executing code: %s", recErr.String())
+	if proc == nil && err == nil {
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		proc, err = startCmdProcess(cmd)
 	}
-	return recOut.String(), nil
-}
-
-// ------------------------------------------------
-
-func compileGoAndRun(code string) (string, error) {
-	tmpDir, err := os.MkdirTemp("", "coderunner")
 	if err != nil {
-		return "", err
-	}
-	defer os.RemoveAll(tmpDir)
-
-	// var buildPkgArg = "."
-
-	if err := os.WriteFile(tmpDir+"/main.go", []byte(code), 0644); err != nil {
-		return "", fmt.Errorf("error creating temp file %q: %v", tmpDir, err)
+		channel.writer.Close()
+		channel.reader.Close()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", nil, fmt.Errorf("process took too long. out: %s, err: %s", stdout.String(), stderr.String())
+		}
+		return "", nil, errors.Wrap(err, "error on starting engine process")
 	}
+	channel.start()
 
-	exe := filepath.Join(tmpDir, "a.out")
-	goCache := filepath.Join(tmpDir, "gocache")
-	cmd := exec.Command("go", "build", "-C", tmpDir, "-o", exe)
-	var goPath string
-	// cmd.Env = []string{"GOOS=nacl", "GOARCH=amd64p32", "GOCACHE=" + goCache}
-	cmd.Env = []string{"GOCACHE=" + goCache}
-
-	useModules := false
-	if useModules {
-		// Create a GOPATH just for modules to be downloaded
-		// into GOPATH/pkg/mod.
-		goPath, err = os.MkdirTemp("", "gopath")
-		if err != nil {
-			return "", fmt.Errorf("error creating temp directory: %v", err)
+	if cg != nil {
+		if err := cg.attach(proc.pid()); err != nil {
+			proc.kill()
+			proc.wait()
+			channel.wait()
+			return "", nil, errors.Wrap(err, "error on adding engine process to cgroup")
 		}
-		defer os.RemoveAll(goPath)
-		cmd.Env = append(cmd.Env, "GO111MODULE=on", "GOPROXY=https://proxy.golang.org")
-	} else {
-		goPath = os.Getenv("GOPATH")
-		cmd.Env = append(cmd.Env, "GO111MODULE=off")
 	}
-	cmd.Env = append(cmd.Env, "GOPATH="+goPath)
+	proc.resume()
 
-	if out, err := cmd.CombinedOutput(); err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
-			errs := strings.Replace(string(out), tmpDir+"/", "", -1)
-			errs = strings.Replace(errs, "# command-line-arguments\n", "", 1)
-			return "", errors.New("errors: " + errs)
-		}
-		return "", fmt.Errorf("error building go source: %v", err)
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, exe)
-	var recOut bytes.Buffer
-	var recErr bytes.Buffer
-	cmd.Stdout = &recOut
-	cmd.Stderr = &recErr
-	if err := cmd.Run(); err != nil {
+	waitErr := proc.wait()
+	output := channel.wait()
+	if cg != nil {
+		s.recordUsage(run, cg)
+	}
+	if waitErr != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("process took too long. out: %s, err: %s", recOut.String(), recErr.String())
+			return "", output, fmt.Errorf("process took too long. out: %s, err: %s", stdout.String(), stderr.String())
+		}
+		if run.Usage != nil && run.Usage.OOMKilled {
+			return "", output, fmt.Errorf("process exceeded the memory limit. out: %s, err: %s", stdout.String(), stderr.String())
 		}
 	}
-	return recOut.String(), nil
+	if stdout.String() != "" {
+		log.Println("code run stdout: ", stdout.String())
+	}
+	if stderr.String() != "" {
+		return stderr.String(), output, fmt.Errorf("error executing code: %s", stderr.String())
+	}
+	return stdout.String(), output, nil
 }
 
-// InitCGroup load or create a new CGroup for the given code
-func InitCGroup(ctx context.Context, config *config.Config, codeID string) (cgroup1.Cgroup, error) {
-	cgpath := cgroup1.StaticPath("/" + codeID)
-	cg, err := cgroup1.Load(cgpath)
+// recordUsage reads the resources used by the run from its cgroup, exporting them as metrics
+func (s *Service) recordUsage(run *Run, cg runCgroup) {
+	usage, err := cg.usage()
 	if err != nil {
-		resources := ResourceConfig(config)
-		cg, err = cgroup1.New(
-			cgpath,
-			resources,
-		)
-		if err != nil {
-			err = errors.Wrap(err, "failed to create cgroup")
-			log.Error(err)
-			return nil, err
-		}
+		log.WithError(err).Warn("error on reading run resource usage")
+		return
+	}
+	run.Usage = usage
+	metrics.ObserveCodeRunPeakMemory(run.CodeID, float64(usage.PeakMemory))
+	metrics.ObserveCodeRunCPUTime(run.CodeID, usage.CPUTime)
+	if usage.OOMKilled {
+		metrics.AddCodeRunOOMKilledCount(run.CodeID, 1)
 	}
-	return cg, nil
 }
 
 // ResourceConfig returns a resource config for the given application configuration
@@ -1 +1,23 @@
 package coderunner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEngineInput(t *testing.T) {
+	input, err := newEngineInput(&Run{
+		CodeID:  "code-1",
+		RunID:   "run-1",
+		Params:  map[string]interface{}{"name": "bob"},
+		Body:    "-b {\"x\":1}\n",
+		Headers: map[string]interface{}{"X-Custom": []string{"1"}},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"run_id":"run-1","code_id":"code-1","params":{"name":"bob"},"body":"-b {\"x\":1}\n","headers":{"X-Custom":["1"]}}`, string(input))
+
+	input, err = newEngineInput(&Run{CodeID: "code-1", RunID: "run-1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"run_id":"run-1","code_id":"code-1","params":{},"body":"","headers":{}}`, string(input))
+}
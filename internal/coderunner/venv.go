@@ -0,0 +1,219 @@
+package coderunner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+const (
+	// venvInstallTimeout bounds the installation of a virtualenv, which goes on when the run waiting for it ends
+	venvInstallTimeout = 10 * time.Minute
+	// venvRetryDelay is how long a failed installation is reported before being tried again
+	venvRetryDelay = time.Minute
+)
+
+// venvsDir is where the python virtualenvs of the project requirements are installed
+var venvsDir = ""
+
+// venvInstall is an installation of a virtualenv, shared by the runs waiting for it
+type venvInstall struct {
+	done     chan struct{}
+	err      error
+	failedAt time.Time
+}
+
+var (
+	venvInstalls   = map[string]*venvInstall{}
+	venvInstallsMu sync.Mutex
+
+	pythonVersion     string
+	pythonVersionOnce sync.Once
+)
+
+// pythonVenv returns the interpreter of the virtualenv with the requirements, installing it on the first use.
+// Virtualenvs are addressed by the hash of the requirements and of the base interpreter version, so projects
+// with the same requirements share them. They include the system site packages, with the pinned versions
+// taking precedence over the libraries installed globally. Only the libraries of the allow list are installed
+func (s *Service) pythonVenv(ctx context.Context, requirements []string) (string, error) {
+	if err := project.CheckAllowedRequirements(requirements, s.confs.GetCodeLibAllowList()); err != nil {
+		return "", err
+	}
+	key := venvKey(requirements)
+	dir := filepath.Join(venvsDir, key)
+	python := filepath.Join(dir, "bin", "python")
+	if _, err := os.Stat(filepath.Join(dir, ".ready")); err == nil {
+		return python, nil
+	}
+
+	venvInstallsMu.Lock()
+	install, ok := venvInstalls[key]
+	if ok {
+		select {
+		case <-install.done:
+			ok = install.err == nil || time.Since(install.failedAt) < venvRetryDelay
+		default:
+		}
+	}
+	if !ok {
+		install = &venvInstall{done: make(chan struct{})}
+		venvInstalls[key] = install
+		go func() {
+			install.err = s.installVenv(key, dir, requirements)
+			if install.err != nil {
+				install.failedAt = time.Now()
+			}
+			close(install.done)
+		}()
+	}
+	venvInstallsMu.Unlock()
+
+	select {
+	case <-install.done:
+		if install.err != nil {
+			return "", install.err
+		}
+		return python, nil
+	case <-ctx.Done():
+		return "", errors.Wrap(ctx.Err(), "timeout waiting for python requirements installation")
+	}
+}
+
+// installVenv creates the virtualenv on a temporary directory, moved to dir once the requirements are installed.
+// pip runs as the code runs do, in the sandbox and the cgroup of a run, only reaching the package index, and
+// installs wheels alone, so no code of the libraries is executed on the installation
+func (s *Service) installVenv(key string, dir string, requirements []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), venvInstallTimeout)
+	defer cancel()
+
+	if err := os.MkdirAll(venvsDir, 0755); err != nil {
+		return errors.Wrap(err, "error creating python venvs directory")
+	}
+	tmpDir, err := os.MkdirTemp(venvsDir, ".install-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	// MkdirTemp is private to the runner, the virtualenv is also used by the sandboxed runs
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	install := &Run{
+		RunID:        "venv-" + key,
+		OutputDir:    tmpDir,
+		AllowEgress:  true,
+		EgressPolicy: &project.EgressPolicy{AllowedDomains: s.confs.GetPythonIndexDomains()},
+	}
+	log.WithField("requirements", requirements).Info("installing python requirements")
+	if err := s.runInstallCommand(ctx, install, "python", "-m", "venv", "--system-site-packages", tmpDir); err != nil {
+		return errors.Wrap(err, "error creating python venv")
+	}
+	reqFile := filepath.Join(tmpDir, "requirements.txt")
+	if err := os.WriteFile(reqFile, []byte(strings.Join(requirements, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	pip := []string{"-m", "pip", "install", "--no-cache-dir", "--disable-pip-version-check",
+		"--only-binary", ":all:", "--index-url", s.confs.Runtime.PythonIndexURL, "-r", reqFile}
+	if err := s.runInstallCommand(ctx, install, filepath.Join(tmpDir, "bin", "python"), pip...); err != nil {
+		return errors.Wrap(err, "error installing python requirements")
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ".ready"), nil, 0644); err != nil {
+		return err
+	}
+
+	// rename is atomic, a virtualenv installed meanwhile by another process is kept
+	if err := os.Rename(tmpDir, dir); err != nil {
+		if _, serr := os.Stat(filepath.Join(dir, ".ready")); serr == nil {
+			return nil
+		}
+		return errors.Wrap(err, "error moving python venv")
+	}
+	return nil
+}
+
+// runInstallCommand runs a command of the installation through the executor of the runs, in a cgroup of its own
+// when resource management is enabled, connecting through the egress proxy under the installation policy
+func (s *Service) runInstallCommand(ctx context.Context, install *Run, name string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	// the installation needs no files of the runner work directory
+	cmd.Dir = "/"
+	cmd.Env = engineEnv()
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if s.proxy != nil {
+		policy, err := egress.NewPolicy(install.EgressPolicy)
+		if err != nil {
+			return errors.Wrap(err, "error on compiling egress policy")
+		}
+		token, err := s.proxy.Register(policy, func(reason string) {
+			log.WithField("run_id", install.RunID).Warn(reason)
+		})
+		if err != nil {
+			return errors.Wrap(err, "error on registering installation on egress proxy")
+		}
+		defer s.proxy.Unregister(token)
+		install.EgressProxy = s.proxy.Addr()
+		install.EgressSocket = s.proxy.Socket()
+		cmd.Env = append(cmd.Env, proxyEnv(s.proxy.URL(token))...)
+	}
+	if err := s.executor.Wrap(install, cmd); err != nil {
+		return errors.Wrap(err, "error on setting up executor")
+	}
+
+	var cg runCgroup
+	if s.confs.ResourceManagement.Enabled {
+		var err error
+		if cg, err = newRunCgroup(s.confs, install.RunID); err != nil {
+			return err
+		}
+		defer func() {
+			if err := cg.delete(); err != nil {
+				log.WithError(err).Warn("error on deleting installation cgroup")
+			}
+		}()
+		if err := cg.prepare(cmd); err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if cg != nil {
+		if err := cg.attach(cmd.Process.Pid); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return errors.Wrap(err, "error on adding installation process to cgroup")
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return errors.Wrap(err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// venvKey is the content address of the virtualenv of the requirements, which are normalized by the project
+func venvKey(requirements []string) string {
+	pythonVersionOnce.Do(func() {
+		out, err := exec.Command("python", "-c", "import sys; print(sys.version)").Output()
+		if err != nil {
+			log.WithError(err).Warn("error getting python version")
+		}
+		pythonVersion = strings.TrimSpace(string(out))
+	})
+	hash := sha256.Sum256([]byte(pythonVersion + "\n" + strings.Join(requirements, "\n")))
+	return hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,42 @@
+package codeversion
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a code has no such version
+var ErrNotFound = errors.New("code version not found")
+
+// CodeVersion is an immutable revision of a code source. Versions of a code are numbered from 1
+type CodeVersion struct {
+	ID            string `json:"id,omitempty"`                                   // PostgreSQL UUID (primary key)
+	MongoObjectID string `json:"mongo_object_id,omitempty" bson:"_id,omitempty"` // MongoDB ObjectID for backward compatibility
+
+	CodeID  string `bson:"code_id" json:"code_id"`
+	Version int    `bson:"version" json:"version"`
+	Source  string `bson:"source" json:"source"`
+	// RollbackOf is the version restored by this one, when it was created by a rollback
+	RollbackOf int `bson:"rollback_of,omitempty" json:"rollback_of,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type UseCase interface {
+	Create(ctx context.Context, version *CodeVersion) (*CodeVersion, error)
+	Get(ctx context.Context, codeID string, version int) (*CodeVersion, error)
+	ListByCodeID(ctx context.Context, codeID string) ([]CodeVersion, error)
+	DeleteByCodeID(ctx context.Context, codeID string) error
+}
+
+type Repository interface {
+	Create(context.Context, *CodeVersion) (*CodeVersion, error)
+	Get(ctx context.Context, codeID string, version int) (*CodeVersion, error)
+	ListByCodeID(ctx context.Context, codeID string) ([]CodeVersion, error)
+	DeleteByCodeID(ctx context.Context, codeID string) error
+}
+
+func NewCodeVersion(codeID string, version int, source string) *CodeVersion {
+	return &CodeVersion{CodeID: codeID, Version: version, Source: source}
+}
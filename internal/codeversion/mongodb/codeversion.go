@@ -0,0 +1,71 @@
+package codeversion
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type codeVersionRepo struct {
+	collection *mongo.Collection
+}
+
+func NewCodeVersionRepository(db *mongo.Database) codeversion.Repository {
+	collection := db.Collection("code_version")
+	return &codeVersionRepo{collection: collection}
+}
+
+func (r *codeVersionRepo) Create(ctx context.Context, cv *codeversion.CodeVersion) (*codeversion.CodeVersion, error) {
+	cv.CreatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, cv)
+	if err != nil {
+		return nil, err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		cv.ID = oid.Hex()
+		cv.MongoObjectID = oid.Hex()
+	}
+	return cv, nil
+}
+
+func (r *codeVersionRepo) Get(ctx context.Context, codeID string, version int) (*codeversion.CodeVersion, error) {
+	cv := &codeversion.CodeVersion{}
+	err := r.collection.FindOne(ctx, bson.M{"code_id": codeID, "version": version}).Decode(cv)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, codeversion.ErrNotFound
+		}
+		return nil, err
+	}
+	cv.ID = cv.MongoObjectID
+	return cv, nil
+}
+
+func (r *codeVersionRepo) ListByCodeID(ctx context.Context, codeID string) ([]codeversion.CodeVersion, error) {
+	versions := []codeversion.CodeVersion{}
+	opts := options.Find().SetSort(bson.M{"version": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"code_id": codeID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		versions[i].ID = versions[i].MongoObjectID
+	}
+	return versions, nil
+}
+
+func (r *codeVersionRepo) DeleteByCodeID(ctx context.Context, codeID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"code_id": codeID})
+	return err
+}
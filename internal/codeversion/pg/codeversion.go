@@ -0,0 +1,133 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+
+	_ "github.com/lib/pq"
+)
+
+type codeVersionRepo struct {
+	db *sql.DB
+}
+
+// NewCodeVersionRepository creates a new PostgreSQL repository for code version entities
+func NewCodeVersionRepository(db *sql.DB) codeversion.Repository {
+	return &codeVersionRepo{db: db}
+}
+
+func (r *codeVersionRepo) Create(ctx context.Context, cv *codeversion.CodeVersion) (*codeversion.CodeVersion, error) {
+	query := `
+		INSERT INTO code_versions (code_id, version, source, rollback_of, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	cv.CreatedAt = time.Now()
+
+	var id string
+	err := r.db.QueryRowContext(ctx, query,
+		cv.CodeID,
+		cv.Version,
+		cv.Source,
+		nullInt(cv.RollbackOf),
+		cv.CreatedAt,
+	).Scan(&id)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating code version")
+	}
+
+	cv.ID = id
+	return cv, nil
+}
+
+func (r *codeVersionRepo) Get(ctx context.Context, codeID string, version int) (*codeversion.CodeVersion, error) {
+	query := `
+		SELECT id, code_id, version, source, rollback_of, created_at
+		FROM code_versions
+		WHERE code_id = $1 AND version = $2`
+
+	cv := &codeversion.CodeVersion{}
+	var rollbackOf sql.NullInt64
+
+	err := r.db.QueryRowContext(ctx, query, codeID, version).Scan(
+		&cv.ID,
+		&cv.CodeID,
+		&cv.Version,
+		&cv.Source,
+		&rollbackOf,
+		&cv.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, codeversion.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "error getting code version")
+	}
+
+	cv.RollbackOf = int(rollbackOf.Int64)
+	return cv, nil
+}
+
+func (r *codeVersionRepo) ListByCodeID(ctx context.Context, codeID string) ([]codeversion.CodeVersion, error) {
+	query := `
+		SELECT id, code_id, version, source, rollback_of, created_at
+		FROM code_versions
+		WHERE code_id = $1
+		ORDER BY version DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, codeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing code versions")
+	}
+	defer rows.Close()
+
+	versions := []codeversion.CodeVersion{}
+	for rows.Next() {
+		var cv codeversion.CodeVersion
+		var rollbackOf sql.NullInt64
+
+		err := rows.Scan(
+			&cv.ID,
+			&cv.CodeID,
+			&cv.Version,
+			&cv.Source,
+			&rollbackOf,
+			&cv.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning code version row")
+		}
+
+		cv.RollbackOf = int(rollbackOf.Int64)
+		versions = append(versions, cv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating code version rows")
+	}
+
+	return versions, nil
+}
+
+func (r *codeVersionRepo) DeleteByCodeID(ctx context.Context, codeID string) error {
+	query := `DELETE FROM code_versions WHERE code_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, codeID); err != nil {
+		return errors.Wrap(err, "error deleting code versions")
+	}
+	return nil
+}
+
+// nullInt converts a zero int to a NULL value
+func nullInt(i int) sql.NullInt64 {
+	if i == 0 {
+		return sql.NullInt64{Valid: false}
+	}
+	return sql.NullInt64{Int64: int64(i), Valid: true}
+}
@@ -0,0 +1,21 @@
+-- PostgreSQL schema for code_versions table
+-- Immutable revisions of the code sources, one for every source change
+
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+CREATE TABLE IF NOT EXISTS code_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code_id UUID NOT NULL REFERENCES codes(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL CHECK (version > 0),
+    source TEXT NOT NULL,
+    rollback_of INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for better performance
+CREATE UNIQUE INDEX IF NOT EXISTS idx_code_versions_code_id_version ON code_versions(code_id, version);
+
+-- Comments
+COMMENT ON TABLE code_versions IS 'Immutable revisions of the code sources';
+COMMENT ON COLUMN code_versions.version IS 'Revision number of the code, starting at 1';
+COMMENT ON COLUMN code_versions.rollback_of IS 'Version restored by this revision, when created by a rollback';
@@ -0,0 +1,27 @@
+package codeversion
+
+import "context"
+
+type Service struct {
+	repo Repository
+}
+
+func NewCodeVersionService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) Create(ctx context.Context, version *CodeVersion) (*CodeVersion, error) {
+	return s.repo.Create(ctx, version)
+}
+
+func (s *Service) Get(ctx context.Context, codeID string, version int) (*CodeVersion, error) {
+	return s.repo.Get(ctx, codeID, version)
+}
+
+func (s *Service) ListByCodeID(ctx context.Context, codeID string) ([]CodeVersion, error) {
+	return s.repo.ListByCodeID(ctx, codeID)
+}
+
+func (s *Service) DeleteByCodeID(ctx context.Context, codeID string) error {
+	return s.repo.DeleteByCodeID(ctx, codeID)
+}
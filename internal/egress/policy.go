@@ -0,0 +1,110 @@
+package egress
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+// privateNetworks are the ranges denied unless allowed by a CIDR of the policy: internal networks,
+// loopback, link local ones with the cloud metadata endpoints, and the ones not routable on the internet
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/3",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// Policy is a compiled project egress policy
+type Policy struct {
+	domains  []string
+	networks []*net.IPNet
+}
+
+// NewPolicy compiles the project egress policy
+func NewPolicy(p *project.EgressPolicy) (*Policy, error) {
+	policy := &Policy{}
+	if p == nil {
+		return policy, nil
+	}
+	for _, domain := range p.AllowedDomains {
+		policy.domains = append(policy.domains, strings.ToLower(domain))
+	}
+	for _, cidr := range p.AllowedCIDRs {
+		network, err := project.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		policy.networks = append(policy.networks, network)
+	}
+	return policy, nil
+}
+
+// Check returns why connecting to the ip the host resolved to is denied, or nil when it is allowed
+func (p *Policy) Check(host string, ip net.IP) error {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if IsPrivate(ip) {
+		return fmt.Errorf("%s is a private address", ip)
+	}
+	if len(p.domains) == 0 && len(p.networks) == 0 {
+		return nil
+	}
+	if p.matchDomain(host) {
+		return nil
+	}
+	return fmt.Errorf("%s is not an allowed destination", host)
+}
+
+// matchDomain reports if the host is an allowed domain or a subdomain of an allowed wildcard
+func (p *Policy) matchDomain(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range p.domains {
+		if suffix, ok := strings.CutPrefix(domain, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivate reports if the ip is on an internal, loopback, link local or not routable network
+func IsPrivate(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
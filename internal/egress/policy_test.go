@@ -0,0 +1,36 @@
+package egress
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	public := net.ParseIP("93.184.216.34")
+
+	policy, err := NewPolicy(&project.EgressPolicy{})
+	assert.NoError(t, err)
+	assert.NoError(t, policy.Check("example.com", public))
+	assert.Error(t, policy.Check("metadata.google.internal", net.ParseIP("169.254.169.254")))
+	assert.Error(t, policy.Check("localhost", net.ParseIP("127.0.0.1")))
+	assert.Error(t, policy.Check("internal", net.ParseIP("10.0.0.5")))
+	assert.Error(t, policy.Check("internal", net.ParseIP("::ffff:192.168.1.1")))
+	assert.Error(t, policy.Check("internal", net.ParseIP("fd00::1")))
+
+	policy, err = NewPolicy(&project.EgressPolicy{
+		AllowedDomains: []string{"api.example.com", "*.weni.ai"},
+		AllowedCIDRs:   []string{"10.1.0.0/16"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, policy.Check("api.example.com", public))
+	assert.NoError(t, policy.Check("flows.weni.ai", public))
+	assert.Error(t, policy.Check("weni.ai", public))
+	assert.Error(t, policy.Check("example.com", public))
+	assert.NoError(t, policy.Check("db.internal", net.ParseIP("10.1.2.3")))
+	assert.Error(t, policy.Check("db.internal", net.ParseIP("10.2.0.1")))
+	// allowed domains don't allow private addresses they resolve to
+	assert.Error(t, policy.Check("api.example.com", net.ParseIP("169.254.169.254")))
+}
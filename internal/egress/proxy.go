@@ -0,0 +1,326 @@
+package egress
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const dialTimeout = 10 * time.Second
+
+// hopHeaders are the headers of the connection to the proxy, not forwarded to the destination
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// BlockedFunc is called with the reason of each connection of a run denied by its policy
+type BlockedFunc func(reason string)
+
+// Proxy is the HTTP proxy the engines connect through, enforcing the egress policy of each run. Runs are
+// registered with their policy and authenticate with the token they get, as the proxy password. Hosts are
+// resolved by the proxy and the checked addresses are dialed, so a host can't be rebound to another one
+type Proxy struct {
+	server   *http.Server
+	tcp      net.Listener
+	socket   string
+	resolver *net.Resolver
+
+	mu   sync.RWMutex
+	runs map[string]*proxyRun
+}
+
+type proxyRun struct {
+	policy    *Policy
+	blocked   BlockedFunc
+	resolver  *net.Resolver
+	transport *http.Transport
+}
+
+// BlockedError is returned when dialing a destination denied by the policy of the run
+type BlockedError struct {
+	Address string
+	Reason  error
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("egress to %s blocked by the project network policy: %s", e.Address, e.Reason)
+}
+
+// NewProxy starts the proxy on a loopback port and on the unix socket, the only way to reach it from
+// sandboxes without network. The socket defaults to one of the process in the temporary directory
+func NewProxy(socket string) (*Proxy, error) {
+	if socket == "" {
+		socket = filepath.Join(os.TempDir(), fmt.Sprintf("codeactions-egress-%d.sock", os.Getpid()))
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(socket)
+	unix, err := net.Listen("unix", socket)
+	if err != nil {
+		tcp.Close()
+		return nil, err
+	}
+	// sandboxed engines run as another user
+	if err := os.Chmod(socket, 0666); err != nil {
+		tcp.Close()
+		unix.Close()
+		return nil, err
+	}
+
+	p := &Proxy{tcp: tcp, socket: socket, resolver: net.DefaultResolver, runs: map[string]*proxyRun{}}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	for _, l := range []net.Listener{tcp, unix} {
+		go func(l net.Listener) {
+			if err := p.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.WithError(err).Error("egress proxy stopped")
+			}
+		}(l)
+	}
+	return p, nil
+}
+
+// Addr is the loopback address of the proxy
+func (p *Proxy) Addr() string {
+	return p.tcp.Addr().String()
+}
+
+// Socket is the path of the unix socket of the proxy
+func (p *Proxy) Socket() string {
+	return p.socket
+}
+
+// Close stops the proxy and removes its socket
+func (p *Proxy) Close() error {
+	err := p.server.Close()
+	os.Remove(p.socket)
+	return err
+}
+
+// Register allows a run to connect through the proxy under the policy, returning the token it authenticates
+// with. Blocked connections are reported to the blocked func
+func (p *Proxy) Register(policy *Policy, blocked BlockedFunc) (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(key)
+
+	run := &proxyRun{policy: policy, blocked: blocked, resolver: p.resolver}
+	// each run gets its own connection pool, so runs never share a connection
+	run.transport = &http.Transport{
+		Proxy:                 nil,
+		DialContext:           run.dial,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	p.mu.Lock()
+	p.runs[token] = run
+	p.mu.Unlock()
+	return token, nil
+}
+
+// Unregister stops accepting the token of a run, once it finished
+func (p *Proxy) Unregister(token string) {
+	p.mu.Lock()
+	run := p.runs[token]
+	delete(p.runs, token)
+	p.mu.Unlock()
+	if run != nil {
+		run.transport.CloseIdleConnections()
+	}
+}
+
+// URL is the proxy url the engine of a run uses, on the proxy loopback address
+func (p *Proxy) URL(token string) string {
+	return fmt.Sprintf("http://run:%s@%s", token, p.Addr())
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	run := p.authenticate(r)
+	if run == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="code actions egress"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.connect(w, r, run)
+		return
+	}
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only absolute http urls are proxied, use CONNECT for https", http.StatusBadRequest)
+		return
+	}
+	p.forward(w, r, run)
+}
+
+// authenticate returns the registered run of the token sent as the proxy password
+func (p *Proxy) authenticate(r *http.Request) *proxyRun {
+	auth := r.Header.Get("Proxy-Authorization")
+	if auth == "" {
+		return nil
+	}
+	req := &http.Request{Header: http.Header{"Authorization": {auth}}}
+	_, token, ok := req.BasicAuth()
+	if !ok {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.runs[token]
+}
+
+// connect tunnels a connection to the requested destination, when allowed
+func (p *Proxy) connect(w http.ResponseWriter, r *http.Request, run *proxyRun) {
+	upstream, err := run.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		run.dialFailed(w, err)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection can't be tunneled", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	// the client may have sent data right after the request
+	if n := buffered.Reader.Buffered(); n > 0 {
+		data, _ := buffered.Reader.Peek(n)
+		if _, err := upstream.Write(data); err != nil {
+			client.Close()
+			upstream.Close()
+			return
+		}
+	}
+	Pipe(client, upstream)
+}
+
+// forward sends a plain http request to its destination, when allowed
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, run *proxyRun) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := run.transport.RoundTrip(out)
+	if err != nil {
+		run.dialFailed(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// dial connects to the first allowed address the host resolves to
+func (r *proxyRun) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := r.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	var denied, dialErr error
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	for _, ip := range ips {
+		if err := r.policy.Check(host, ip); err != nil {
+			denied = err
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	if denied == nil {
+		denied = fmt.Errorf("%s has no address", host)
+	}
+	return nil, &BlockedError{Address: address, Reason: denied}
+}
+
+// dialFailed replies to a request that could not reach its destination, reporting it when blocked
+func (r *proxyRun) dialFailed(w http.ResponseWriter, err error) {
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		if r.blocked != nil {
+			r.blocked(blocked.Error())
+		}
+		http.Error(w, blocked.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// Pipe copies the data between both connections until one of them is closed
+func Pipe(a net.Conn, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
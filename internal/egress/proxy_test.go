@@ -0,0 +1,72 @@
+package egress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+func TestProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure hello"))
+	}))
+	defer tlsTarget.Close()
+
+	proxy, err := NewProxy(filepath.Join(t.TempDir(), "egress.sock"))
+	assert.NoError(t, err)
+	defer proxy.Close()
+
+	get := func(token string, tls bool) (*http.Response, string) {
+		proxyURL, _ := url.Parse(proxy.URL(token))
+		transport := tlsTarget.Client().Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		client := &http.Client{Transport: transport}
+		address := target.URL
+		if tls {
+			address = tlsTarget.URL
+		}
+		resp, err := client.Get(address)
+		if err != nil {
+			return nil, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// the test servers listen on loopback, only reachable when allowed by cidr
+	allowed, _ := NewPolicy(&project.EgressPolicy{AllowedCIDRs: []string{"127.0.0.1"}})
+	token, err := proxy.Register(allowed, nil)
+	assert.NoError(t, err)
+	resp, body := get(token, false)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", body)
+	_, body = get(token, true)
+	assert.Equal(t, "secure hello", body)
+
+	var blocked []string
+	denied, _ := NewPolicy(&project.EgressPolicy{})
+	token, err = proxy.Register(denied, func(reason string) { blocked = append(blocked, reason) })
+	assert.NoError(t, err)
+	resp, body = get(token, false)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, body, "blocked by the project network policy")
+	_, body = get(token, true)
+	assert.Contains(t, body, "Forbidden")
+	assert.Len(t, blocked, 2)
+	assert.Contains(t, blocked[0], "127.0.0.1 is a private address")
+
+	proxy.Unregister(token)
+	resp, _ = get(token, false)
+	assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+}
@@ -65,3 +65,8 @@ func (c *EDA) StartConsumers() error {
 	}
 	return nil
 }
+
+// Connector returns the underlying connection, shared by publishers and consumers
+func (c *EDA) Connector() *rabbitroutine.Connector {
+	return c.conn
+}
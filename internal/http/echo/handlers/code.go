@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -11,7 +12,10 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
 	"github.com/weni-ai/flows-code-actions/internal/metrics"
+	"github.com/weni-ai/flows-code-actions/internal/webhook"
+	"github.com/weni-ai/flows-code-actions/internal/workerpool"
 )
 
 type CodeHandler struct {
@@ -36,6 +40,12 @@ type CodeActionResponse struct {
 	Type        string `json:"type,omitempty"`
 	ProjectUUID string `json:"project_uuid,omitempty"`
 	URL         string `json:"url,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	Version     int    `json:"version,omitempty"`
+	AllowEgress bool   `json:"allow_egress,omitempty"`
+	Lane        string `json:"lane,omitempty"`
+
+	PublishedVersion int `json:"published_version,omitempty"`
 
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
@@ -51,6 +61,12 @@ func ParseCodeToResponse(newCode *code.Code) CodeActionResponse {
 		Type:        string(newCode.Type),
 		URL:         newCode.URL,
 		ProjectUUID: newCode.ProjectUUID,
+		CallbackURL: newCode.CallbackURL,
+		Version:     newCode.Version,
+		AllowEgress: newCode.AllowEgress,
+		Lane:        newCode.Lane,
+
+		PublishedVersion: newCode.PublishedVersion,
 
 		CreatedAt: newCode.CreatedAt,
 		UpdatedAt: newCode.UpdatedAt,
@@ -77,6 +93,17 @@ type SaveCodeActionResponse struct {
 	UpdatedAt string `json:"updated_at,omitempty"`
 }
 
+type ValidateCodeRequest struct {
+	ProjectUUID string `json:"project_uuid"`
+	Language    string `json:"language"`
+	Source      string `json:"source"`
+}
+
+type ValidateCodeResponse struct {
+	Valid  bool                  `json:"valid"`
+	Errors code.ValidationErrors `json:"errors"`
+}
+
 func NewCodeHandler(service code.UseCase) *CodeHandler {
 	return &CodeHandler{codeService: service}
 }
@@ -96,6 +123,7 @@ func (h *CodeHandler) CreateCode(c echo.Context) error {
 	ca.Name = qp.Get("name")
 	ca.Language = code.LanguageType(qp.Get("language"))
 	ca.Type = code.CodeType(qp.Get("type"))
+	ca.CallbackURL = qp.Get("callback_url")
 
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
@@ -116,12 +144,31 @@ func (h *CodeHandler) CreateCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	newCode, err := h.codeService.Create(
-		ctx,
-		code.NewCodeAction(ca.Name, ca.Source, lang, t, ca.URL, ca.ProjectUUID))
+	if ca.CallbackURL != "" {
+		if err := webhook.ValidateURL(ca.CallbackURL); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	allowEgress, err := parseAllowEgress(qp.Get("allow_egress"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	lane, err := parseLane(qp)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	codeAction := code.NewCodeAction(ca.Name, ca.Source, lang, t, ca.URL, ca.ProjectUUID)
+	codeAction.CallbackURL = ca.CallbackURL
+	codeAction.AllowEgress = allowEgress != nil && *allowEgress
+	if lane != nil {
+		codeAction.Lane = *lane
+	}
+	newCode, err := h.codeService.Create(ctx, codeAction)
 	if err != nil {
 		log.WithError(err).Error(err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return codeSaveError(err)
 	}
 
 	metrics.AddCodeCreatedCount(ca.ProjectUUID, newCode.ID, 1)
@@ -146,6 +193,12 @@ func (h *CodeHandler) UpdateCode(c echo.Context) error {
 	timeout, _ := strconv.Atoi(qp.Get("timeout"))
 	ca.Timeout = timeout
 	ca.Type = code.CodeType(qp.Get("type"))
+	// an empty callback_url removes the callback URL of the code
+	var callbackURL *string
+	if _, ok := qp["callback_url"]; ok {
+		ca.CallbackURL = qp.Get("callback_url")
+		callbackURL = &ca.CallbackURL
+	}
 
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
@@ -166,6 +219,21 @@ func (h *CodeHandler) UpdateCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	if ca.CallbackURL != "" {
+		if err := webhook.ValidateURL(ca.CallbackURL); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	allowEgress, err := parseAllowEgress(qp.Get("allow_egress"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	lane, err := parseLane(qp)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	uc, err := h.codeService.GetByID(ctx, codeID)
 	if err != nil {
 		return err
@@ -174,12 +242,18 @@ func (h *CodeHandler) UpdateCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	cd, err := h.codeService.Update(
-		ctx,
-		codeID, ca.Name, ca.Source, string(ca.Type), ca.Timeout)
+	cd, err := h.codeService.Update(ctx, codeID, code.Patch{
+		Name:        ca.Name,
+		Source:      ca.Source,
+		Type:        ca.Type,
+		Timeout:     ca.Timeout,
+		CallbackURL: callbackURL,
+		AllowEgress: allowEgress,
+		Lane:        lane,
+	})
 	if err != nil {
 		log.WithError(err).Error(err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return codeSaveError(err)
 	}
 
 	metrics.AddCodeCreatedCount(ca.ProjectUUID, codeID, 1)
@@ -266,3 +340,166 @@ func (h *CodeHandler) Delete(c echo.Context) error {
 	}
 	return c.NoContent(http.StatusOK)
 }
+
+// Validate returns the diagnostics of a source without saving it
+func (h *CodeHandler) Validate(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := ValidateCodeRequest{}
+	if err := c.Bind(&req); err != nil {
+		err = errors.Wrap(err, "failed to read body")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.ProjectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := CheckPermission(ctx, c, req.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	problems, err := h.codeService.Diagnose(ctx, req.ProjectUUID, code.LanguageType(req.Language), req.Source)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if problems == nil {
+		problems = code.ValidationErrors{}
+	}
+	return c.JSON(http.StatusOK, ValidateCodeResponse{Valid: len(problems) == 0, Errors: problems})
+}
+
+func (h *CodeHandler) ListVersions(c echo.Context) error {
+	codeID := c.Param("id")
+	if codeID == "" {
+		err := errors.New("valid id is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	codeAction, err := h.codeService.GetByID(ctx, codeID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := CheckPermission(ctx, c, codeAction.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	versions, err := h.codeService.ListVersions(ctx, codeID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (h *CodeHandler) Rollback(c echo.Context) error {
+	codeID := c.Param("id")
+	if codeID == "" {
+		err := errors.New("valid id is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		err := errors.New("valid version is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	codeAction, err := h.codeService.GetByID(ctx, codeID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := CheckPermission(ctx, c, codeAction.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	cd, err := h.codeService.Rollback(ctx, codeID, version)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		if errors.Is(err, codeversion.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, ParseCodeToResponse(cd))
+}
+
+func (h *CodeHandler) Publish(c echo.Context) error {
+	codeID := c.Param("id")
+	if codeID == "" {
+		err := errors.New("valid id is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	codeAction, err := h.codeService.GetByID(ctx, codeID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := CheckPermission(ctx, c, codeAction.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	cd, err := h.codeService.Publish(ctx, codeID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return codeSaveError(err)
+	}
+	return c.JSON(http.StatusOK, ParseCodeToResponse(cd))
+}
+
+// codeSaveError returns the save errors as bad requests, listing the problems of the rejected sources
+func codeSaveError(err error) error {
+	var problems code.ValidationErrors
+	if errors.As(err, &problems) {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": err.Error(),
+			"errors":  problems,
+		})
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+}
+
+// parseAllowEgress parses the allow_egress query param, nil when it is not set
+func parseAllowEgress(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	allow, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("allow_egress must be true or false")
+	}
+	return &allow, nil
+}
+
+// parseLane parses the lane query param, nil when it is not set and empty when it is set empty
+func parseLane(qp url.Values) (*string, error) {
+	if _, ok := qp["lane"]; !ok {
+		return nil, nil
+	}
+	value := qp.Get("lane")
+	if value == "" {
+		return &value, nil
+	}
+	lane, err := workerpool.ParseLane(value)
+	if err != nil {
+		return nil, err
+	}
+	value = string(lane)
+	return &value, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/codelib"
+)
+
+type CodeLibHandler struct {
+	codelibService codelib.UseCase
+	installer      *codelib.Installer
+}
+
+type CreateCodeLibRequest struct {
+	Name     string               `json:"name"`
+	Language codelib.LanguageType `json:"language"`
+}
+
+func NewCodeLibHandler(service codelib.UseCase, installer *codelib.Installer) *CodeLibHandler {
+	return &CodeLibHandler{codelibService: service, installer: installer}
+}
+
+func (h *CodeLibHandler) List(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var language *codelib.LanguageType
+	if l := c.QueryParam("language"); l != "" {
+		lang := codelib.LanguageType(l)
+		language = &lang
+	}
+	libs, err := h.codelibService.List(ctx, language)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if libs == nil {
+		libs = []codelib.CodeLib{}
+	}
+	return c.JSON(http.StatusOK, libs)
+}
+
+func (h *CodeLibHandler) Get(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	lib, err := h.codelibService.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, lib)
+}
+
+// Create saves the library as pending and queues its installation on this node, returning before it is
+// installed. The other nodes install it on their next sync
+func (h *CodeLibHandler) Create(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := CreateCodeLibRequest{}
+	if err := c.Bind(&req); err != nil {
+		err = errors.Wrap(err, "failed to read body")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Language == "" {
+		req.Language = codelib.TypePy
+	}
+	if req.Language != codelib.TypePy {
+		return echo.NewHTTPError(http.StatusBadRequest, "language not supported")
+	}
+	if err := codelib.ValidateName(req.Name); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if lib, err := h.codelibService.Find(ctx, req.Name, &req.Language); err == nil && lib != nil {
+		return echo.NewHTTPError(http.StatusConflict, "library already exists")
+	}
+
+	lib, err := h.codelibService.Create(ctx, codelib.NewCodeLib(req.Name, req.Language))
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.installer.Enqueue(lib.Name); err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	return c.JSON(http.StatusCreated, lib)
+}
+
+// Install drops the installations of the library, so every node installs it again on its next sync,
+// and queues its installation on this node. It retries a library failed on some nodes
+func (h *CodeLibHandler) Install(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	lib, err := h.codelibService.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := h.codelibService.ResetStatus(ctx, lib.ID); err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.installer.Enqueue(lib.Name); err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	lib.Status = codelib.StatusPending
+	lib.Output = ""
+	lib.Nodes = []codelib.NodeInstall{}
+	return c.JSON(http.StatusAccepted, lib)
+}
+
+// Delete removes the library, which is no longer installed by the nodes on startup
+func (h *CodeLibHandler) Delete(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.codelibService.Delete(ctx, c.Param("id")); err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.NoContent(http.StatusOK)
+}
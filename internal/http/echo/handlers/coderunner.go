@@ -2,33 +2,87 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/config"
 	"github.com/weni-ai/flows-code-actions/internal/code"
 	"github.com/weni-ai/flows-code-actions/internal/coderun"
 	"github.com/weni-ai/flows-code-actions/internal/coderunner"
 	"github.com/weni-ai/flows-code-actions/internal/metrics"
+	"github.com/weni-ai/flows-code-actions/internal/webhook"
 	"github.com/weni-ai/flows-code-actions/internal/workerpool"
 )
 
 type CodeRunnerHandler struct {
 	codeService       code.UseCase
 	coderunnerService coderunner.UseCase
-	workerPool        *workerpool.Pool
+	workerPool        workerpool.Submitter
+	limits            config.ActionLimitsConfig
+	notifier          webhook.Notifier
+	limiter           workerpool.Limiter
 }
 
-func NewCodeRunnerHandler(codeService code.UseCase, coderunnerService coderunner.UseCase, workerPool *workerpool.Pool) *CodeRunnerHandler {
+func NewCodeRunnerHandler(codeService code.UseCase, coderunnerService coderunner.UseCase, workerPool workerpool.Submitter, limits config.ActionLimitsConfig, notifier webhook.Notifier, limiter workerpool.Limiter) *CodeRunnerHandler {
 	return &CodeRunnerHandler{
 		codeService:       codeService,
 		coderunnerService: coderunnerService,
 		workerPool:        workerPool,
+		limits:            limits,
+		notifier:          notifier,
+		limiter:           limiter,
 	}
 }
 
+// acquireRun takes the in flight slots of the run on its code and project, failing with 429 when any of them
+// is full. Runs are let through when the limiter is unavailable
+func (h *CodeRunnerHandler) acquireRun(codeAction *code.Code, runID string) error {
+	if h.limiter == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := h.limiter.Acquire(ctx, codeAction.Key(), codeAction.ProjectUUID, runID, time.Duration(codeAction.Timeout)*time.Second)
+	var limitErr *workerpool.LimitError
+	if errors.As(err, &limitErr) {
+		metrics.AddCodeRunRejectedCount(codeAction.ProjectUUID, codeAction.Key(), limitErr.Scope)
+		return echo.NewHTTPError(http.StatusTooManyRequests, limitErr.Error())
+	}
+	if err != nil {
+		log.WithError(err).Warn("error on acquiring run slot")
+	}
+	return nil
+}
+
+// releaseRun frees the in flight slots of the run
+func (h *CodeRunnerHandler) releaseRun(codeAction *code.Code, runID string) {
+	if h.limiter == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.limiter.Release(ctx, codeAction.Key(), codeAction.ProjectUUID, runID); err != nil {
+		log.WithError(err).Warn("error on releasing run slot")
+	}
+}
+
+// lane returns the worker pool lane of the runs of the code, the lane of the route when the code has none
+func (h *CodeRunnerHandler) lane(codeAction *code.Code, route workerpool.Lane) workerpool.Lane {
+	if lane, err := workerpool.ParseLane(codeAction.Lane); err == nil {
+		return lane
+	}
+	return route
+}
+
+// RunCode runs the code triggered by a flow, queueing the published version on the flow lane
 func (h *CodeRunnerHandler) RunCode(c echo.Context) error {
 	codeID := c.Param("code_id")
 	if codeID == "" {
@@ -45,17 +99,61 @@ func (h *CodeRunnerHandler) RunCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	result, err := h.coderunnerService.RunCode(ctx, codeID, codeAction.Source, string(codeAction.Language), nil, "", nil)
+	// draft=true runs the draft being edited right away instead of queueing the published version
+	if draft, _ := strconv.ParseBool(c.QueryParam("draft")); draft {
+		slot := uuid.New().String()
+		if err := h.acquireRun(codeAction, slot); err != nil {
+			return err
+		}
+		defer h.releaseRun(codeAction, slot)
+
+		result, err := h.coderunnerService.RunCode(ctx, codeID, codeAction.Version, codeAction.Source, string(codeAction.Language), nil, "", nil)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"code_id": codeID, "result": result})
+	}
+
+	source, version := codeAction.Published()
+	queuedRun, err := h.coderunnerService.QueueCode(ctx, codeID, version, nil, "", nil)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	if err := h.acquireRun(codeAction, queuedRun.ID); err != nil {
+		h.failRejected(c, queuedRun, err)
+		return err
+	}
+	defer h.releaseRun(codeAction, queuedRun.ID)
 
-	runResult := map[string]interface{}{
-		"code_id": codeID,
-		"result":  result,
+	resultCh := make(chan workerpool.Result, 1)
+	task := workerpool.Task{
+		Ctx: ctx,
+		Execute: func(taskCtx context.Context) (*coderun.CodeRun, error) {
+			return h.runQueued(taskCtx, codeAction, queuedRun, source, "")
+		},
+		Result:      resultCh,
+		RunID:       queuedRun.ID,
+		ProjectUUID: codeAction.ProjectUUID,
+		Lane:        h.lane(codeAction, workerpool.LaneFlow),
+	}
+	if err := h.workerPool.Submit(task); err != nil {
+		h.failRejected(c, queuedRun, err)
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, runResult)
+	select {
+	case res := <-resultCh:
+		if res.Err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, res.Err.Error())
+		}
+		runResult := map[string]interface{}{
+			"code_id": codeID,
+			"result":  res.Run,
+		}
+		return c.JSON(http.StatusOK, runResult)
+	case <-ctx.Done():
+		return echo.NewHTTPError(http.StatusRequestTimeout, "timeout: request context timeout limit exceeded")
+	}
 }
 
 func (h *CodeRunnerHandler) RunEndpoint(c echo.Context) error {
@@ -74,7 +172,14 @@ func (h *CodeRunnerHandler) RunEndpoint(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	result, err := h.coderunnerService.RunCode(ctx, codeID, codeAction.Source, string(codeAction.Language), nil, "", nil)
+	slot := uuid.New().String()
+	if err := h.acquireRun(codeAction, slot); err != nil {
+		return err
+	}
+	defer h.releaseRun(codeAction, slot)
+
+	source, version := codeAction.Published()
+	result, err := h.coderunnerService.RunCode(ctx, codeID, version, source, string(codeAction.Language), nil, "", nil)
 	if err != nil {
 		echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -82,12 +187,44 @@ func (h *CodeRunnerHandler) RunEndpoint(c echo.Context) error {
 	return c.String(http.StatusOK, result.Result)
 }
 
-func (h *CodeRunnerHandler) ActionEndpoint(c echo.Context) error {
-	start := time.Now()
+// actionRequest is a validated invocation of an endpoint code action
+type actionRequest struct {
+	code        *code.Code
+	source      string
+	version     int
+	params      map[string]interface{}
+	body        string
+	headers     map[string]interface{}
+	callbackURL string
+}
 
+// parseActionRequest enforces the action limits on the request and loads the endpoint code
+func (h *CodeRunnerHandler) parseActionRequest(c echo.Context) (*actionRequest, error) {
 	codeID := c.Param("code_id")
 	if codeID == "" {
-		return echo.NewHTTPError(http.StatusNotFound, errors.New("Not Found"))
+		return nil, echo.NewHTTPError(http.StatusNotFound, errors.New("Not Found"))
+	}
+
+	if h.limits.MaxHeadersSize > 0 && valuesSize(c.Request().Header) > h.limits.MaxHeadersSize {
+		return nil, echo.NewHTTPError(http.StatusRequestHeaderFieldsTooLarge, "request headers exceed the action limit")
+	}
+	if h.limits.MaxParamsSize > 0 && valuesSize(c.QueryParams()) > h.limits.MaxParamsSize {
+		return nil, echo.NewHTTPError(http.StatusRequestURITooLong, "query parameters exceed the action limit")
+	}
+
+	callbackURL := c.Request().Header.Get(webhook.CallbackURLHeader)
+	if callbackURL != "" {
+		if err := webhook.ValidateURL(callbackURL); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	abody, err := readBody(c.Request().Body, h.limits.MaxBodySize)
+	if err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -95,19 +232,11 @@ func (h *CodeRunnerHandler) ActionEndpoint(c echo.Context) error {
 	codeAction, err := h.codeService.GetByID(ctx, codeID)
 	if err != nil {
 		if codeAction == nil || codeAction.Type == code.TypeFlow {
-			return echo.NewHTTPError(http.StatusNotFound, errors.New("Not Found"))
+			return nil, echo.NewHTTPError(http.StatusNotFound, errors.New("Not Found"))
 		}
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	defer func() {
-		metrics.CodeRunElapsed(codeAction.ProjectUUID, codeID, time.Since(start).Seconds())
-		metrics.AddCodeRunCount(codeAction.ProjectUUID, codeID, 1)
-	}()
-
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*time.Duration(codeAction.Timeout))
-	defer cancel()
-
 	aheader := map[string]interface{}{}
 	for k, v := range c.Request().Header {
 		aheader[k] = v
@@ -120,21 +249,124 @@ func (h *CodeRunnerHandler) ActionEndpoint(c echo.Context) error {
 		}
 	}
 
-	abody, err := io.ReadAll(c.Request().Body)
+	if callbackURL == "" {
+		callbackURL = codeAction.CallbackURL
+	}
+
+	source, version := codeAction.Published()
+
+	return &actionRequest{code: codeAction, source: source, version: version, params: cparams, body: string(abody), headers: aheader, callbackURL: callbackURL}, nil
+}
+
+// runQueued executes a queued run of the code source within its timeout, notifying the callback URL when it
+// finishes. The in flight slots of the run are released on the node executing it
+func (h *CodeRunnerHandler) runQueued(ctx context.Context, codeAction *code.Code, queuedRun *coderun.CodeRun, source string, callbackURL string) (*coderun.CodeRun, error) {
+	defer h.releaseRun(codeAction, queuedRun.ID)
+	start := time.Now()
+	runCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(codeAction.Timeout))
+	defer cancel()
+	run, err := h.coderunnerService.RunQueued(runCtx, queuedRun, source, string(codeAction.Language))
+	if h.notifier != nil && callbackURL != "" {
+		h.notifier.Notify(run, codeAction.ProjectUUID, callbackURL, time.Since(start))
+	}
+	return run, err
+}
+
+// RunQueued executes a run queued by another node on a durable queue, recovering the callback URL
+// from the persisted request headers
+func (h *CodeRunnerHandler) RunQueued(ctx context.Context, queuedRun *coderun.CodeRun) (*coderun.CodeRun, error) {
+	codeAction, err := h.codeService.GetByID(ctx, queuedRun.CodeID)
+	if err != nil {
+		return h.coderunnerService.FailRun(ctx, queuedRun, errors.Wrap(err, "error on getting code"))
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.CodeRunElapsed(codeAction.ProjectUUID, codeAction.Key(), time.Since(start).Seconds())
+		metrics.AddCodeRunCount(codeAction.ProjectUUID, codeAction.Key(), 1)
+	}()
+
+	// the code may have been published again since the run was queued, which keeps the version it was queued with
+	source, version := codeAction.Published()
+	if queuedRun.CodeVersion != version {
+		source, err = h.codeService.VersionSource(ctx, queuedRun.CodeID, queuedRun.CodeVersion)
+		if err != nil {
+			return h.coderunnerService.FailRun(ctx, queuedRun, errors.Wrap(err, "error on getting code version"))
+		}
+	}
+
+	callbackURL := headerValue(queuedRun.Headers, webhook.CallbackURLHeader)
+	if callbackURL == "" {
+		callbackURL = codeAction.CallbackURL
+	}
+	return h.runQueued(ctx, codeAction, queuedRun, source, callbackURL)
+}
+
+// headerValue returns the first value of a header persisted on a code run
+func headerValue(headers map[string]interface{}, key string) string {
+	switch v := headers[http.CanonicalHeaderKey(key)].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			s, _ := v[0].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+func (h *CodeRunnerHandler) ActionEndpoint(c echo.Context) error {
+	if prefersAsync(c.Request()) {
+		return h.ActionAsyncEndpoint(c)
+	}
+
+	start := time.Now()
+
+	req, err := h.parseActionRequest(c)
+	if err != nil {
+		return err
+	}
+	codeID := c.Param("code_id")
+	codeAction := req.code
+
+	defer func() {
+		metrics.CodeRunElapsed(codeAction.ProjectUUID, codeAction.Key(), time.Since(start).Seconds())
+		metrics.AddCodeRunCount(codeAction.ProjectUUID, codeAction.Key(), 1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(codeAction.Timeout))
+	defer cancel()
+
+	queuedRun, err := h.coderunnerService.QueueCode(ctx, codeID, req.version, req.params, req.body, req.headers)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	if err := h.acquireRun(codeAction, queuedRun.ID); err != nil {
+		h.failRejected(c, queuedRun, err)
+		return err
+	}
+	// a run whose request timed out stops counting, the in process pool drops it
+	defer h.releaseRun(codeAction, queuedRun.ID)
 
 	resultCh := make(chan workerpool.Result, 1)
 	task := workerpool.Task{
 		Ctx: ctx,
 		Execute: func(taskCtx context.Context) (*coderun.CodeRun, error) {
-			return h.coderunnerService.RunCode(taskCtx, codeID, codeAction.Source, string(codeAction.Language), cparams, string(abody), aheader)
+			return h.runQueued(taskCtx, codeAction, queuedRun, req.source, req.callbackURL)
 		},
-		Result: resultCh,
+		Result:      resultCh,
+		RunID:       queuedRun.ID,
+		ProjectUUID: codeAction.ProjectUUID,
+		Lane:        h.lane(codeAction, workerpool.LaneInteractive),
 	}
 
 	if err := h.workerPool.Submit(task); err != nil {
+		h.failRejected(c, queuedRun, err)
 		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
 	}
 
@@ -181,3 +413,108 @@ func (h *CodeRunnerHandler) ActionEndpoint(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusRequestTimeout, "timeout: request context timeout limit exceeded")
 	}
 }
+
+// ActionAsyncEndpoint queues the code action execution and responds right away with the queued code run,
+// whose result is available through GET /coderun/:id once the execution finishes
+func (h *CodeRunnerHandler) ActionAsyncEndpoint(c echo.Context) error {
+	req, err := h.parseActionRequest(c)
+	if err != nil {
+		return err
+	}
+	codeID := c.Param("code_id")
+	codeAction := req.code
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	queuedRun, err := h.coderunnerService.QueueCode(ctx, codeID, req.version, req.params, req.body, req.headers)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.acquireRun(codeAction, queuedRun.ID); err != nil {
+		h.failRejected(c, queuedRun, err)
+		return err
+	}
+	// the worker updates the run once it is submitted, the response is built from what was queued
+	runID, status := queuedRun.ID, queuedRun.Status
+
+	task := workerpool.Task{
+		Ctx: context.Background(),
+		Execute: func(taskCtx context.Context) (*coderun.CodeRun, error) {
+			start := time.Now()
+			defer func() {
+				metrics.CodeRunElapsed(codeAction.ProjectUUID, codeAction.Key(), time.Since(start).Seconds())
+				metrics.AddCodeRunCount(codeAction.ProjectUUID, codeAction.Key(), 1)
+			}()
+
+			return h.runQueued(taskCtx, codeAction, queuedRun, req.source, req.callbackURL)
+		},
+		RunID:       runID,
+		ProjectUUID: codeAction.ProjectUUID,
+		Lane:        h.lane(codeAction, workerpool.LaneBatch),
+	}
+
+	if err := h.workerPool.Submit(task); err != nil {
+		h.releaseRun(codeAction, runID)
+		h.failRejected(c, queuedRun, err)
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/coderun/"+runID)
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"id":      runID,
+		"code_id": codeID,
+		"status":  status,
+	})
+}
+
+// failRejected fails the queued run that was not accepted for execution
+func (h *CodeRunnerHandler) failRejected(c echo.Context, queuedRun *coderun.CodeRun, reason error) {
+	if httpErr, ok := reason.(*echo.HTTPError); ok {
+		reason = errors.New(fmt.Sprint(httpErr.Message))
+	}
+	if _, err := h.coderunnerService.FailRun(context.Background(), queuedRun, reason); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// prefersAsync tells if the request asks for an asynchronous response with the "Prefer: respond-async" header
+func prefersAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(value, ",") {
+			token, _, _ := strings.Cut(strings.TrimSpace(preference), ";")
+			if strings.EqualFold(strings.TrimSpace(token), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var errBodyTooLarge = errors.New("request body exceeds the action limit")
+
+// readBody reads the request body, failing with errBodyTooLarge when it is bigger than limit. A limit <= 0 means no limit
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+// valuesSize returns the size in bytes of the keys and values of headers or query parameters
+func valuesSize(values map[string][]string) int64 {
+	var size int64
+	for k, vs := range values {
+		size += int64(len(k))
+		for _, v := range vs {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
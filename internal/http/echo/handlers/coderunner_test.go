@@ -1 +1,254 @@
 package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/code"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/workerpool"
+)
+
+type fakeCodeService struct {
+	code.UseCase
+	code *code.Code
+}
+
+func (s *fakeCodeService) GetByID(ctx context.Context, id string) (*code.Code, error) {
+	return s.code, nil
+}
+
+func (s *fakeCodeService) VersionSource(ctx context.Context, id string, version int) (string, error) {
+	return fmt.Sprintf("print(%d)", version), nil
+}
+
+type fakeCodeRunner struct {
+	ran    chan *coderun.CodeRun
+	source string
+}
+
+func (r *fakeCodeRunner) RunCode(ctx context.Context, codeID string, codeVersion int, source string, language string, params map[string]interface{}, body string, headers map[string]interface{}) (*coderun.CodeRun, error) {
+	return &coderun.CodeRun{CodeID: codeID, Status: coderun.StatusCompleted, Result: body}, nil
+}
+
+func (r *fakeCodeRunner) QueueCode(ctx context.Context, codeID string, codeVersion int, params map[string]interface{}, body string, headers map[string]interface{}) (*coderun.CodeRun, error) {
+	return &coderun.CodeRun{ID: "run-1", CodeID: codeID, Status: coderun.StatusQueued, Body: body}, nil
+}
+
+func (r *fakeCodeRunner) RunQueued(ctx context.Context, run *coderun.CodeRun, source string, language string) (*coderun.CodeRun, error) {
+	r.source = source
+	run.Status = coderun.StatusCompleted
+	r.ran <- run
+	return run, nil
+}
+
+func (r *fakeCodeRunner) FailRun(ctx context.Context, run *coderun.CodeRun, reason error) (*coderun.CodeRun, error) {
+	run.Status = coderun.StatusFailed
+	return run, nil
+}
+
+func TestActionEndpointAsync(t *testing.T) {
+	codeService := &fakeCodeService{code: &code.Code{ID: "code-1", Type: code.TypeEndpoint, Timeout: 5}}
+	runner := &fakeCodeRunner{ran: make(chan *coderun.CodeRun, 1)}
+	h := NewCodeRunnerHandler(codeService, runner, workerpool.NewPool(1, 1), config.ActionLimitsConfig{}, nil, nil)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"bob"}`))
+	req.Header.Set("Prefer", "wait=10, respond-async")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("code_id")
+	c.SetParamValues("code-1")
+
+	assert.NoError(t, h.ActionEndpoint(c))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/coderun/run-1", rec.Header().Get(echo.HeaderLocation))
+
+	response := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "run-1", response["id"])
+	assert.Equal(t, "queued", response["status"])
+
+	select {
+	case run := <-runner.ran:
+		assert.Equal(t, `{"name":"bob"}`, run.Body)
+	case <-time.After(time.Second):
+		t.Fatal("queued run was not executed")
+	}
+}
+
+func TestActionEndpointLimits(t *testing.T) {
+	limits := config.ActionLimitsConfig{MaxBodySize: 8, MaxParamsSize: 8, MaxHeadersSize: 16}
+
+	tests := []struct {
+		name           string
+		target         string
+		body           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "body too large", target: "/", body: "123456789", expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "params too large", target: "/?cake=vanilla", expectedStatus: http.StatusRequestURITooLong},
+		{name: "headers too large", target: "/", header: "a very long header value", expectedStatus: http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set("X-Custom", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("code_id")
+			c.SetParamValues("code-1")
+
+			h := NewCodeRunnerHandler(nil, nil, nil, limits, nil, nil)
+			err := h.ActionEndpoint(c)
+
+			httpErr, ok := err.(*echo.HTTPError)
+			if assert.True(t, ok) {
+				assert.Equal(t, tt.expectedStatus, httpErr.Code)
+			}
+		})
+	}
+
+	body, err := readBody(strings.NewReader("12345678"), 8)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678", string(body))
+}
+
+type fakeLimiter struct {
+	limit    int
+	inFlight map[string]bool
+	released chan string
+	codeID   string
+}
+
+func (l *fakeLimiter) Acquire(ctx context.Context, codeID string, projectUUID string, runID string, timeout time.Duration) error {
+	l.codeID = codeID
+	if len(l.inFlight) >= l.limit {
+		return &workerpool.LimitError{Scope: "project", Limit: l.limit}
+	}
+	l.inFlight[runID] = true
+	return nil
+}
+
+func (l *fakeLimiter) Release(ctx context.Context, codeID string, projectUUID string, runID string) error {
+	delete(l.inFlight, runID)
+	l.released <- runID
+	return nil
+}
+
+func TestActionEndpointInFlightLimit(t *testing.T) {
+	// codes stored on MongoDB only have the ObjectID
+	codeService := &fakeCodeService{code: &code.Code{MongoObjectID: "code-1", ProjectUUID: "project-1", Type: code.TypeEndpoint, Timeout: 5}}
+	runner := &fakeCodeRunner{ran: make(chan *coderun.CodeRun, 1)}
+	limiter := &fakeLimiter{limit: 1, inFlight: map[string]bool{"run-0": true}, released: make(chan string, 2)}
+	h := NewCodeRunnerHandler(codeService, runner, workerpool.NewPool(1, 1), config.ActionLimitsConfig{}, nil, limiter)
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set("Prefer", "respond-async")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("code_id")
+		c.SetParamValues("code-1")
+		return c, rec
+	}
+
+	c, _ := newContext()
+	err := h.ActionEndpoint(c)
+	httpErr, ok := err.(*echo.HTTPError)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusTooManyRequests, httpErr.Code)
+		assert.Equal(t, "too many runs in flight for the project, the limit is 1", httpErr.Message)
+	}
+	assert.Equal(t, "code-1", limiter.codeID)
+
+	delete(limiter.inFlight, "run-0")
+	c, rec := newContext()
+	assert.NoError(t, h.ActionEndpoint(c))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	select {
+	case runID := <-limiter.released:
+		assert.Equal(t, "run-1", runID)
+	case <-time.After(time.Second):
+		t.Fatal("run slot was not released")
+	}
+	<-runner.ran
+}
+
+type lanePool struct {
+	lanes []workerpool.Lane
+}
+
+func (p *lanePool) Submit(task workerpool.Task) error {
+	p.lanes = append(p.lanes, task.Lane)
+	run, err := task.Execute(task.Ctx)
+	if task.Result != nil {
+		task.Result <- workerpool.Result{Run: run, Err: err}
+	}
+	return nil
+}
+
+func TestRunLanes(t *testing.T) {
+	codeService := &fakeCodeService{code: &code.Code{ID: "code-1", Type: code.TypeEndpoint, Timeout: 5}}
+	runner := &fakeCodeRunner{ran: make(chan *coderun.CodeRun, 4)}
+	pool := &lanePool{}
+	h := NewCodeRunnerHandler(codeService, runner, pool, config.ActionLimitsConfig{}, nil, nil)
+
+	newContext := func(async bool) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		if async {
+			req.Header.Set("Prefer", "respond-async")
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("code_id")
+		c.SetParamValues("code-1")
+		return c, rec
+	}
+
+	c, rec := newContext(false)
+	assert.NoError(t, h.RunCode(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	c, _ = newContext(false)
+	assert.NoError(t, h.ActionEndpoint(c))
+	c, _ = newContext(true)
+	assert.NoError(t, h.ActionEndpoint(c))
+
+	// the lane of the code overrides the lane of the route
+	codeService.code.Lane = string(workerpool.LaneBatch)
+	c, _ = newContext(false)
+	assert.NoError(t, h.ActionEndpoint(c))
+
+	assert.Equal(t, []workerpool.Lane{workerpool.LaneFlow, workerpool.LaneInteractive, workerpool.LaneBatch, workerpool.LaneBatch}, pool.lanes)
+}
+
+func TestRunQueuedKeepsQueuedVersion(t *testing.T) {
+	codeService := &fakeCodeService{code: &code.Code{ID: "code-1", Timeout: 5, Source: "print(4)", Version: 4, PublishedSource: "print(3)", PublishedVersion: 3}}
+	runner := &fakeCodeRunner{ran: make(chan *coderun.CodeRun, 2)}
+	h := NewCodeRunnerHandler(codeService, runner, nil, config.ActionLimitsConfig{}, nil, nil)
+
+	run, err := h.RunQueued(context.Background(), &coderun.CodeRun{ID: "run-1", CodeID: "code-1", CodeVersion: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, run.CodeVersion)
+	assert.Equal(t, "print(3)", runner.source)
+
+	// published again while the run was queued
+	run, err = h.RunQueued(context.Background(), &coderun.CodeRun{ID: "run-2", CodeID: "code-1", CodeVersion: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, run.CodeVersion)
+	assert.Equal(t, "print(2)", runner.source)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+)
+
+type ProjectHandler struct {
+	projectService project.UseCase
+}
+
+func NewProjectHandler(service project.UseCase) *ProjectHandler {
+	return &ProjectHandler{projectService: service}
+}
+
+// WebhookSecret returns the secret used to sign the code run completion webhooks of the project
+func (h *ProjectHandler) WebhookSecret(c echo.Context) error {
+	projectUUID := c.Param("project_uuid")
+	if projectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckPermission(ctx, c, projectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	secret, err := h.projectService.WebhookSecret(ctx, projectUUID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"project_uuid":   projectUUID,
+		"webhook_secret": secret,
+	})
+}
+
+// Settings returns the code policy, python requirements and egress policy of the project
+func (h *ProjectHandler) Settings(c echo.Context) error {
+	projectUUID := c.Param("project_uuid")
+	if projectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckPermission(ctx, c, projectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	settings, err := h.projectService.Settings(ctx, projectUUID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings updates the settings present in the body, leaving the others unchanged
+func (h *ProjectHandler) UpdateSettings(c echo.Context) error {
+	projectUUID := c.Param("project_uuid")
+	if projectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckPermission(ctx, c, projectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	req := project.Settings{}
+	if err := c.Bind(&req); err != nil {
+		err = errors.Wrap(err, "failed to read body")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	settings, err := h.projectService.UpdateSettings(ctx, projectUUID, req)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, settings)
+}
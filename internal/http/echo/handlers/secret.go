@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/secret"
+)
+
+type SecretHandler struct {
+	secretService secret.UseCase
+}
+
+type CreateSecretRequest struct {
+	ProjectUUID string `json:"project_uuid"`
+	CodeID      string `json:"code_id,omitempty"`
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+}
+
+func NewSecretHandler(service secret.UseCase) *SecretHandler {
+	return &SecretHandler{secretService: service}
+}
+
+// Create saves a secret of the project, or of one of its codes when code_id is set. The value is never returned
+func (h *SecretHandler) Create(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := CreateSecretRequest{}
+	if err := c.Bind(&req); err != nil {
+		err = errors.Wrap(err, "failed to read body")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.ProjectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := CheckPermission(ctx, c, req.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	sc, err := h.secretService.Create(ctx, req.ProjectUUID, req.CodeID, req.Name, req.Value)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusCreated, sc)
+}
+
+func (h *SecretHandler) Find(c echo.Context) error {
+	projectUUID := c.QueryParam("project_uuid")
+	if projectUUID == "" {
+		err := errors.New("valid project_uuid is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckPermission(ctx, c, projectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	secrets, err := h.secretService.ListByProjectUUID(ctx, projectUUID, c.QueryParam("code_id"))
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, secrets)
+}
+
+func (h *SecretHandler) Delete(c echo.Context) error {
+	secretID := c.Param("id")
+	if secretID == "" {
+		err := errors.New("valid id is required")
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sc, err := h.secretService.GetByID(ctx, secretID)
+	if err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := CheckPermission(ctx, c, sc.ProjectUUID); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := h.secretService.Delete(ctx, secretID); err != nil {
+		log.WithError(err).Error(err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.NoContent(http.StatusOK)
+}
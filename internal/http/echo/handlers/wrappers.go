@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -27,6 +28,21 @@ func RequireAuthToken(conf *config.Config, next echo.HandlerFunc) echo.HandlerFu
 	}
 }
 
+// RequireAdminAuthToken authorizes the request by the service token, refusing every request when no token
+// is configured
+func RequireAdminAuthToken(conf *config.Config, next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if conf.AuthToken == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "admin endpoints require an auth token to be configured")
+		}
+		auth := c.Request().Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(fmt.Sprintf("Token %s", conf.AuthToken)), []byte(auth)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or missing authorization token")
+		}
+		return next(c)
+	}
+}
+
 func ProtectEndpointWithAuthToken(conf *config.Config, next echo.HandlerFunc, requiredPermission permission.PermissionAccess) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if !conf.OIDC.AuthEnabled {
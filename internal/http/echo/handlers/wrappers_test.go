@@ -163,3 +163,46 @@ func TestProtectEndpointWithAuthToken(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireAdminAuthToken(t *testing.T) {
+	mockHandler := func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		authHeader     string
+		expectedStatus int
+	}{
+		{name: "No configured token should return unauthorized", token: "", authHeader: "", expectedStatus: http.StatusUnauthorized},
+		{name: "No configured token with any header should return unauthorized", token: "", authHeader: "Token ", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing auth header should return unauthorized", token: "secret", authHeader: "", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong token should return unauthorized", token: "secret", authHeader: "Token other", expectedStatus: http.StatusUnauthorized},
+		{name: "Valid token should succeed", token: "secret", authHeader: "Token secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/admin/codelib", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := RequireAdminAuthToken(&config.Config{AuthToken: tt.token}, mockHandler)(c)
+			if tt.expectedStatus == http.StatusOK {
+				if err != nil || rec.Code != http.StatusOK {
+					t.Errorf("expected success, got error %v and status %d", err, rec.Code)
+				}
+				return
+			}
+			he, ok := err.(*echo.HTTPError)
+			if !ok || he.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %v", tt.expectedStatus, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"context"
+	"database/sql"
 	"net/http"
 	"time"
 
@@ -18,15 +20,29 @@ import (
 	codelibRepoPG "github.com/weni-ai/flows-code-actions/internal/codelib/pg"
 	"github.com/weni-ai/flows-code-actions/internal/codelog"
 	codelogRepoMongo "github.com/weni-ai/flows-code-actions/internal/codelog/mongodb"
+	codelogRepoPG "github.com/weni-ai/flows-code-actions/internal/codelog/pg"
 	codelogRepoS3 "github.com/weni-ai/flows-code-actions/internal/codelog/s3"
 	"github.com/weni-ai/flows-code-actions/internal/coderun"
 	coderunRepoMongo "github.com/weni-ai/flows-code-actions/internal/coderun/mongodb"
 	coderunRepoPG "github.com/weni-ai/flows-code-actions/internal/coderun/pg"
 	"github.com/weni-ai/flows-code-actions/internal/coderunner"
+	"github.com/weni-ai/flows-code-actions/internal/codeversion"
+	codeversionRepoMongo "github.com/weni-ai/flows-code-actions/internal/codeversion/mongodb"
+	codeversionRepoPG "github.com/weni-ai/flows-code-actions/internal/codeversion/pg"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+	"github.com/weni-ai/flows-code-actions/internal/eventdriven/rabbitmq"
 	s "github.com/weni-ai/flows-code-actions/internal/http/echo"
 	"github.com/weni-ai/flows-code-actions/internal/http/echo/handlers"
 	"github.com/weni-ai/flows-code-actions/internal/permission"
+	"github.com/weni-ai/flows-code-actions/internal/project"
+	projectRepoMongo "github.com/weni-ai/flows-code-actions/internal/project/mongodb"
+	projectRepoPG "github.com/weni-ai/flows-code-actions/internal/project/pg"
+	"github.com/weni-ai/flows-code-actions/internal/secret"
+	secretRepoMongo "github.com/weni-ai/flows-code-actions/internal/secret/mongodb"
+	secretRepoPG "github.com/weni-ai/flows-code-actions/internal/secret/pg"
+	"github.com/weni-ai/flows-code-actions/internal/webhook"
 	"github.com/weni-ai/flows-code-actions/internal/workerpool"
+	workerpoolRabbitMQ "github.com/weni-ai/flows-code-actions/internal/workerpool/rabbitmq"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/labstack/echo-contrib/echoprometheus"
@@ -41,7 +57,9 @@ func Setup(server *s.Server) {
 	var codeRepo code.Repository
 	var codelibRepo codelib.Repository
 	var coderunRepo coderun.Repository
-	var codelogRepo codelog.Repository
+	var projectRepo project.Repository
+	var codeversionRepo codeversion.Repository
+	var secretRepo secret.Repository
 
 	if server.Config.DB.Type == "postgres" {
 		// Use PostgreSQL repositories
@@ -49,23 +67,40 @@ func Setup(server *s.Server) {
 		codeRepo = codeRepoPG.NewCodeRepository(pgDB)
 		codelibRepo = codelibRepoPG.NewCodeLibRepo(pgDB)
 		coderunRepo = coderunRepoPG.NewCodeRunRepository(pgDB)
+		projectRepo = projectRepoPG.NewProjectRepository(pgDB)
+		codeversionRepo = codeversionRepoPG.NewCodeVersionRepository(pgDB)
+		secretRepo = secretRepoPG.NewSecretRepository(pgDB)
 	} else {
 		// Use MongoDB repositories (default)
 		mongoDB := server.DB
 		codeRepo = codeRepoMongo.NewCodeRepository(mongoDB)
 		codelibRepo = codelibRepoMongo.NewCodeLibRepo(mongoDB)
 		coderunRepo = coderunRepoMongo.NewCodeRunRepository(mongoDB)
-		codelogRepo = codelogRepoMongo.NewCodeLogRepository(mongoDB)
+		projectRepo = projectRepoMongo.NewProjectRepository(mongoDB)
+		codeversionRepo = codeversionRepoMongo.NewCodeVersionRepository(mongoDB)
+		secretRepo = secretRepoMongo.NewSecretRepository(mongoDB)
 	}
 
-	codeService := code.NewCodeService(server.Config, codeRepo, codelibRepo)
+	projectService := project.NewProjectService(projectRepo)
+	projectService.SetAllowedLibs(server.Config.GetCodeLibAllowList())
+	projectHandler := handlers.NewProjectHandler(projectService)
+
+	codeversionService := codeversion.NewCodeVersionService(codeversionRepo)
+	codelibService := codelib.NewCodeLibService(codelibRepo)
+	codelibInstaller := codelib.NewInstaller(codelibService, server.Config.GetCodeLibAllowList(), server.Config.CodeLib.Node)
+	codelibInstaller.Start(context.Background(), time.Duration(server.Config.CodeLib.SyncInterval)*time.Second)
+	codelibHandler := handlers.NewCodeLibHandler(codelibService, codelibInstaller)
+	codeService := code.NewCodeService(server.Config, codeRepo, codelibService, codeversionService, projectService)
+	if server.Config.CodeLib.AutoInstall {
+		codeService.SetLibInstaller(codelibInstaller)
+	}
 	codeHandler := handlers.NewCodeHandler(codeService)
 
 	coderunService := coderun.NewCodeRunService(coderunRepo)
 	coderunHandler := handlers.NewCodeRunHandler(coderunService)
 
-	// Create CodeLog repository (MongoDB or S3 based on config)
-	codelogRepo, err := createCodeLogRepository(server.Config, server.DB)
+	// Create CodeLog repository (S3, PostgreSQL or MongoDB based on config)
+	codelogRepo, err := createCodeLogRepository(server.Config, server.DB, server.SQLDB)
 	if err != nil {
 		logrus.WithError(err).Fatal("failed to create codelog repository")
 	}
@@ -75,9 +110,73 @@ func Setup(server *s.Server) {
 	server.Services.CodeLogService = codelogService
 	server.Services.CodeRunService = coderunService
 
-	coderunnerService := coderunner.NewCodeRunnerService(server.Config, coderunService, codelogService)
-	pool := workerpool.NewPool(server.Config.WorkerPool.Workers, server.Config.WorkerPool.QueueSize)
-	coderunnerHandler := handlers.NewCodeRunnerHandler(codeService, coderunnerService, pool)
+	secretCipher, err := secret.NewCipher(server.Config.SecretsMasterKey)
+	if err != nil {
+		logrus.WithError(err).Warn("secrets are disabled")
+	}
+	secretService := secret.NewSecretService(secretRepo, secretCipher, codeService)
+	secretHandler := handlers.NewSecretHandler(secretService)
+
+	coderunnerService := coderunner.NewCodeRunnerService(server.Config, coderunService, codelogService, secretService, codeService)
+	executor, err := coderunner.NewExecutor(server.Config.Sandbox)
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to setup the code executor")
+	}
+	coderunnerService.SetExecutor(executor)
+	if server.Config.Egress.Proxy {
+		if server.Config.Sandbox.Executor != "sandbox" {
+			logrus.Fatal("FLOWS_CODE_ACTIONS_EGRESS_PROXY requires FLOWS_CODE_ACTIONS_EXECUTOR=sandbox, plain processes are not kept from connecting around the proxy")
+		}
+		proxy, err := egress.NewProxy(server.Config.Egress.Socket)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to start the egress proxy")
+		}
+		coderunnerService.SetEgressProxy(proxy)
+	}
+	if server.Config.PythonPool.Enabled {
+		coderunnerService.SetPythonPool(coderunner.NewPythonPool(server.Config.PythonPool))
+	}
+
+	// Setup the execution queue, in memory or on a durable RabbitMQ queue shared by the nodes
+	var pool workerpool.Submitter
+	var eda *rabbitmq.EDA
+	if server.Config.WorkerPool.Backend == "rabbitmq" {
+		if server.Config.EDA.RabbitmqURL == "" {
+			logrus.Fatal("FLOWS_CODE_ACTIONS_RABBITMQ_URL is required by the rabbitmq worker pool backend")
+		}
+		eda = rabbitmq.NewEDA(server.Config.EDA.RabbitmqURL)
+		pool = workerpoolRabbitMQ.NewQueue(eda.Connector(), server.Config.WorkerPool.QueueName, coderunService)
+	} else {
+		memoryPool := workerpool.NewPool(server.Config.WorkerPool.Workers, server.Config.WorkerPool.QueueSize)
+		memoryPool.SetProjectWeights(server.Config.WorkerPool.ProjectWeights)
+		memoryPool.SetStarvationAge(time.Duration(server.Config.WorkerPool.StarvationAge) * time.Second)
+		pool = memoryPool
+	}
+	var limiter workerpool.Limiter
+	if server.Config.WorkerPool.MaxInFlightPerCode > 0 || server.Config.WorkerPool.MaxInFlightPerProject > 0 {
+		limiter = workerpool.NewRedisLimiter(
+			server.Redis,
+			server.Config.WorkerPool.MaxInFlightPerCode,
+			server.Config.WorkerPool.MaxInFlightPerProject,
+			time.Duration(server.Config.WorkerPool.InFlightGrace)*time.Second,
+		)
+	}
+
+	webhookService := webhook.NewWebhookService(server.Config.Webhook, coderunService, projectService)
+	coderunnerHandler := handlers.NewCodeRunnerHandler(codeService, coderunnerService, pool, server.Config.ActionLimits, webhookService, limiter)
+
+	if eda != nil {
+		eda.AddConsumer(workerpoolRabbitMQ.NewRunConsumer(
+			server.Config.WorkerPool.QueueName,
+			server.Config.WorkerPool.Workers,
+			server.Config.WorkerPool.MaxRedeliveries,
+			coderunService,
+			coderunnerHandler.RunQueued,
+		))
+		if err := eda.StartConsumers(); err != nil {
+			logrus.WithError(err).Fatal("failed to start code runs consumer")
+		}
+	}
 
 	ratelimiter := s.NewRateLimiter(
 		server.Redis,
@@ -121,9 +220,13 @@ func Setup(server *s.Server) {
 	server.Echo.PATCH("/admin/code/:id", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.UpdateCode, permission.WritePermission))
 	server.Echo.POST("/code", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.CreateCode, permission.WritePermission))
 	server.Echo.GET("/code", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Find, permission.ReadPermission))
+	server.Echo.POST("/code/validate", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Validate, permission.ReadPermission))
 	server.Echo.GET("/code/:id", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Get, permission.ReadPermission))
 	server.Echo.PATCH("/code/:id", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.UpdateCode, permission.WritePermission))
 	server.Echo.DELETE("/code/:id", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Delete, permission.WritePermission))
+	server.Echo.GET("/code/:id/versions", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.ListVersions, permission.ReadPermission))
+	server.Echo.POST("/code/:id/rollback/:version", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Rollback, permission.WritePermission))
+	server.Echo.POST("/code/:id/publish", handlers.ProtectEndpointWithAuthToken(server.Config, codeHandler.Publish, permission.WritePermission))
 
 	server.Echo.GET("/coderun/:id", handlers.ProtectEndpointWithAuthToken(server.Config, coderunHandler.Get, permission.ReadPermission))
 	server.Echo.GET("/coderun", handlers.ProtectEndpointWithAuthToken(server.Config, coderunHandler.Find, permission.ReadPermission))
@@ -131,21 +234,39 @@ func Setup(server *s.Server) {
 	server.Echo.GET("/codelog/:id", handlers.ProtectEndpointWithAuthToken(server.Config, codelogHandler.Get, permission.ReadPermission))
 	server.Echo.GET("/codelog", handlers.ProtectEndpointWithAuthToken(server.Config, codelogHandler.Find, permission.ReadPermission))
 
+	server.Echo.POST("/secret", handlers.ProtectEndpointWithAuthToken(server.Config, secretHandler.Create, permission.WritePermission))
+	server.Echo.GET("/secret", handlers.ProtectEndpointWithAuthToken(server.Config, secretHandler.Find, permission.ReadPermission))
+	server.Echo.DELETE("/secret/:id", handlers.ProtectEndpointWithAuthToken(server.Config, secretHandler.Delete, permission.WritePermission))
+
+	server.Echo.GET("/project/:project_uuid/webhook_secret", handlers.ProtectEndpointWithAuthToken(server.Config, projectHandler.WebhookSecret, permission.WritePermission))
+	server.Echo.GET("/project/:project_uuid/settings", handlers.ProtectEndpointWithAuthToken(server.Config, projectHandler.Settings, permission.ReadPermission))
+	server.Echo.PATCH("/project/:project_uuid/settings", handlers.ProtectEndpointWithAuthToken(server.Config, projectHandler.UpdateSettings, permission.WritePermission))
+
+	server.Echo.GET("/admin/codelib", handlers.RequireAdminAuthToken(server.Config, codelibHandler.List))
+	server.Echo.POST("/admin/codelib", handlers.RequireAdminAuthToken(server.Config, codelibHandler.Create))
+	server.Echo.GET("/admin/codelib/:id", handlers.RequireAdminAuthToken(server.Config, codelibHandler.Get))
+	server.Echo.DELETE("/admin/codelib/:id", handlers.RequireAdminAuthToken(server.Config, codelibHandler.Delete))
+	server.Echo.POST("/admin/codelib/:id/install", handlers.RequireAdminAuthToken(server.Config, codelibHandler.Install))
+
 	server.Echo.POST("/run/:code_id", handlers.RequireAuthToken(server.Config, coderunnerHandler.RunCode))
 	server.Echo.Any("/endpoint/:code_id", coderunnerHandler.RunEndpoint)
 
 	server.Echo.Any("/action/endpoint/:code_id", handlers.LimitByCodeIDMiddleware(coderunnerHandler.ActionEndpoint, *ratelimiter))
+	server.Echo.POST("/action/async/:code_id", handlers.LimitByCodeIDMiddleware(coderunnerHandler.ActionAsyncEndpoint, *ratelimiter))
 
 	server.Echo.Use(echoprometheus.NewMiddleware("codeactions"))
 
 	server.Echo.GET("/metrics", echoprometheus.NewHandler())
 }
 
-// createCodeLogRepository creates either MongoDB or S3 repository based on configuration
-func createCodeLogRepository(cfg *config.Config, db *mongo.Database) (codelog.Repository, error) {
+// createCodeLogRepository creates an S3, PostgreSQL or MongoDB repository based on configuration
+func createCodeLogRepository(cfg *config.Config, db *mongo.Database, sqlDB *sql.DB) (codelog.Repository, error) {
 	if cfg.S3.Enabled {
 		return createS3CodeLogRepository(cfg)
 	}
+	if cfg.DB.Type == "postgres" {
+		return codelogRepoPG.NewCodeLogRepository(sqlDB), nil
+	}
 	return codelogRepoMongo.NewCodeLogRepository(db), nil
 }
 
@@ -25,6 +25,54 @@ var codeUpdatetdCount = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "The number of code updates",
 }, []string{"project_uuid", "code_id"})
 
+var codeRunRejectedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ca_run_rejected_count",
+	Help: "The number of runs rejected for exceeding the in flight runs limit of the code or project",
+}, []string{"project_uuid", "code_id", "scope"})
+
+// Code Run Resource Metrics, read from the cgroup of each run
+var (
+	codeRunPeakMemory = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ca_run_peak_memory_bytes",
+		Help:    "The peak memory used by a run",
+		Buckets: prometheus.ExponentialBuckets(1<<20, 2, 12),
+	}, []string{"code_id"})
+
+	codeRunCPUTime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ca_run_cpu_seconds",
+		Help:    "The cpu time used by a run",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"code_id"})
+
+	codeRunOOMKilledCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ca_run_oom_killed_count",
+		Help: "The number of runs killed for exceeding the memory limit",
+	}, []string{"code_id"})
+)
+
+// Artifact Cache Metrics, the hit rate is the hits over the hits and misses
+var (
+	artifactCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ca_artifact_cache_hits_total",
+		Help: "The number of prepared artifacts reused from the cache",
+	}, []string{"language"})
+
+	artifactCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ca_artifact_cache_misses_total",
+		Help: "The number of prepared artifacts built on a cache miss",
+	}, []string{"language"})
+
+	artifactCacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ca_artifact_cache_evictions_total",
+		Help: "The number of artifacts removed from the cache to fit its size limit",
+	}, []string{"language"})
+
+	artifactCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ca_artifact_cache_size_bytes",
+		Help: "The size of the artifacts in the cache",
+	})
+)
+
 // Worker Pool Metrics - Gauges
 var (
 	workerpoolWorkersTotal = promauto.NewGauge(prometheus.GaugeOpts{
@@ -78,11 +126,11 @@ var (
 
 // Worker Pool Metrics - Histograms
 var (
-	workerpoolQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+	workerpoolQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "workerpool_queue_wait_seconds",
 		Help:    "Time tasks spend waiting in queue before execution",
 		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
-	})
+	}, []string{"lane"})
 
 	workerpoolTaskDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "workerpool_task_duration_seconds",
@@ -115,6 +163,37 @@ func AddCodeUpdatedCount(projectUUID string, codeID string, count float64) {
 	).Add(count)
 }
 
+func AddCodeRunRejectedCount(projectUUID string, codeID string, scope string) {
+	codeRunRejectedCount.WithLabelValues(projectUUID, codeID, scope).Inc()
+}
+
+func ObserveCodeRunPeakMemory(codeID string, bytes float64) {
+	codeRunPeakMemory.WithLabelValues(codeID).Observe(bytes)
+}
+
+func ObserveCodeRunCPUTime(codeID string, seconds float64) {
+	codeRunCPUTime.WithLabelValues(codeID).Observe(seconds)
+}
+
+func AddCodeRunOOMKilledCount(codeID string, count float64) {
+	codeRunOOMKilledCount.WithLabelValues(codeID).Add(count)
+}
+
+// Artifact Cache Metric Functions
+func AddArtifactCacheHit(language string) {
+	artifactCacheHits.WithLabelValues(language).Inc()
+}
+
+func AddArtifactCacheMiss(language string) {
+	artifactCacheMisses.WithLabelValues(language).Inc()
+}
+
+func AddArtifactCacheEviction(language string) {
+	artifactCacheEvictions.WithLabelValues(language).Inc()
+}
+
+func SetArtifactCacheSize(bytes float64) { artifactCacheSize.Set(bytes) }
+
 // Worker Pool Metric Functions - Gauges
 func SetWorkerpoolWorkersTotal(count float64)  { workerpoolWorkersTotal.Set(count) }
 func SetWorkerpoolWorkersBusy(count float64)   { workerpoolWorkersBusy.Set(count) }
@@ -131,5 +210,7 @@ func IncWorkerpoolTasksRejected()  { workerpoolTasksRejected.Inc() }
 func IncWorkerpoolTasksTimeout()   { workerpoolTasksTimeout.Inc() }
 
 // Worker Pool Metric Functions - Histograms
-func ObserveWorkerpoolQueueWait(seconds float64)    { workerpoolQueueWait.Observe(seconds) }
+func ObserveWorkerpoolQueueWait(lane string, seconds float64) {
+	workerpoolQueueWait.WithLabelValues(lane).Observe(seconds)
+}
 func ObserveWorkerpoolTaskDuration(seconds float64) { workerpoolTaskDuration.Observe(seconds) }
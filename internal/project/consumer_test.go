@@ -166,6 +166,15 @@ func (r *inMemoryRepo) FindByUUID(ctx context.Context, uuid string) (*Project, e
 	return r.projects[uuid], nil
 }
 
+func (r *inMemoryRepo) UpdateSettings(ctx context.Context, uuid string, settings Settings) error {
+	p, ok := r.projects[uuid]
+	if !ok {
+		return errors.New("error project not found")
+	}
+	settings.Apply(p)
+	return nil
+}
+
 func (r *inMemoryRepo) Update(ctx context.Context, p *Project) (*Project, error) {
 	for _, pr := range r.projects {
 		if pr.ID == p.ID {
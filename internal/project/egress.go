@@ -0,0 +1,80 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EgressPolicy lists the domains and networks the project code runs can connect to. Private ranges are
+// denied unless included in an allowed CIDR, and when both lists are empty any public host is allowed
+type EgressPolicy struct {
+	// AllowedDomains are host names, or *.name wildcards matching its subdomains
+	AllowedDomains []string `json:"allowed_domains" bson:"allowed_domains,omitempty"`
+	// AllowedCIDRs are networks, or single addresses, allowed even when private
+	AllowedCIDRs []string `json:"allowed_cidrs" bson:"allowed_cidrs,omitempty"`
+}
+
+var domainPattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NormalizeEgressPolicy validates the domains and CIDRs of the policy, returning them lowercased, in
+// canonical form, sorted and without duplicates
+func NormalizeEgressPolicy(policy EgressPolicy) (*EgressPolicy, error) {
+	normalized := &EgressPolicy{AllowedDomains: []string{}, AllowedCIDRs: []string{}}
+	for _, domain := range policy.AllowedDomains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain == "" {
+			continue
+		}
+		if len(domain) > 253 || !domainPattern.MatchString(domain) {
+			return nil, fmt.Errorf("allowed domain %q must be a host name or a *.name wildcard", domain)
+		}
+		normalized.AllowedDomains = append(normalized.AllowedDomains, domain)
+	}
+	for _, cidr := range policy.AllowedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		network, err := ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		normalized.AllowedCIDRs = append(normalized.AllowedCIDRs, network.String())
+	}
+	normalized.AllowedDomains = sortedUnique(normalized.AllowedDomains)
+	normalized.AllowedCIDRs = sortedUnique(normalized.AllowedCIDRs)
+	return normalized, nil
+}
+
+// ParseCIDR parses an allowed network, single addresses are taken as a network of their own
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("allowed cidr %q is not a network or an address", cidr)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("allowed cidr %q is not a network or an address", cidr)
+	}
+	return network, nil
+}
+
+func sortedUnique(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,30 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEgressPolicy(t *testing.T) {
+	policy, err := NormalizeEgressPolicy(EgressPolicy{
+		AllowedDomains: []string{" API.Example.com ", "*.weni.ai", "", "api.example.com."},
+		AllowedCIDRs:   []string{"10.1.2.3/16", "192.168.0.10", "2001:db8::/32", "192.168.0.10/32"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.weni.ai", "api.example.com"}, policy.AllowedDomains)
+	assert.Equal(t, []string{"10.1.0.0/16", "192.168.0.10/32", "2001:db8::/32"}, policy.AllowedCIDRs)
+
+	policy, err = NormalizeEgressPolicy(EgressPolicy{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, policy.AllowedDomains)
+
+	_, err = NormalizeEgressPolicy(EgressPolicy{AllowedDomains: []string{"https://example.com"}})
+	assert.Error(t, err)
+
+	_, err = NormalizeEgressPolicy(EgressPolicy{AllowedDomains: []string{"api.*.example.com"}})
+	assert.Error(t, err)
+
+	_, err = NormalizeEgressPolicy(EgressPolicy{AllowedCIDRs: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+}
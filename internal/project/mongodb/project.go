@@ -65,3 +65,27 @@ func (r *repo) Update(ctx context.Context, project *project.Project) (*project.P
 	}
 	return project, nil
 }
+
+func (r *repo) UpdateSettings(ctx context.Context, uuid string, settings project.Settings) error {
+	fields := bson.M{"updated_at": time.Now()}
+	if settings.CodePolicy != nil {
+		fields["code_policy"] = settings.CodePolicy
+	}
+	if settings.PythonRequirements != nil {
+		fields["python_requirements"] = settings.PythonRequirements
+	}
+	if settings.EgressPolicy != nil {
+		fields["egress_policy"] = settings.EgressPolicy
+	}
+	if settings.WebhookSecret != nil {
+		fields["webhook_secret"] = settings.WebhookSecret
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"uuid": uuid}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -62,13 +62,15 @@ func (r *repo) Create(ctx context.Context, proj *project.Project) (*project.Proj
 
 func (r *repo) FindByUUID(ctx context.Context, uuid string) (*project.Project, error) {
 	query := `
-		SELECT id, mongo_object_id, uuid, name, authorizations, created_at, updated_at
+		SELECT id, mongo_object_id, uuid, name, authorizations, webhook_secret, settings, created_at, updated_at
 		FROM projects
 		WHERE uuid = $1`
 
 	proj := &project.Project{}
 	var mongoObjectID sql.NullString
+	var webhookSecret sql.NullString
 	var authJSON []byte
+	var settingsJSON []byte
 
 	err := r.db.QueryRowContext(ctx, query, uuid).Scan(
 		&proj.ID,
@@ -76,6 +78,8 @@ func (r *repo) FindByUUID(ctx context.Context, uuid string) (*project.Project, e
 		&proj.UUID,
 		&proj.Name,
 		&authJSON,
+		&webhookSecret,
+		&settingsJSON,
 		&proj.CreatedAt,
 		&proj.UpdatedAt,
 	)
@@ -90,6 +94,9 @@ func (r *repo) FindByUUID(ctx context.Context, uuid string) (*project.Project, e
 	if mongoObjectID.Valid {
 		proj.MongoObjectID = mongoObjectID.String
 	}
+	if webhookSecret.Valid {
+		proj.WebhookSecret = webhookSecret.String
+	}
 
 	// Unmarshal authorizations
 	if err := json.Unmarshal(authJSON, &proj.Authorizations); err != nil {
@@ -100,6 +107,14 @@ func (r *repo) FindByUUID(ctx context.Context, uuid string) (*project.Project, e
 		}{}
 	}
 
+	if len(settingsJSON) > 0 {
+		settings := project.Settings{}
+		if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling settings")
+		}
+		settings.Apply(proj)
+	}
+
 	return proj, nil
 }
 
@@ -160,6 +175,39 @@ func (r *repo) UpdateAuthorizations(ctx context.Context, uuid string, authorizat
 	return nil
 }
 
+// UpdateSettings merges the set fields of the settings into the settings field, and updates the webhook_secret field when it is set
+func (r *repo) UpdateSettings(ctx context.Context, uuid string, settings project.Settings) error {
+	query := `
+		UPDATE projects
+		SET settings = settings || $2::jsonb, webhook_secret = COALESCE($3, webhook_secret), updated_at = $4
+		WHERE uuid = $1`
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling settings")
+	}
+	var webhookSecret sql.NullString
+	if settings.WebhookSecret != nil {
+		webhookSecret = nullString(*settings.WebhookSecret)
+	}
+
+	result, err := r.db.ExecContext(ctx, query, uuid, settingsJSON, webhookSecret, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "error updating settings")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("project not found")
+	}
+
+	return nil
+}
+
 // nullString converts an empty string to sql.NullString
 func nullString(s string) sql.NullString {
 	if s == "" {
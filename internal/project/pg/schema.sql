@@ -9,6 +9,8 @@ CREATE TABLE IF NOT EXISTS projects (
     uuid VARCHAR(255) NOT NULL UNIQUE,
     name VARCHAR(255) NOT NULL,
     authorizations JSONB DEFAULT '[]'::jsonb,
+    webhook_secret TEXT,
+    settings JSONB NOT NULL DEFAULT '{}'::jsonb,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
@@ -29,4 +31,5 @@ COMMENT ON COLUMN projects.mongo_object_id IS 'MongoDB ObjectID for backward com
 COMMENT ON COLUMN projects.uuid IS 'Project unique identifier (business UUID)';
 COMMENT ON COLUMN projects.name IS 'Project name';
 COMMENT ON COLUMN projects.authorizations IS 'Array of user authorizations with email and role';
+COMMENT ON COLUMN projects.settings IS 'Code policy, python requirements and egress policy of the project codes';
 COMMENT ON INDEX idx_projects_uuid IS 'Unique constraint and index on project UUID';
@@ -14,22 +14,83 @@ type Project struct {
 		UserEmail string `json:"user_email"`
 		Role      string `json:"role"`
 	} `json:"authorizations"`
-	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// WebhookSecret is the HMAC secret signing the code run completion webhooks of the project
+	WebhookSecret string    `json:"-" bson:"webhook_secret,omitempty"`
+	// CodePolicy adjusts the imports and calls the code validation denies for the codes of the project
+	CodePolicy    CodePolicy `json:"code_policy" bson:"code_policy,omitempty"`
+	// PythonRequirements are the pinned libraries installed in the virtualenv running the project python codes
+	PythonRequirements []string `json:"python_requirements" bson:"python_requirements,omitempty"`
+	// EgressPolicy restricts the hosts the project code runs can connect to
+	EgressPolicy EgressPolicy `json:"egress_policy" bson:"egress_policy,omitempty"`
+	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
 }
 
+// CodePolicy lists the module and function names denied to the project codes in addition to the
+// default ones, and the default denied names allowed to them
+type CodePolicy struct {
+	Allow []string `json:"allow" bson:"allow,omitempty"`
+	Deny  []string `json:"deny" bson:"deny,omitempty"`
+}
+
+// Settings is a change of the project settings, the nil fields are left unchanged.
+// Settings read from a project have every field set
+type Settings struct {
+	CodePolicy         *CodePolicy   `json:"code_policy,omitempty"`
+	PythonRequirements *[]string     `json:"python_requirements,omitempty"`
+	EgressPolicy       *EgressPolicy `json:"egress_policy,omitempty"`
+	WebhookSecret      *string       `json:"-"`
+}
+
 func NewProject(uuid string, name string) *Project {
 	return &Project{UUID: uuid, Name: name}
 }
 
+// Settings returns a copy of the project settings, without the webhook secret
+func (p *Project) Settings() *Settings {
+	policy := p.CodePolicy
+	requirements := append([]string{}, p.PythonRequirements...)
+	egress := p.EgressPolicy
+	return &Settings{CodePolicy: &policy, PythonRequirements: &requirements, EgressPolicy: &egress}
+}
+
+// Apply sets the fields of the settings on the project
+func (s Settings) Apply(p *Project) {
+	if s.CodePolicy != nil {
+		p.CodePolicy = *s.CodePolicy
+	}
+	if s.PythonRequirements != nil {
+		p.PythonRequirements = *s.PythonRequirements
+	}
+	if s.EgressPolicy != nil {
+		p.EgressPolicy = *s.EgressPolicy
+	}
+	if s.WebhookSecret != nil {
+		p.WebhookSecret = *s.WebhookSecret
+	}
+}
+
 type UseCase interface {
 	Create(ctx context.Context, project *Project) (*Project, error)
 	FindByUUID(ctx context.Context, uuid string) (*Project, error)
 	Update(ctx context.Context, project *Project) (*Project, error)
+	WebhookSecret(ctx context.Context, uuid string) (string, error)
+	// CodePolicy returns the code validation policy of the project, empty for unknown projects
+	CodePolicy(ctx context.Context, uuid string) (*CodePolicy, error)
+	// PythonRequirements returns the pinned python libraries of the project, empty for unknown projects
+	PythonRequirements(ctx context.Context, uuid string) ([]string, error)
+	// EgressPolicy returns the network policy of the project code runs, the default one for unknown projects
+	EgressPolicy(ctx context.Context, uuid string) (*EgressPolicy, error)
+	// Settings returns the settings of the project, the default ones for unknown projects
+	Settings(ctx context.Context, uuid string) (*Settings, error)
+	// UpdateSettings validates and saves the set fields of the settings, returning the updated settings
+	UpdateSettings(ctx context.Context, uuid string, settings Settings) (*Settings, error)
 }
 
 type Repository interface {
 	Create(context.Context, *Project) (*Project, error)
 	FindByUUID(context.Context, string) (*Project, error)
 	Update(context.Context, *Project) (*Project, error)
+	// UpdateSettings saves the set fields of the settings, leaving the others unchanged
+	UpdateSettings(ctx context.Context, uuid string, settings Settings) error
 }
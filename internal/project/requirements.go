@@ -0,0 +1,66 @@
+package project
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// requirementPattern matches a pinned requirement, as name[extras]==version
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[A-Za-z0-9._,-]+\])?==([A-Za-z0-9][A-Za-z0-9.+!_-]*)$`)
+
+var nameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// NormalizeRequirements validates that the requirements are pinned, returning them sorted and
+// without duplicates. Empty lines and comments are ignored, as in a requirements file
+func NormalizeRequirements(requirements []string) ([]string, error) {
+	normalized := []string{}
+	names := map[string]bool{}
+	for _, req := range requirements {
+		req = strings.TrimSpace(req)
+		if req == "" || strings.HasPrefix(req, "#") {
+			continue
+		}
+		req = strings.Join(strings.Fields(req), "")
+		if !requirementPattern.MatchString(req) {
+			return nil, fmt.Errorf("requirement %q must be pinned as name==version", req)
+		}
+		name := RequirementName(req)
+		if names[name] {
+			return nil, fmt.Errorf("requirement %q is duplicated", name)
+		}
+		names[name] = true
+		normalized = append(normalized, req)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// RequirementName returns the normalized distribution name of a requirement
+func RequirementName(requirement string) string {
+	m := requirementPattern.FindStringSubmatch(requirement)
+	if m == nil {
+		return ""
+	}
+	return LibraryName(m[1])
+}
+
+// LibraryName returns the distribution name normalized as pip compares them, lowercased with dashes
+func LibraryName(name string) string {
+	return strings.ToLower(nameSeparators.ReplaceAllString(strings.TrimSpace(name), "-"))
+}
+
+// CheckAllowedRequirements returns an error for the first requirement whose library is not in the allow list
+func CheckAllowedRequirements(requirements []string, allowList []string) error {
+	allowed := map[string]bool{}
+	for _, lib := range allowList {
+		allowed[LibraryName(lib)] = true
+	}
+	for _, req := range requirements {
+		if name := RequirementName(req); !allowed[name] {
+			return fmt.Errorf("requirement %q is not in the allowed libraries", name)
+		}
+	}
+	return nil
+}
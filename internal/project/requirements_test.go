@@ -0,0 +1,29 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRequirements(t *testing.T) {
+	requirements, err := NormalizeRequirements([]string{
+		"requests == 2.31.0",
+		"# dates",
+		"",
+		"python-dateutil==2.9.0",
+		"uvicorn[standard]==0.29.0",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"python-dateutil==2.9.0", "requests==2.31.0", "uvicorn[standard]==0.29.0"}, requirements)
+	assert.Equal(t, "python-dateutil", RequirementName("Python_DateUtil==2.9.0"))
+
+	_, err = NormalizeRequirements([]string{"requests>=2.0"})
+	assert.Error(t, err)
+
+	_, err = NormalizeRequirements([]string{"requests==2.31.0", "Requests==2.32.0"})
+	assert.Error(t, err)
+
+	_, err = NormalizeRequirements([]string{"git+https://github.com/psf/requests"})
+	assert.Error(t, err)
+}
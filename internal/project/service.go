@@ -2,16 +2,28 @@ package project
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
 type Service struct {
 	repo Repository
+	// allowedLibs are the libraries the python requirements can pin
+	allowedLibs []string
 }
 
 func NewProjectService(repo Repository) *Service {
 	return &Service{repo: repo}
 }
 
+// SetAllowedLibs sets the libraries the python requirements can pin, none by default
+func (s *Service) SetAllowedLibs(allowList []string) {
+	s.allowedLibs = allowList
+}
+
 func (s *Service) Create(ctx context.Context, project *Project) (*Project, error) {
 	return s.repo.Create(ctx, project)
 }
@@ -23,3 +35,99 @@ func (s *Service) FindByUUID(ctx context.Context, uuid string) (*Project, error)
 func (s *Service) Update(ctx context.Context, project *Project) (*Project, error) {
 	return s.repo.Update(ctx, project)
 }
+
+// WebhookSecret returns the project webhook HMAC secret, generating it on the first use
+func (s *Service) WebhookSecret(ctx context.Context, uuid string) (string, error) {
+	p, err := s.repo.FindByUUID(ctx, uuid)
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return "", errors.New("project not found")
+	}
+	if p.WebhookSecret != "" {
+		return p.WebhookSecret, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.Wrap(err, "error generating webhook secret")
+	}
+	secret := hex.EncodeToString(key)
+	if err := s.repo.UpdateSettings(ctx, uuid, Settings{WebhookSecret: &secret}); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (s *Service) CodePolicy(ctx context.Context, uuid string) (*CodePolicy, error) {
+	p, err := s.repo.FindByUUID(ctx, uuid)
+	if err != nil || p == nil {
+		// projects are synced asynchronously, codes of unknown projects get the default policy
+		return &CodePolicy{}, nil
+	}
+	return &p.CodePolicy, nil
+}
+
+func (s *Service) PythonRequirements(ctx context.Context, uuid string) ([]string, error) {
+	p, err := s.repo.FindByUUID(ctx, uuid)
+	if err != nil || p == nil {
+		return []string{}, nil
+	}
+	return p.PythonRequirements, nil
+}
+
+func (s *Service) EgressPolicy(ctx context.Context, uuid string) (*EgressPolicy, error) {
+	p, err := s.repo.FindByUUID(ctx, uuid)
+	if err != nil || p == nil {
+		return &EgressPolicy{}, nil
+	}
+	return &p.EgressPolicy, nil
+}
+
+func (s *Service) Settings(ctx context.Context, uuid string) (*Settings, error) {
+	p, err := s.repo.FindByUUID(ctx, uuid)
+	if err != nil || p == nil {
+		return (&Project{}).Settings(), nil
+	}
+	return p.Settings(), nil
+}
+
+func (s *Service) UpdateSettings(ctx context.Context, uuid string, settings Settings) (*Settings, error) {
+	if settings.CodePolicy != nil {
+		policy := CodePolicy{Allow: cleanNames(settings.CodePolicy.Allow), Deny: cleanNames(settings.CodePolicy.Deny)}
+		settings.CodePolicy = &policy
+	}
+	if settings.PythonRequirements != nil {
+		requirements, err := NormalizeRequirements(*settings.PythonRequirements)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckAllowedRequirements(requirements, s.allowedLibs); err != nil {
+			return nil, err
+		}
+		settings.PythonRequirements = &requirements
+	}
+	if settings.EgressPolicy != nil {
+		policy, err := NormalizeEgressPolicy(*settings.EgressPolicy)
+		if err != nil {
+			return nil, err
+		}
+		settings.EgressPolicy = policy
+	}
+	if err := s.repo.UpdateSettings(ctx, uuid, settings); err != nil {
+		return nil, err
+	}
+	return s.Settings(ctx, uuid)
+}
+
+// cleanNames trims the names and drops the empty ones
+func cleanNames(names []string) []string {
+	cleaned := []string{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned
+}
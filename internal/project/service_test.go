@@ -0,0 +1,54 @@
+package project
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateSettings(t *testing.T) {
+	repo := NewMemProjectRepository()
+	service := NewProjectService(repo)
+	service.SetAllowedLibs([]string{"Requests", "python_dateutil"})
+	ctx := context.TODO()
+	_, err := service.Create(ctx, NewProject("project", "Project"))
+	assert.NoError(t, err)
+
+	requirements := []string{"requests == 2.31.0"}
+	settings, err := service.UpdateSettings(ctx, "project", Settings{
+		CodePolicy:         &CodePolicy{Allow: []string{" subprocess ", ""}},
+		PythonRequirements: &requirements,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subprocess"}, settings.CodePolicy.Allow)
+	assert.Equal(t, []string{"requests==2.31.0"}, *settings.PythonRequirements)
+
+	settings, err = service.UpdateSettings(ctx, "project", Settings{EgressPolicy: &EgressPolicy{AllowedDomains: []string{"api.example.com"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subprocess"}, settings.CodePolicy.Allow)
+	assert.Equal(t, []string{"requests==2.31.0"}, *settings.PythonRequirements)
+	assert.Equal(t, []string{"api.example.com"}, settings.EgressPolicy.AllowedDomains)
+
+	invalid := []string{"requests"}
+	_, err = service.UpdateSettings(ctx, "project", Settings{PythonRequirements: &invalid})
+	assert.Error(t, err)
+
+	// only the libraries of the allow list can be pinned
+	allowed := []string{"python-dateutil==2.9.0"}
+	_, err = service.UpdateSettings(ctx, "project", Settings{PythonRequirements: &allowed})
+	assert.NoError(t, err)
+	denied := []string{"python-dateutil==2.9.0", "reqeusts==2.31.0"}
+	_, err = service.UpdateSettings(ctx, "project", Settings{PythonRequirements: &denied})
+	assert.EqualError(t, err, `requirement "reqeusts" is not in the allowed libraries`)
+
+	secret, err := service.WebhookSecret(ctx, "project")
+	assert.NoError(t, err)
+	again, err := service.WebhookSecret(ctx, "project")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, again)
+
+	settings, err = service.Settings(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, *settings.PythonRequirements)
+}
@@ -0,0 +1,63 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// Cipher encrypts the secret values with AES-256-GCM. Values are stored as base64(nonce | ciphertext)
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a Cipher from a base64 encoded 32 bytes master key
+func NewCipher(masterKey string) (*Cipher, error) {
+	if masterKey == "" {
+		return nil, errors.New("secrets master key is not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid secrets master key encoding")
+	}
+	if len(key) != 32 {
+		return nil, errors.New("secrets master key must have 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "error generating nonce")
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(encrypted string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid encrypted secret encoding")
+	}
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("invalid encrypted secret")
+	}
+	plaintext, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error decrypting secret")
+	}
+	return string(plaintext), nil
+}
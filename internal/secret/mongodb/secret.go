@@ -0,0 +1,91 @@
+package secret
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/secret"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type secretRepo struct {
+	collection *mongo.Collection
+}
+
+func NewSecretRepository(db *mongo.Database) secret.Repository {
+	collection := db.Collection("secret")
+	return &secretRepo{collection: collection}
+}
+
+func (r *secretRepo) Upsert(ctx context.Context, sc *secret.Secret) (*secret.Secret, error) {
+	now := time.Now()
+	filter := bson.M{"project_uuid": sc.ProjectUUID, "code_id": sc.CodeID, "name": sc.Name}
+	update := bson.M{
+		"$set":         bson.M{"value": sc.Value, "updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	saved := &secret.Secret{}
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(saved); err != nil {
+		return nil, errors.Wrap(err, "error saving secret")
+	}
+	saved.ID = saved.MongoObjectID
+	return saved, nil
+}
+
+func (r *secretRepo) GetByID(ctx context.Context, id string) (*secret.Secret, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("secret not found")
+	}
+	sc := &secret.Secret{}
+	err = r.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(sc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("secret not found")
+		}
+		return nil, err
+	}
+	sc.ID = sc.MongoObjectID
+	return sc, nil
+}
+
+func (r *secretRepo) ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]secret.Secret, error) {
+	secrets := []secret.Secret{}
+	filter := bson.M{
+		"project_uuid": projectUUID,
+		"code_id":      bson.M{"$in": []string{"", codeID}},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &secrets); err != nil {
+		return nil, err
+	}
+	for i := range secrets {
+		secrets[i].ID = secrets[i].MongoObjectID
+	}
+	return secrets, nil
+}
+
+func (r *secretRepo) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("secret not found")
+	}
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("secret not found")
+	}
+	return nil
+}
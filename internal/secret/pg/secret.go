@@ -0,0 +1,135 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/secret"
+	"github.com/weni-ai/flows-code-actions/internal/util"
+
+	_ "github.com/lib/pq"
+)
+
+type secretRepo struct {
+	db *sql.DB
+}
+
+// NewSecretRepository creates a new PostgreSQL repository for secret entities
+func NewSecretRepository(db *sql.DB) secret.Repository {
+	return &secretRepo{db: db}
+}
+
+func (r *secretRepo) Upsert(ctx context.Context, sc *secret.Secret) (*secret.Secret, error) {
+	query := `
+		INSERT INTO secrets (project_uuid, code_id, name, value, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (project_uuid, code_id, name)
+		DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at`
+
+	sc.CreatedAt = time.Now()
+	sc.UpdatedAt = sc.CreatedAt
+
+	err := r.db.QueryRowContext(ctx, query,
+		sc.ProjectUUID,
+		sc.CodeID,
+		sc.Name,
+		sc.Value,
+		sc.CreatedAt,
+		sc.UpdatedAt,
+	).Scan(&sc.ID, &sc.CreatedAt)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error saving secret")
+	}
+	return sc, nil
+}
+
+func (r *secretRepo) GetByID(ctx context.Context, id string) (*secret.Secret, error) {
+	if !util.IsUUID(id) {
+		return nil, errors.New("secret not found")
+	}
+	query := `
+		SELECT id, project_uuid, code_id, name, value, created_at, updated_at
+		FROM secrets
+		WHERE id = $1`
+
+	sc := &secret.Secret{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&sc.ID,
+		&sc.ProjectUUID,
+		&sc.CodeID,
+		&sc.Name,
+		&sc.Value,
+		&sc.CreatedAt,
+		&sc.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("secret not found")
+		}
+		return nil, errors.Wrap(err, "error getting secret by id")
+	}
+	return sc, nil
+}
+
+func (r *secretRepo) ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]secret.Secret, error) {
+	query := `
+		SELECT id, project_uuid, code_id, name, value, created_at, updated_at
+		FROM secrets
+		WHERE project_uuid = $1 AND (code_id = '' OR code_id = $2)
+		ORDER BY name ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, projectUUID, codeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing secrets")
+	}
+	defer rows.Close()
+
+	secrets := []secret.Secret{}
+	for rows.Next() {
+		var sc secret.Secret
+		err := rows.Scan(
+			&sc.ID,
+			&sc.ProjectUUID,
+			&sc.CodeID,
+			&sc.Name,
+			&sc.Value,
+			&sc.CreatedAt,
+			&sc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning secret row")
+		}
+		secrets = append(secrets, sc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating secret rows")
+	}
+
+	return secrets, nil
+}
+
+func (r *secretRepo) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM secrets WHERE id::text = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return errors.Wrap(err, "error deleting secret")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error checking affected rows")
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("secret not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// Secret is a value available to the actions of a project, or of a single code when CodeID is set.
+// Value holds the encrypted value at rest and is never returned by the API
+type Secret struct {
+	ID            string `json:"id,omitempty"`                                   // PostgreSQL UUID (primary key)
+	MongoObjectID string `json:"mongo_object_id,omitempty" bson:"_id,omitempty"` // MongoDB ObjectID for backward compatibility
+
+	ProjectUUID string `bson:"project_uuid" json:"project_uuid"`
+	CodeID      string `bson:"code_id" json:"code_id,omitempty"`
+	Name        string `bson:"name" json:"name"`
+	Value       string `bson:"value" json:"-"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type UseCase interface {
+	// Create encrypts and saves the secret, replacing the value of a secret with the same name and scope
+	Create(ctx context.Context, projectUUID string, codeID string, name string, value string) (*Secret, error)
+	GetByID(ctx context.Context, id string) (*Secret, error)
+	ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]Secret, error)
+	Delete(ctx context.Context, id string) error
+	// ResolveSecrets returns the decrypted secrets available to a code by name, the code secrets taking
+	// precedence over the project ones
+	ResolveSecrets(ctx context.Context, codeID string) (map[string]string, error)
+}
+
+type Repository interface {
+	Upsert(context.Context, *Secret) (*Secret, error)
+	GetByID(context.Context, string) (*Secret, error)
+	// ListByProjectUUID returns the project secrets, and the secrets of codeID when it is not empty
+	ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]Secret, error)
+	Delete(context.Context, string) error
+}
+
+// ValidateName checks that the name can be used as an environment variable name
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf(`secret name (%s) is not valid, it must contain only letters, digits and underscores, not starting with a digit`, name)
+	}
+	return nil
+}
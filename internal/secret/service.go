@@ -0,0 +1,93 @@
+package secret
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/weni-ai/flows-code-actions/internal/code"
+)
+
+type Service struct {
+	repo   Repository
+	cipher *Cipher
+	codes  code.UseCase
+}
+
+// NewSecretService creates the secrets service. Without a cipher, from a missing master key, secrets
+// can't be created and no secret is resolved for the actions
+func NewSecretService(repo Repository, cipher *Cipher, codes code.UseCase) *Service {
+	return &Service{repo: repo, cipher: cipher, codes: codes}
+}
+
+func (s *Service) Create(ctx context.Context, projectUUID string, codeID string, name string, value string) (*Secret, error) {
+	if s.cipher == nil {
+		return nil, errors.New("secrets master key is not configured")
+	}
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	if codeID != "" {
+		c, err := s.codes.GetByID(ctx, codeID)
+		if err != nil || c == nil {
+			return nil, errors.New("code not found")
+		}
+		if c.ProjectUUID != projectUUID {
+			return nil, errors.New("code does not belong to the project")
+		}
+		codeID = c.Key()
+	}
+
+	encrypted, err := s.cipher.Encrypt(value)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Upsert(ctx, &Secret{ProjectUUID: projectUUID, CodeID: codeID, Name: name, Value: encrypted})
+}
+
+func (s *Service) GetByID(ctx context.Context, id string) (*Secret, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Service) ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]Secret, error) {
+	if codeID != "" {
+		c, err := s.codes.GetByID(ctx, codeID)
+		if err != nil || c == nil {
+			return nil, errors.New("code not found")
+		}
+		codeID = c.Key()
+	}
+	return s.repo.ListByProjectUUID(ctx, projectUUID, codeID)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *Service) ResolveSecrets(ctx context.Context, codeID string) (map[string]string, error) {
+	if s.cipher == nil {
+		return nil, nil
+	}
+	c, err := s.codes.GetByID(ctx, codeID)
+	if err != nil || c == nil {
+		return nil, errors.New("code not found")
+	}
+	key := c.Key()
+
+	secrets, err := s.repo.ListByProjectUUID(ctx, c.ProjectUUID, key)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, sc := range secrets {
+		if _, ok := values[sc.Name]; ok && sc.CodeID != key {
+			continue
+		}
+		value, err := s.cipher.Decrypt(sc.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decrypting secret %s", sc.Name)
+		}
+		values[sc.Name] = value
+	}
+	return values, nil
+}
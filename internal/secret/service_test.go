@@ -0,0 +1,81 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/internal/code"
+)
+
+type fakeCodes struct {
+	code.UseCase
+}
+
+func (fakeCodes) GetByID(ctx context.Context, id string) (*code.Code, error) {
+	return &code.Code{ID: id, ProjectUUID: "project"}, nil
+}
+
+type fakeRepo struct {
+	Repository
+	secrets []Secret
+}
+
+func (r *fakeRepo) Upsert(ctx context.Context, sc *Secret) (*Secret, error) {
+	r.secrets = append(r.secrets, *sc)
+	return sc, nil
+}
+
+func (r *fakeRepo) ListByProjectUUID(ctx context.Context, projectUUID string, codeID string) ([]Secret, error) {
+	secrets := []Secret{}
+	for _, sc := range r.secrets {
+		if sc.ProjectUUID == projectUUID && (sc.CodeID == "" || sc.CodeID == codeID) {
+			secrets = append(secrets, sc)
+		}
+	}
+	return secrets, nil
+}
+
+func TestCipher(t *testing.T) {
+	_, err := NewCipher("")
+	assert.Error(t, err)
+	_, err = NewCipher(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+
+	cipher, err := NewCipher(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	assert.NoError(t, err)
+
+	encrypted, err := cipher.Encrypt("token")
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "token")
+
+	value, err := cipher.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", value)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	cipher, _ := NewCipher(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	s := NewSecretService(&fakeRepo{}, cipher, fakeCodes{})
+	ctx := context.Background()
+
+	_, err := s.Create(ctx, "project", "code", "API_TOKEN", "code token")
+	assert.NoError(t, err)
+	_, err = s.Create(ctx, "project", "", "API_TOKEN", "project token")
+	assert.NoError(t, err)
+	_, err = s.Create(ctx, "project", "", "BASE_URL", "https://api.weni.ai")
+	assert.NoError(t, err)
+	_, err = s.Create(ctx, "project", "other", "OTHER", "other")
+	assert.NoError(t, err)
+	_, err = s.Create(ctx, "project", "", "1INVALID", "value")
+	assert.Error(t, err)
+
+	secrets, err := s.ResolveSecrets(ctx, "code")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_TOKEN": "code token", "BASE_URL": "https://api.weni.ai"}, secrets)
+
+	secrets, err = NewSecretService(&fakeRepo{}, nil, fakeCodes{}).ResolveSecrets(ctx, "code")
+	assert.NoError(t, err)
+	assert.Nil(t, secrets)
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/egress"
+)
+
+const (
+	// CallbackURLHeader sets the callback URL of a single invocation, taking precedence over the code callback URL
+	CallbackURLHeader = "X-Code-Actions-Callback-Url"
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, signed with the project webhook secret
+	SignatureHeader = "X-Code-Actions-Signature"
+	// RunIDHeader carries the id of the delivered code run
+	RunIDHeader = "X-Code-Actions-Run-Id"
+
+	// extraKey is the code run extra key where the delivery attempts are recorded
+	extraKey = "webhook"
+)
+
+// Payload is the body posted to the callback URL when a code run finishes
+type Payload struct {
+	ID       string                 `json:"id"`
+	CodeID   string                 `json:"code_id"`
+	Status   coderun.CodeRunStatus  `json:"status"`
+	Result   string                 `json:"result"`
+	Extra    map[string]interface{} `json:"extra"`
+	Duration float64                `json:"duration"` // execution duration in seconds
+}
+
+// Attempt is a delivery attempt recorded on the code run extra
+type Attempt struct {
+	Attempt    int       `json:"attempt" bson:"attempt"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	At         time.Time `json:"at" bson:"at"`
+}
+
+// SecretProvider returns the HMAC secret used to sign the webhooks of a project
+type SecretProvider interface {
+	WebhookSecret(ctx context.Context, projectUUID string) (string, error)
+}
+
+// Notifier delivers finished code runs to their callback URL
+type Notifier interface {
+	Notify(run *coderun.CodeRun, projectUUID string, callbackURL string, duration time.Duration)
+}
+
+type Service struct {
+	codeRun coderun.UseCase
+	secrets SecretProvider
+	conf    config.WebhookConfig
+	client  *http.Client
+	sleep   func(time.Duration)
+}
+
+func NewWebhookService(conf config.WebhookConfig, codeRun coderun.UseCase, secrets SecretProvider) *Service {
+	return &Service{
+		codeRun: codeRun,
+		secrets: secrets,
+		conf:    conf,
+		client:  newClient(time.Duration(conf.Timeout) * time.Second),
+		sleep:   time.Sleep,
+	}
+}
+
+// Notify delivers the run in background when it is completed or failed and there is a callback URL
+func (s *Service) Notify(run *coderun.CodeRun, projectUUID string, callbackURL string, duration time.Duration) {
+	if run == nil || callbackURL == "" {
+		return
+	}
+	if run.Status != coderun.StatusCompleted && run.Status != coderun.StatusFailed {
+		return
+	}
+	go func() {
+		if err := s.Deliver(context.Background(), run, projectUUID, callbackURL, duration); err != nil {
+			log.WithError(err).WithField("run_id", run.ID).Error("error on delivering code run webhook")
+		}
+	}()
+}
+
+// Deliver posts the run to the callback URL, retrying with exponential backoff until it is accepted
+// or the max attempts are reached. Every attempt is recorded on the run extra
+func (s *Service) Deliver(ctx context.Context, run *coderun.CodeRun, projectUUID string, callbackURL string, duration time.Duration) error {
+	secret, err := s.secrets.WebhookSecret(ctx, projectUUID)
+	if err != nil {
+		err = errors.Wrap(err, "error on getting project webhook secret")
+		s.record(ctx, run.ID, callbackURL, []Attempt{{Attempt: 1, Error: err.Error(), At: time.Now()}}, false)
+		return err
+	}
+
+	body, err := json.Marshal(newPayload(run, duration))
+	if err != nil {
+		return errors.Wrap(err, "error on encoding webhook payload")
+	}
+
+	backoff := time.Duration(s.conf.InitialBackoff) * time.Millisecond
+	attempts := []Attempt{}
+	for i := 1; i <= s.conf.MaxAttempts; i++ {
+		attempt := s.send(ctx, callbackURL, secret, run.ID, body)
+		attempt.Attempt = i
+		attempts = append(attempts, attempt)
+
+		delivered := attempt.Error == ""
+		s.record(ctx, run.ID, callbackURL, attempts, delivered)
+		if delivered {
+			return nil
+		}
+		if i < s.conf.MaxAttempts {
+			s.sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("webhook not delivered after %d attempts", len(attempts))
+}
+
+func (s *Service) send(ctx context.Context, callbackURL string, secret string, runID string, body []byte) Attempt {
+	attempt := Attempt{At: time.Now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+	req.Header.Set(RunIDHeader, runID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// record saves the delivery attempts on the run extra, keeping the other extra values
+func (s *Service) record(ctx context.Context, runID string, callbackURL string, attempts []Attempt, delivered bool) {
+	run, err := s.codeRun.GetByID(ctx, runID)
+	if err != nil {
+		log.WithError(err).Error("error on getting code run to record webhook attempt")
+		return
+	}
+	if run.Extra == nil {
+		run.Extra = map[string]interface{}{}
+	}
+	run.Extra[extraKey] = map[string]interface{}{
+		"url":       callbackURL,
+		"delivered": delivered,
+		"attempts":  attempts,
+	}
+	if _, err := s.codeRun.Update(ctx, runID, run); err != nil {
+		log.WithError(err).Error("error on recording webhook attempt")
+	}
+}
+
+func newPayload(run *coderun.CodeRun, duration time.Duration) Payload {
+	extra := map[string]interface{}{}
+	for k, v := range run.Extra {
+		if k != extraKey {
+			extra[k] = v
+		}
+	}
+	return Payload{
+		ID:       run.ID,
+		CodeID:   run.CodeID,
+		Status:   run.Status,
+		Result:   run.Result,
+		Extra:    extra,
+		Duration: duration.Seconds(),
+	}
+}
+
+// Sign returns the signature of the body sent on SignatureHeader, in the "sha256=<hex hmac>" format
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL checks that a callback URL is an absolute http or https URL whose host does not resolve to
+// a private address
+func ValidateURL(callbackURL string) error {
+	u, err := url.ParseRequestURI(callbackURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid callback url")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid callback url, it must be an absolute http or https url")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.Wrap(err, "invalid callback url, its host does not resolve")
+	}
+	for _, addr := range addrs {
+		if egress.IsPrivate(addr.IP) {
+			return errors.New("invalid callback url, it must not point to a private address")
+		}
+	}
+	return nil
+}
+
+// newClient returns the client posting the webhooks. The addresses are checked on connect, so a callback
+// host resolving to a private address after it was validated is still refused
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: denyPrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func denyPrivate(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || egress.IsPrivate(ip) {
+		return fmt.Errorf("callback url resolves to the private address %s", host)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/config"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+)
+
+type fakeCodeRuns struct {
+	coderun.UseCase
+	run *coderun.CodeRun
+}
+
+func (f *fakeCodeRuns) GetByID(ctx context.Context, id string) (*coderun.CodeRun, error) {
+	return f.run, nil
+}
+
+func (f *fakeCodeRuns) Update(ctx context.Context, id string, run *coderun.CodeRun) (*coderun.CodeRun, error) {
+	f.run = run
+	return run, nil
+}
+
+type fakeSecrets struct{}
+
+func (fakeSecrets) WebhookSecret(ctx context.Context, projectUUID string) (string, error) {
+	return "secret", nil
+}
+
+func TestDeliver(t *testing.T) {
+	calls := 0
+	var signature, runID string
+	var payload Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		runID = r.Header.Get(RunIDHeader)
+		assert.Equal(t, Sign("secret", body), signature)
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	run := &coderun.CodeRun{
+		ID:     "run-1",
+		CodeID: "code-1",
+		Status: coderun.StatusCompleted,
+		Result: "ok",
+		Extra:  map[string]interface{}{"status_code": 200},
+	}
+	runs := &fakeCodeRuns{run: run}
+	s := NewWebhookService(config.WebhookConfig{MaxAttempts: 3, InitialBackoff: 1, Timeout: 1}, runs, fakeSecrets{})
+	// the test server listens on loopback, refused by the default client
+	s.client = srv.Client()
+	backoffs := []time.Duration{}
+	s.sleep = func(d time.Duration) { backoffs = append(backoffs, d) }
+
+	err := s.Deliver(context.Background(), run, "project-1", srv.URL, 2*time.Second)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []time.Duration{time.Millisecond}, backoffs)
+	assert.Equal(t, "run-1", runID)
+	assert.Equal(t, "code-1", payload.CodeID)
+	assert.Equal(t, "ok", payload.Result)
+	assert.Equal(t, 2.0, payload.Duration)
+
+	record := runs.run.Extra[extraKey].(map[string]interface{})
+	assert.Equal(t, true, record["delivered"])
+	attempts := record["attempts"].([]Attempt)
+	assert.Len(t, attempts, 2)
+	assert.Equal(t, http.StatusBadGateway, attempts[0].StatusCode)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Equal(t, http.StatusOK, attempts[1].StatusCode)
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("webhook delivered to a private address")
+	}))
+	defer srv.Close()
+
+	run := &coderun.CodeRun{ID: "run-1", Status: coderun.StatusCompleted}
+	runs := &fakeCodeRuns{run: run}
+	s := NewWebhookService(config.WebhookConfig{MaxAttempts: 1, Timeout: 1}, runs, fakeSecrets{})
+
+	assert.Error(t, s.Deliver(context.Background(), run, "project-1", srv.URL, time.Second))
+	attempts := runs.run.Extra[extraKey].(map[string]interface{})["attempts"].([]Attempt)
+	assert.Contains(t, attempts[0].Error, "private address")
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://93.184.216.34/hook"))
+	assert.Error(t, ValidateURL("ftp://93.184.216.34/hook"))
+	assert.Error(t, ValidateURL("/hook"))
+	assert.Error(t, ValidateURL("http://localhost:8050/hook"))
+	assert.Error(t, ValidateURL("http://127.0.0.1/hook"))
+	assert.Error(t, ValidateURL("http://10.0.0.5/hook"))
+	assert.Error(t, ValidateURL("http://169.254.169.254/latest/meta-data"))
+	assert.Error(t, ValidateURL("http://[::1]/hook"))
+}
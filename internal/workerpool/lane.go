@@ -0,0 +1,97 @@
+package workerpool
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lane is the priority class of a task, the pool serves the lanes from the highest priority
+type Lane string
+
+const (
+	// LaneInteractive is for the runs a customer waits for, like the endpoint calls
+	LaneInteractive Lane = "interactive"
+	// LaneFlow is for the runs triggered by the flows
+	LaneFlow Lane = "flow"
+	// LaneBatch is for the asynchronous runs, nobody waits for
+	LaneBatch Lane = "batch"
+)
+
+// Lanes are the lanes from the highest to the lowest priority
+var Lanes = []Lane{LaneInteractive, LaneFlow, LaneBatch}
+
+// ParseLane returns the lane with the given name
+func ParseLane(name string) (Lane, error) {
+	for _, lane := range Lanes {
+		if string(lane) == name {
+			return lane, nil
+		}
+	}
+	return "", fmt.Errorf("lane must be one of %v", Lanes)
+}
+
+// laneQueue holds the tasks of a lane, with a queue per project served in turns
+type laneQueue struct {
+	lane   Lane
+	queued int
+	queues map[string]*projectQueue
+	turns  []*projectQueue // projects with queued tasks, served in order
+	turn   int
+}
+
+// projectQueue is the queue of the tasks of a project
+type projectQueue struct {
+	project string
+	tasks   []Task
+	// left is the number of tasks the project is served on its current turn
+	left int
+}
+
+func newLaneQueue(lane Lane) *laneQueue {
+	return &laneQueue{lane: lane, queues: map[string]*projectQueue{}}
+}
+
+func (l *laneQueue) push(task Task, weight int) {
+	q, ok := l.queues[task.ProjectUUID]
+	if !ok {
+		q = &projectQueue{project: task.ProjectUUID, left: weight}
+		l.queues[task.ProjectUUID] = q
+		l.turns = append(l.turns, q)
+	}
+	q.tasks = append(q.tasks, task)
+	l.queued++
+}
+
+// pop takes a task from the project on its turn, which is served as many tasks as its weight
+func (l *laneQueue) pop(weight func(project string) int) Task {
+	q := l.turns[l.turn]
+	task := q.tasks[0]
+	q.tasks[0] = Task{}
+	q.tasks = q.tasks[1:]
+	q.left--
+	l.queued--
+
+	if len(q.tasks) == 0 {
+		// the project leaves the turns until it queues tasks again
+		delete(l.queues, q.project)
+		l.turns = append(l.turns[:l.turn], l.turns[l.turn+1:]...)
+	} else if q.left <= 0 {
+		q.left = weight(q.project)
+		l.turn++
+	}
+	if l.turn >= len(l.turns) {
+		l.turn = 0
+	}
+	return task
+}
+
+// oldest returns when the longest waiting task of the lane was queued
+func (l *laneQueue) oldest() time.Time {
+	var oldest time.Time
+	for _, q := range l.turns {
+		if queuedAt := q.tasks[0].queuedAt; oldest.IsZero() || queuedAt.Before(oldest) {
+			oldest = queuedAt
+		}
+	}
+	return oldest
+}
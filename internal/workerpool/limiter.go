@@ -0,0 +1,95 @@
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// LimitError is returned when a run would exceed the in flight runs limit of its code or project
+type LimitError struct {
+	// Scope is "code" or "project"
+	Scope string
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("too many runs in flight for the %s, the limit is %d", e.Scope, e.Limit)
+}
+
+// Limiter bounds the runs in flight, queued or running, of each code and project across the nodes
+type Limiter interface {
+	// Acquire takes a slot of the code and its project for the run, held until released or until the run
+	// timeout and a grace period for the time queued expire, failing with a LimitError when any of them is full
+	Acquire(ctx context.Context, codeID string, projectUUID string, runID string, timeout time.Duration) error
+	// Release frees the slots of the run, it is safe to release a run more than once
+	Release(ctx context.Context, codeID string, projectUUID string, runID string) error
+}
+
+// acquireScript takes a slot of the code and project sorted sets, the runs scored by their lease expiration,
+// after removing the expired leases of the runs lost by their nodes
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expires = tonumber(ARGV[2])
+for i, key in ipairs(KEYS) do
+	redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+	local limit = tonumber(ARGV[3 + i])
+	if limit > 0 and redis.call("ZSCORE", key, ARGV[3]) == false and redis.call("ZCARD", key) >= limit then
+		return i
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call("ZADD", key, expires, ARGV[3])
+	local last = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+	redis.call("PEXPIREAT", key, last[2])
+end
+return 0
+`)
+
+// RedisLimiter is a Limiter keeping the runs in flight on redis sorted sets shared by the nodes
+type RedisLimiter struct {
+	client       *redis.Client
+	codeLimit    int
+	projectLimit int
+	grace        time.Duration
+}
+
+// NewRedisLimiter creates a limiter of the runs in flight per code and per project, a limit <= 0 means no limit.
+// The slots of the runs lost by their nodes are freed once their timeout and the grace period expire
+func NewRedisLimiter(client *redis.Client, codeLimit int, projectLimit int, grace time.Duration) *RedisLimiter {
+	return &RedisLimiter{client: client, codeLimit: codeLimit, projectLimit: projectLimit, grace: grace}
+}
+
+func (l *RedisLimiter) keys(codeID string, projectUUID string) []string {
+	return []string{"inflight:code:" + codeID, "inflight:project:" + projectUUID}
+}
+
+func (l *RedisLimiter) Acquire(ctx context.Context, codeID string, projectUUID string, runID string, timeout time.Duration) error {
+	now := time.Now()
+	full, err := acquireScript.Run(ctx, l.client, l.keys(codeID, projectUUID),
+		now.UnixMilli(), now.Add(timeout+l.grace).UnixMilli(), runID, l.codeLimit, l.projectLimit).Int()
+	if err != nil {
+		return errors.Wrap(err, "error on acquiring run slot")
+	}
+	switch full {
+	case 1:
+		return &LimitError{Scope: "code", Limit: l.codeLimit}
+	case 2:
+		return &LimitError{Scope: "project", Limit: l.projectLimit}
+	}
+	return nil
+}
+
+func (l *RedisLimiter) Release(ctx context.Context, codeID string, projectUUID string, runID string) error {
+	pipe := l.client.TxPipeline()
+	for _, key := range l.keys(codeID, projectUUID) {
+		pipe.ZRem(ctx, key, runID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.Wrap(err, "error on releasing run slot")
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package workerpool
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,17 +20,42 @@ type Result struct {
 }
 
 type Task struct {
-	Ctx      context.Context
-	Execute  func(ctx context.Context) (*coderun.CodeRun, error)
-	Result   chan Result
+	Ctx     context.Context
+	Execute func(ctx context.Context) (*coderun.CodeRun, error)
+	Result  chan Result
+	// RunID is the queued code run the task executes. Durable queues publish it instead of
+	// Execute, so the run can be executed by any node
+	RunID string
+	// ProjectUUID is the project of the task code, the pool serves the projects fairly
+	ProjectUUID string
+	// Lane is the priority of the task, LaneFlow when empty
+	Lane     Lane
 	queuedAt time.Time // timestamp when task entered the queue
 }
 
+// Submitter queues tasks for execution, in memory by Pool or on a durable queue shared by nodes
+type Submitter interface {
+	Submit(task Task) error
+}
+
+// DefaultStarvationAge is how long a task of a lower priority lane waits before its lane is served first
+const DefaultStarvationAge = 5 * time.Second
+
+// Pool executes the tasks in memory. The workers serve the lanes by priority, a lower priority lane
+// being served first when its oldest task waited longer than the starvation age. In each lane a project
+// has its own queue and the projects with queued tasks are served in turns, taking as many tasks as the
+// project weight on each turn, so a project queueing many tasks does not starve the others
 type Pool struct {
-	tasks       chan Task
 	workerCount int
 	queueSize   int
 	busyWorkers int64 // atomic counter for busy workers
+
+	mu            sync.Mutex
+	ready         *sync.Cond
+	queued        int
+	lanes         []*laneQueue // by priority
+	weights       map[string]int
+	starvationAge time.Duration
 }
 
 func NewPool(workers int, queueSize int) *Pool {
@@ -40,10 +67,15 @@ func NewPool(workers int, queueSize int) *Pool {
 	}
 
 	pool := &Pool{
-		tasks:       make(chan Task, queueSize),
-		workerCount: workers,
-		queueSize:   queueSize,
+		workerCount:   workers,
+		queueSize:     queueSize,
+		weights:       map[string]int{},
+		starvationAge: DefaultStarvationAge,
 	}
+	for _, lane := range Lanes {
+		pool.lanes = append(pool.lanes, newLaneQueue(lane))
+	}
+	pool.ready = sync.NewCond(&pool.mu)
 
 	// Register capacity metrics
 	metrics.SetWorkerpoolWorkersTotal(float64(workers))
@@ -56,6 +88,26 @@ func NewPool(workers int, queueSize int) *Pool {
 	return pool
 }
 
+// SetProjectWeights sets how many tasks of each project are served on its turn, 1 for the projects without weight
+func (p *Pool) SetProjectWeights(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.weights = map[string]int{}
+	for project, weight := range weights {
+		if weight > 0 {
+			p.weights[project] = weight
+		}
+	}
+}
+
+// SetStarvationAge sets how long a task of a lower priority lane waits before its lane is served first,
+// <= 0 serves the lanes strictly by priority
+func (p *Pool) SetStarvationAge(age time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starvationAge = age
+}
+
 func (p *Pool) Submit(task Task) error {
 	if task.Ctx != nil {
 		select {
@@ -66,28 +118,89 @@ func (p *Pool) Submit(task Task) error {
 		}
 	}
 
+	if task.Lane == "" {
+		task.Lane = LaneFlow
+	}
+	lane := p.lane(task.Lane)
+	if lane == nil {
+		return fmt.Errorf("workerpool has no %s lane", task.Lane)
+	}
 	task.queuedAt = time.Now() // Mark queue entry time
 
-	select {
-	case p.tasks <- task:
-		metrics.IncWorkerpoolTasksSubmitted()
-		metrics.SetWorkerpoolQueueSize(float64(len(p.tasks)))
-		return nil
-	default:
+	p.mu.Lock()
+	if p.queued >= p.queueSize {
+		p.mu.Unlock()
 		metrics.IncWorkerpoolTasksRejected()
 		return errors.New("workerpool queue is full")
 	}
+	lane.push(task, p.weight(task.ProjectUUID))
+	p.queued++
+	queued := p.queued
+	p.mu.Unlock()
+	p.ready.Signal()
+
+	metrics.IncWorkerpoolTasksSubmitted()
+	metrics.SetWorkerpoolQueueSize(float64(queued))
+	return nil
+}
+
+func (p *Pool) lane(name Lane) *laneQueue {
+	for _, lane := range p.lanes {
+		if lane.lane == name {
+			return lane
+		}
+	}
+	return nil
+}
+
+func (p *Pool) weight(project string) int {
+	if weight, ok := p.weights[project]; ok {
+		return weight
+	}
+	return 1
+}
+
+// next waits for a queued task, taking it from the highest priority lane with queued tasks, or from
+// the lane whose oldest task waited the longest when it waited longer than the starvation age
+func (p *Pool) next() (Task, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.queued == 0 {
+		p.ready.Wait()
+	}
+
+	var next *laneQueue
+	var starved time.Time
+	for _, lane := range p.lanes {
+		if lane.queued == 0 {
+			continue
+		}
+		if next == nil {
+			next = lane
+		}
+		if p.starvationAge <= 0 {
+			break
+		}
+		if oldest := lane.oldest(); time.Since(oldest) > p.starvationAge && (starved.IsZero() || oldest.Before(starved)) {
+			next, starved = lane, oldest
+		}
+	}
+
+	task := next.pop(p.weight)
+	p.queued--
+	return task, p.queued
 }
 
 func (p *Pool) worker() {
-	for task := range p.tasks {
+	for {
+		task, queued := p.next()
 		// Update queue size metric
-		metrics.SetWorkerpoolQueueSize(float64(len(p.tasks)))
+		metrics.SetWorkerpoolQueueSize(float64(queued))
 
 		// Measure queue wait time
 		if !task.queuedAt.IsZero() {
 			queueWait := time.Since(task.queuedAt).Seconds()
-			metrics.ObserveWorkerpoolQueueWait(queueWait)
+			metrics.ObserveWorkerpoolQueueWait(string(task.Lane), queueWait)
 		}
 
 		if task.Execute == nil {
@@ -139,5 +252,8 @@ func (p *Pool) worker() {
 
 // GetStats returns current pool statistics (useful for debugging)
 func (p *Pool) GetStats() (workers, busy, queueLen, queueCap int) {
-	return p.workerCount, int(atomic.LoadInt64(&p.busyWorkers)), len(p.tasks), p.queueSize
+	p.mu.Lock()
+	queued := p.queued
+	p.mu.Unlock()
+	return p.workerCount, int(atomic.LoadInt64(&p.busyWorkers)), queued, p.queueSize
 }
@@ -3,6 +3,7 @@ package workerpool
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -175,3 +176,135 @@ func TestPoolWorkerContextCanceledBeforeExecute(t *testing.T) {
 		t.Fatalf("expected context.Canceled, got: %v", res.Err)
 	}
 }
+
+func TestPoolServesProjectsInTurns(t *testing.T) {
+	pool := NewPool(1, 10)
+	pool.SetProjectWeights(map[string]int{"project-a": 2})
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	blocker := Task{
+		Ctx: context.Background(),
+		Execute: func(ctx context.Context) (*coderun.CodeRun, error) {
+			close(started)
+			<-block
+			return &coderun.CodeRun{}, nil
+		},
+	}
+	if err := pool.Submit(blocker); err != nil {
+		t.Fatalf("unexpected submit error: %v", err)
+	}
+	waitSignal(t, started)
+
+	order := make(chan string, 8)
+	submit := func(project string, count int) {
+		for i := 0; i < count; i++ {
+			task := Task{
+				Ctx:         context.Background(),
+				ProjectUUID: project,
+				Execute: func(ctx context.Context) (*coderun.CodeRun, error) {
+					order <- project
+					return &coderun.CodeRun{}, nil
+				},
+			}
+			if err := pool.Submit(task); err != nil {
+				t.Fatalf("unexpected submit error: %v", err)
+			}
+		}
+	}
+	submit("project-a", 4)
+	submit("project-b", 2)
+	if _, _, queued, _ := pool.GetStats(); queued != 6 {
+		t.Fatalf("expected 6 queued tasks, got %d", queued)
+	}
+	close(block)
+
+	var served []string
+	for len(served) < 6 {
+		select {
+		case project := <-order:
+			served = append(served, project)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for workerpool tasks")
+		}
+	}
+	expected := []string{"project-a", "project-a", "project-b", "project-a", "project-a", "project-b"}
+	if strings.Join(served, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected serving order: %v", served)
+	}
+}
+
+func TestPoolServesLanesByPriority(t *testing.T) {
+	pool := NewPool(1, 10)
+	pool.SetStarvationAge(0)
+
+	order := make(chan string, 8)
+	block := func() chan struct{} {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		blocker := Task{
+			Ctx:  context.Background(),
+			Lane: LaneInteractive,
+			Execute: func(ctx context.Context) (*coderun.CodeRun, error) {
+				close(started)
+				<-release
+				return &coderun.CodeRun{}, nil
+			},
+		}
+		if err := pool.Submit(blocker); err != nil {
+			t.Fatalf("unexpected submit error: %v", err)
+		}
+		waitSignal(t, started)
+		return release
+	}
+	submit := func(lane Lane) {
+		task := Task{
+			Ctx:  context.Background(),
+			Lane: lane,
+			Execute: func(ctx context.Context) (*coderun.CodeRun, error) {
+				order <- string(lane)
+				return &coderun.CodeRun{}, nil
+			},
+		}
+		if err := pool.Submit(task); err != nil {
+			t.Fatalf("unexpected submit error: %v", err)
+		}
+	}
+	served := func(count int) string {
+		var lanes []string
+		for len(lanes) < count {
+			select {
+			case lane := <-order:
+				lanes = append(lanes, lane)
+			case <-time.After(2 * time.Second):
+				t.Fatal("timeout waiting for workerpool tasks")
+			}
+		}
+		return strings.Join(lanes, ",")
+	}
+
+	release := block()
+	submit(LaneBatch)
+	submit(LaneFlow)
+	submit(LaneInteractive)
+	close(release)
+	if order := served(3); order != "interactive,flow,batch" {
+		t.Fatalf("unexpected serving order: %v", order)
+	}
+
+	// a starving lane is served before the higher priority ones
+	pool.SetStarvationAge(50 * time.Millisecond)
+	release = block()
+	submit(LaneBatch)
+	time.Sleep(100 * time.Millisecond)
+	submit(LaneInteractive)
+	submit(LaneInteractive)
+	close(release)
+	if order := served(3); order != "batch,interactive,interactive" {
+		t.Fatalf("unexpected serving order: %v", order)
+	}
+
+	if err := pool.Submit(Task{Lane: "urgent"}); err == nil {
+		t.Fatal("expected unknown lane error")
+	}
+}
@@ -0,0 +1,227 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/metrics"
+	"github.com/weni-ai/flows-code-actions/internal/workerpool"
+)
+
+const (
+	// workerKey is the code run extra key where the identity of the executing worker is recorded
+	workerKey = "worker"
+	// redeliveriesKey is the code run extra key counting the executions left unfinished by a lost worker
+	redeliveriesKey = "redeliveries"
+)
+
+// RunFunc executes a queued code run, returning it once its final state is persisted
+type RunFunc func(ctx context.Context, run *coderun.CodeRun) (*coderun.CodeRun, error)
+
+// RunConsumer executes the code runs published by Queue. A message is acked only after the run
+// final state is persisted, so runs of a lost worker are redelivered to another one
+type RunConsumer struct {
+	QueueName       string
+	Workers         int
+	MaxRedeliveries int
+	codeRuns        coderun.UseCase
+	run             RunFunc
+	worker          string
+}
+
+func NewRunConsumer(queueName string, workers int, maxRedeliveries int, codeRuns coderun.UseCase, run RunFunc) *RunConsumer {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &RunConsumer{
+		QueueName:       queueName,
+		Workers:         workers,
+		MaxRedeliveries: maxRedeliveries,
+		codeRuns:        codeRuns,
+		run:             run,
+		worker:          WorkerID(),
+	}
+}
+
+// WorkerID identifies this process as "<hostname>/<pid>"
+func WorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+func (c *RunConsumer) String() string {
+	return c.QueueName
+}
+
+// Declare declares the queue with a priority per lane. A queue declared without them by a previous version
+// is refused by the broker, and must be deleted once drained
+func (c *RunConsumer) Declare(ctx context.Context, ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		c.QueueName,
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{"x-max-priority": int32(maxPriority)},
+	)
+	if err != nil {
+		msg := "failed to declare code runs queue"
+		if e, ok := err.(*amqp.Error); ok && e.Code == amqp.PreconditionFailed {
+			msg = "code runs queue was declared without the lane priorities, delete it once drained or set another queue name"
+		}
+		log.WithError(err).Error(msg)
+		return err
+	}
+	return nil
+}
+
+func (c *RunConsumer) Consume(ctx context.Context, ch *amqp.Channel) error {
+	err := ch.Qos(c.Workers, 0, false)
+	if err != nil {
+		log.WithError(err).Error("failed to set qos")
+		return err
+	}
+
+	msgs, err := ch.Consume(
+		c.QueueName,
+		c.worker,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		log.WithError(err).Error(fmt.Sprintf("failed to consume %v", c.QueueName))
+		return err
+	}
+
+	metrics.SetWorkerpoolWorkersTotal(float64(c.Workers))
+	slots := make(chan struct{}, c.Workers)
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return amqp.ErrClosed
+			}
+			slots <- struct{}{}
+			go func() {
+				defer func() { <-slots }()
+				c.handle(ctx, msg)
+			}()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handle executes the run of a delivery, acking it once the run is finished
+func (c *RunConsumer) handle(ctx context.Context, msg amqp.Delivery) {
+	m := runMessage{}
+	if err := json.Unmarshal(msg.Body, &m); err != nil || m.RunID == "" {
+		log.WithError(err).Error("invalid code run message")
+		c.ack(msg)
+		return
+	}
+	if m.Lane == "" {
+		// published before the lanes
+		m.Lane = workerpool.LaneFlow
+	}
+	if !msg.Timestamp.IsZero() {
+		metrics.ObserveWorkerpoolQueueWait(string(m.Lane), time.Since(msg.Timestamp).Seconds())
+	}
+
+	run, err := c.codeRuns.GetByID(ctx, m.RunID)
+	if err != nil {
+		log.WithError(err).WithField("run_id", m.RunID).Error("failed to get queued code run")
+		if run == nil {
+			c.ack(msg)
+			return
+		}
+		c.nack(msg)
+		return
+	}
+
+	// a redelivered run may have been finished by a worker lost before acking it
+	if run.Status == coderun.StatusCompleted || run.Status == coderun.StatusFailed {
+		c.ack(msg)
+		return
+	}
+
+	if run.Extra == nil {
+		run.Extra = map[string]interface{}{}
+	}
+	if msg.Redelivered {
+		redeliveries := toInt(run.Extra[redeliveriesKey]) + 1
+		run.Extra[redeliveriesKey] = redeliveries
+		if redeliveries > c.MaxRedeliveries {
+			run.Status = coderun.StatusFailed
+			run.Result = fmt.Sprintf("code run abandoned after %d redeliveries", c.MaxRedeliveries)
+			if _, err := c.codeRuns.Update(ctx, run.ID, run); err != nil {
+				log.WithError(err).WithField("run_id", run.ID).Error("failed to fail redelivered code run")
+				c.nack(msg)
+				return
+			}
+			metrics.IncWorkerpoolTasksFailed()
+			c.ack(msg)
+			return
+		}
+	}
+	run.Extra[workerKey] = c.worker
+
+	metrics.IncWorkerpoolWorkersBusy()
+	start := time.Now()
+	finished, err := c.run(ctx, run)
+	metrics.ObserveWorkerpoolTaskDuration(time.Since(start).Seconds())
+	metrics.DecWorkerpoolWorkersBusy()
+
+	if finished == nil {
+		// the run final state was not persisted, let it be delivered again
+		log.WithError(err).WithField("run_id", run.ID).Error("failed to persist code run")
+		metrics.IncWorkerpoolTasksFailed()
+		c.nack(msg)
+		return
+	}
+	if err != nil {
+		metrics.IncWorkerpoolTasksFailed()
+	} else {
+		metrics.IncWorkerpoolTasksCompleted()
+	}
+	c.ack(msg)
+}
+
+func (c *RunConsumer) ack(msg amqp.Delivery) {
+	if err := msg.Ack(false); err != nil {
+		log.WithError(err).Error("failed to ack code run message")
+	}
+}
+
+func (c *RunConsumer) nack(msg amqp.Delivery) {
+	if err := msg.Nack(false, true); err != nil {
+		log.WithError(err).Error("failed to nack code run message")
+	}
+}
+
+// toInt reads a counter from a code run extra, which may be decoded from json or bson
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
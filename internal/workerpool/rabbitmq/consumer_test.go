@@ -0,0 +1,89 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/workerpool"
+)
+
+type fakeAcknowledger struct {
+	acks, nacks int
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks++
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacks++
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.nacks++
+	return nil
+}
+
+type fakeCodeRuns struct {
+	coderun.UseCase
+	runs map[string]*coderun.CodeRun
+}
+
+func (f *fakeCodeRuns) GetByID(ctx context.Context, id string) (*coderun.CodeRun, error) {
+	return f.runs[id], nil
+}
+
+func (f *fakeCodeRuns) Update(ctx context.Context, id string, run *coderun.CodeRun) (*coderun.CodeRun, error) {
+	f.runs[id] = run
+	return run, nil
+}
+
+func TestRunConsumerHandle(t *testing.T) {
+	runs := &fakeCodeRuns{runs: map[string]*coderun.CodeRun{
+		"queued":    {ID: "queued", Status: coderun.StatusQueued},
+		"completed": {ID: "completed", Status: coderun.StatusCompleted},
+		"lost":      {ID: "lost", Status: coderun.StatusStarted, Extra: map[string]interface{}{redeliveriesKey: 1.0}},
+	}}
+	executed := []string{}
+	c := NewRunConsumer("runs", 1, 1, runs, func(ctx context.Context, run *coderun.CodeRun) (*coderun.CodeRun, error) {
+		executed = append(executed, run.ID)
+		run.Status = coderun.StatusCompleted
+		return runs.Update(ctx, run.ID, run)
+	})
+
+	deliver := func(body string, redelivered bool) *fakeAcknowledger {
+		ack := &fakeAcknowledger{}
+		c.handle(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte(body), Redelivered: redelivered})
+		return ack
+	}
+
+	ack := deliver(`{"run_id":"queued"}`, false)
+	assert.Equal(t, 1, ack.acks)
+	assert.Equal(t, []string{"queued"}, executed)
+	assert.Equal(t, WorkerID(), runs.runs["queued"].Extra[workerKey])
+
+	ack = deliver(`{"run_id":"completed"}`, true)
+	assert.Equal(t, 1, ack.acks)
+	assert.Equal(t, []string{"queued"}, executed)
+
+	ack = deliver(`{"run_id":"lost"}`, true)
+	assert.Equal(t, 1, ack.acks)
+	assert.Equal(t, []string{"queued"}, executed)
+	assert.Equal(t, coderun.StatusFailed, runs.runs["lost"].Status)
+
+	ack = deliver(`not json`, false)
+	assert.Equal(t, 1, ack.acks)
+}
+
+func TestLanePriority(t *testing.T) {
+	assert.Equal(t, uint8(2), maxPriority)
+	assert.Equal(t, uint8(2), lanePriority(workerpool.LaneInteractive))
+	assert.Equal(t, uint8(1), lanePriority(workerpool.LaneFlow))
+	assert.Equal(t, uint8(0), lanePriority(workerpool.LaneBatch))
+	assert.Equal(t, uint8(1), lanePriority(""))
+}
@@ -0,0 +1,131 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/furdarius/rabbitroutine"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/weni-ai/flows-code-actions/internal/coderun"
+	"github.com/weni-ai/flows-code-actions/internal/metrics"
+	"github.com/weni-ai/flows-code-actions/internal/workerpool"
+)
+
+var errNoRunID = errors.New("durable queue task has no code run id")
+
+const publishTimeout = 10 * time.Second
+
+// maxPriority is the x-max-priority of the queue, the priority of the highest lane
+var maxPriority = uint8(len(workerpool.Lanes) - 1)
+
+// lanePriority is the message priority of the runs of the lane, the queue delivers the higher priorities first
+func lanePriority(lane workerpool.Lane) uint8 {
+	for i, l := range workerpool.Lanes {
+		if l == lane {
+			return maxPriority - uint8(i)
+		}
+	}
+	return lanePriority(workerpool.LaneFlow)
+}
+
+// runMessage is the message published for each queued code run
+type runMessage struct {
+	RunID string          `json:"run_id"`
+	Lane  workerpool.Lane `json:"lane,omitempty"`
+}
+
+// Queue is a workerpool.Submitter publishing tasks to a durable RabbitMQ queue, where they are
+// executed by the RunConsumer of any node. The task Result is sent once the code run is finished
+type Queue struct {
+	publisher    rabbitroutine.Publisher
+	queueName    string
+	codeRuns     coderun.UseCase
+	pollInterval time.Duration
+}
+
+func NewQueue(conn *rabbitroutine.Connector, queueName string, codeRuns coderun.UseCase) *Queue {
+	pool := rabbitroutine.NewPool(conn)
+	publisher := rabbitroutine.NewRetryPublisher(
+		rabbitroutine.NewEnsurePublisher(pool),
+		rabbitroutine.PublishMaxAttemptsSetup(3),
+		rabbitroutine.PublishDelaySetup(rabbitroutine.LinearDelay(100*time.Millisecond)),
+	)
+	return &Queue{
+		publisher:    publisher,
+		queueName:    queueName,
+		codeRuns:     codeRuns,
+		pollInterval: 250 * time.Millisecond,
+	}
+}
+
+func (q *Queue) Submit(task workerpool.Task) error {
+	ctx := task.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		metrics.IncWorkerpoolTasksTimeout()
+		return err
+	}
+	if task.RunID == "" {
+		metrics.IncWorkerpoolTasksRejected()
+		return errNoRunID
+	}
+
+	if task.Lane == "" {
+		task.Lane = workerpool.LaneFlow
+	}
+	body, err := json.Marshal(runMessage{RunID: task.RunID, Lane: task.Lane})
+	if err != nil {
+		return errors.Wrap(err, "error on encoding code run message")
+	}
+
+	pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	err = q.publisher.Publish(pubCtx, "", q.queueName, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     lanePriority(task.Lane),
+		MessageId:    task.RunID,
+		Timestamp:    time.Now(),
+		Body:         body,
+	})
+	if err != nil {
+		metrics.IncWorkerpoolTasksRejected()
+		return errors.Wrap(err, "error on publishing code run to durable queue")
+	}
+	metrics.IncWorkerpoolTasksSubmitted()
+
+	if task.Result != nil {
+		go q.await(ctx, task.RunID, task.Result)
+	}
+	return nil
+}
+
+// await polls the code run until it is finished by a consumer, sending it as the task result
+func (q *Queue) await(ctx context.Context, runID string, result chan workerpool.Result) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			result <- workerpool.Result{Err: ctx.Err()}
+			return
+		case <-ticker.C:
+			run, err := q.codeRuns.GetByID(ctx, runID)
+			if err != nil || run == nil {
+				continue
+			}
+			switch run.Status {
+			case coderun.StatusCompleted:
+				result <- workerpool.Result{Run: run}
+				return
+			case coderun.StatusFailed:
+				result <- workerpool.Result{Run: run, Err: errors.New(run.Result)}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+-- Drop codelogs table
+-- Migration: 000006_create_codelogs_table (DOWN)
+
+-- Drop indexes first
+DROP INDEX IF EXISTS idx_codelogs_created_at;
+DROP INDEX IF EXISTS idx_codelogs_run_id_code_id;
+DROP INDEX IF EXISTS idx_codelogs_code_id;
+DROP INDEX IF EXISTS idx_codelogs_run_id;
+
+-- Drop table
+DROP TABLE IF EXISTS codelogs;
@@ -0,0 +1,4 @@
+-- Restore codes language CHECK constraint
+-- Migration: 000007_drop_codes_language_check (DOWN)
+
+ALTER TABLE codes ADD CONSTRAINT codes_language_check CHECK (language IN ('python', 'go', 'javascript'));
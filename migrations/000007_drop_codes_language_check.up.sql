@@ -0,0 +1,5 @@
+-- Drop codes language CHECK constraint
+-- Migration: 000007_drop_codes_language_check
+-- Supported languages come from the coderunner runtime registry and are validated by the application
+
+ALTER TABLE codes DROP CONSTRAINT IF EXISTS codes_language_check;
@@ -0,0 +1,5 @@
+-- Remove code run completion webhooks
+-- Migration: 000008_add_coderun_webhooks (DOWN)
+
+ALTER TABLE projects DROP COLUMN IF EXISTS webhook_secret;
+ALTER TABLE codes DROP COLUMN IF EXISTS callback_url;
@@ -0,0 +1,8 @@
+-- Add code run completion webhooks
+-- Migration: 000008_add_coderun_webhooks
+
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS callback_url VARCHAR(2048);
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+
+COMMENT ON COLUMN codes.callback_url IS 'Default URL notified when a run of the code finishes';
+COMMENT ON COLUMN projects.webhook_secret IS 'HMAC secret signing the code run completion webhooks';
@@ -0,0 +1,9 @@
+-- Drop code_versions table
+-- Migration: 000009_create_code_versions_table (DOWN)
+
+ALTER TABLE coderuns DROP COLUMN IF EXISTS code_version;
+ALTER TABLE codes DROP COLUMN IF EXISTS version;
+
+DROP INDEX IF EXISTS idx_code_versions_code_id_version;
+
+DROP TABLE IF EXISTS code_versions;
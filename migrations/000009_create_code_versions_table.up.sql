@@ -0,0 +1,30 @@
+-- Create code_versions table
+-- Migration: 000009_create_code_versions_table
+-- Every source change of a code is kept as an immutable revision, and runs record the version they executed
+
+CREATE TABLE IF NOT EXISTS code_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code_id UUID NOT NULL REFERENCES codes(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL CHECK (version > 0),
+    source TEXT NOT NULL,
+    rollback_of INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for better performance
+CREATE UNIQUE INDEX IF NOT EXISTS idx_code_versions_code_id_version ON code_versions(code_id, version);
+
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE coderuns ADD COLUMN IF NOT EXISTS code_version INTEGER;
+
+-- Current sources become the first version of the existing codes
+INSERT INTO code_versions (code_id, version, source, created_at)
+SELECT id, 1, source, updated_at FROM codes
+ON CONFLICT (code_id, version) DO NOTHING;
+
+-- Add comments for documentation
+COMMENT ON TABLE code_versions IS 'Immutable revisions of the code sources';
+COMMENT ON COLUMN code_versions.version IS 'Revision number of the code, starting at 1';
+COMMENT ON COLUMN code_versions.rollback_of IS 'Version restored by this revision, when created by a rollback';
+COMMENT ON COLUMN codes.version IS 'Current source revision, stored on code_versions';
+COMMENT ON COLUMN coderuns.code_version IS 'Version of the code source executed by the run';
@@ -0,0 +1,8 @@
+-- Remove codes draft and published versions
+-- Migration: 000010_add_codes_published_version (DOWN)
+-- The published source is restored as the code source, dropping unpublished drafts
+
+UPDATE codes SET source = published_source, version = published_version WHERE published_version IS NOT NULL;
+
+ALTER TABLE codes DROP COLUMN IF EXISTS published_source;
+ALTER TABLE codes DROP COLUMN IF EXISTS published_version;
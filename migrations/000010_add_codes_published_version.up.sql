@@ -0,0 +1,13 @@
+-- Add codes draft and published versions
+-- Migration: 000010_add_codes_published_version
+-- source and version hold the draft, the executions serve the published version
+
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS published_version INTEGER;
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS published_source TEXT;
+
+-- Existing codes keep serving their current source
+UPDATE codes SET published_version = version, published_source = source WHERE published_version IS NULL;
+
+COMMENT ON COLUMN codes.version IS 'Draft source revision, stored on code_versions';
+COMMENT ON COLUMN codes.published_version IS 'Source revision served by the executions';
+COMMENT ON COLUMN codes.published_source IS 'Source of the published revision';
@@ -0,0 +1,6 @@
+-- Drop secrets table
+-- Migration: 000011_create_secrets_table (DOWN)
+
+DROP INDEX IF EXISTS idx_secrets_unique_project_code_name;
+
+DROP TABLE IF EXISTS secrets;
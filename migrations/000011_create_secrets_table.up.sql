@@ -0,0 +1,21 @@
+-- Create secrets table
+-- Migration: 000011_create_secrets_table
+-- Secrets of the projects and codes, encrypted with the configured master key and injected in the actions environment
+
+CREATE TABLE IF NOT EXISTS secrets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_uuid VARCHAR(255) NOT NULL,
+    code_id TEXT NOT NULL DEFAULT '',
+    name VARCHAR(128) NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for better performance
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_unique_project_code_name ON secrets(project_uuid, code_id, name);
+
+-- Add comments for documentation
+COMMENT ON TABLE secrets IS 'Stores the secrets of the projects and codes, encrypted at rest';
+COMMENT ON COLUMN secrets.code_id IS 'Code the secret is scoped to (PostgreSQL UUID or MongoDB ObjectID), empty for project secrets';
+COMMENT ON COLUMN secrets.value IS 'AES-256-GCM encrypted value, base64(nonce | ciphertext)';
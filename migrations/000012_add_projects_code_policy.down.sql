@@ -0,0 +1,4 @@
+-- Remove per-project code validation policy
+-- Migration: 000012_add_projects_code_policy (DOWN)
+
+ALTER TABLE projects DROP COLUMN IF EXISTS code_policy;
@@ -0,0 +1,6 @@
+-- Add per-project code validation policy
+-- Migration: 000012_add_projects_code_policy
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS code_policy JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+COMMENT ON COLUMN projects.code_policy IS 'Names allowed and denied to the project codes by the code validation';
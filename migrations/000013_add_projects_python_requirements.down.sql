@@ -0,0 +1,4 @@
+-- Remove per-project pinned python libraries
+-- Migration: 000013_add_projects_python_requirements (DOWN)
+
+ALTER TABLE projects DROP COLUMN IF EXISTS python_requirements;
@@ -0,0 +1,6 @@
+-- Add per-project pinned python libraries
+-- Migration: 000013_add_projects_python_requirements
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS python_requirements JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN projects.python_requirements IS 'Pinned python libraries installed in the virtualenv of the project codes';
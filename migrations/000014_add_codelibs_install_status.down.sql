@@ -0,0 +1,5 @@
+-- Remove installation status of code libraries
+-- Migration: 000014_add_codelibs_install_status (DOWN)
+
+ALTER TABLE codelibs DROP COLUMN IF EXISTS output;
+ALTER TABLE codelibs DROP COLUMN IF EXISTS status;
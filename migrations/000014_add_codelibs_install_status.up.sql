@@ -0,0 +1,9 @@
+-- Add installation status of code libraries
+-- Migration: 000014_add_codelibs_install_status
+
+ALTER TABLE codelibs ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'installed'
+    CHECK (status IN ('pending', 'installed', 'failed'));
+ALTER TABLE codelibs ADD COLUMN IF NOT EXISTS output TEXT NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN codelibs.status IS 'Installation status of the library: pending, installed or failed';
+COMMENT ON COLUMN codelibs.output IS 'pip output of the last installation of the library';
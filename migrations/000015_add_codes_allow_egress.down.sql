@@ -0,0 +1,4 @@
+-- Remove per-code network access of the sandboxed runs
+-- Migration: 000015_add_codes_allow_egress (DOWN)
+
+ALTER TABLE codes DROP COLUMN IF EXISTS allow_egress;
@@ -0,0 +1,6 @@
+-- Add per-code network access of the sandboxed runs
+-- Migration: 000015_add_codes_allow_egress
+
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS allow_egress BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN codes.allow_egress IS 'Keeps the network of the runs of the code when they are sandboxed';
@@ -0,0 +1,4 @@
+-- Remove per-project network policy of the code runs
+-- Migration: 000016_add_projects_egress_policy (DOWN)
+
+ALTER TABLE projects DROP COLUMN IF EXISTS egress_policy;
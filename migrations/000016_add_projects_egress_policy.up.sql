@@ -0,0 +1,6 @@
+-- Add per-project network policy of the code runs
+-- Migration: 000016_add_projects_egress_policy
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS egress_policy JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+COMMENT ON COLUMN projects.egress_policy IS 'Domains and CIDRs the project code runs can connect to';
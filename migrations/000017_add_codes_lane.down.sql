@@ -0,0 +1,4 @@
+-- Remove per-code worker pool lane of the runs
+-- Migration: 000017_add_codes_lane (DOWN)
+
+ALTER TABLE codes DROP COLUMN IF EXISTS lane;
@@ -0,0 +1,6 @@
+-- Add per-code worker pool lane of the runs
+-- Migration: 000017_add_codes_lane
+
+ALTER TABLE codes ADD COLUMN IF NOT EXISTS lane VARCHAR(20);
+
+COMMENT ON COLUMN codes.lane IS 'Worker pool lane of the runs of the code, the lane of the route when null';
@@ -0,0 +1,13 @@
+-- Split the project settings back into the code policy, python requirements and egress policy fields
+-- Migration: 000018_merge_projects_settings (DOWN)
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS code_policy JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS python_requirements JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS egress_policy JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+UPDATE projects SET
+    code_policy = COALESCE(settings->'code_policy', '{}'::jsonb),
+    python_requirements = COALESCE(settings->'python_requirements', '[]'::jsonb),
+    egress_policy = COALESCE(settings->'egress_policy', '{}'::jsonb);
+
+ALTER TABLE projects DROP COLUMN IF EXISTS settings;
@@ -0,0 +1,16 @@
+-- Merge the project code policy, python requirements and egress policy into one settings field
+-- Migration: 000018_merge_projects_settings
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+UPDATE projects SET settings = jsonb_build_object(
+    'code_policy', code_policy,
+    'python_requirements', python_requirements,
+    'egress_policy', egress_policy
+);
+
+ALTER TABLE projects DROP COLUMN IF EXISTS code_policy;
+ALTER TABLE projects DROP COLUMN IF EXISTS python_requirements;
+ALTER TABLE projects DROP COLUMN IF EXISTS egress_policy;
+
+COMMENT ON COLUMN projects.settings IS 'Code policy, python requirements and egress policy of the project codes';
@@ -0,0 +1,4 @@
+-- Remove installation status of code libraries on each node
+-- Migration: 000019_add_codelibs_nodes (DOWN)
+
+ALTER TABLE codelibs DROP COLUMN IF EXISTS nodes;
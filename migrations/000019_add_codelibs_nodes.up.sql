@@ -0,0 +1,6 @@
+-- Add installation status of code libraries on each node
+-- Migration: 000019_add_codelibs_nodes
+
+ALTER TABLE codelibs ADD COLUMN IF NOT EXISTS nodes JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN codelibs.nodes IS 'Installation status and pip output of the library on each node';